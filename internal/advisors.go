@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Advisors: /api/person/{id}/advisor, /api/person/{id}/advisors and
+/api/person/{id}/advisees.
+
+Professors advise students. Assigning an advisor to a student who already has
+one reassigns them: the previous assignment ends but stays in the history of
+the student, which lists every assignment in the order it was made.
+*/
+
+// errNotStudent is returned by updates that would stop an advisee from being
+// a student.
+var errNotStudent = errors.New("advisee is not a student")
+
+// AssignAdvisor assigns or reassigns the advisor of a student. It answers 201
+// for a new assignment and 200 when the professor already advises the
+// student.
+func (s *Server) AssignAdvisor(w http.ResponseWriter, r *http.Request) {
+	var req AdvisorRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	student, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if !writeValidationProblem(w, Validate(req)) {
+		return
+	}
+	if !s.validateAdvisor(w, student, req.AdvisorID) {
+		return
+	}
+
+	assignment := AdvisorAssignment{StudentID: student.ID, AdvisorID: req.AdvisorID}
+	var kept bool
+	err := s.audited(r).Transaction(func(tx Store) error {
+		current, err := tx.ListAdvisorAssignments(AdvisorFilter{StudentID: student.ID, Current: true})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		kept = len(current) > 0 && current[0].AdvisorID == req.AdvisorID
+		if err := tx.AssignAdvisor(&assignment); errors.Is(err, gorm.ErrForeignKeyViolated) {
+			// The advisor was deleted or changed type since validation.
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidReference, "JSON advisor_id '%v' does not reference a professor.", req.AdvisorID)
+			return err
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if !kept {
+		render.Status(r, http.StatusCreated)
+	}
+	render.JSON(w, r, assignment)
+}
+
+// EndAdvisor ends the current advisor assignment of a student.
+func (s *Server) EndAdvisor(w http.ResponseWriter, r *http.Request) {
+	student, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	err := s.audited(r).EndAdvisorAssignment(student.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' has no advisor.", student.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Advisor assignment ended."})
+}
+
+// GetPersonAdvisors lists the advisor assignments of a student, current and
+// past, oldest first. Only students have advisors.
+func (s *Server) GetPersonAdvisors(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if person.Type != "student" {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' is not a student, so they have no advisors.", person.ID)
+		return
+	}
+
+	assignments, err := s.store.ListAdvisorAssignments(AdvisorFilter{StudentID: person.ID})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if assignments == nil {
+		assignments = []AdvisorAssignment{}
+	}
+	render.JSON(w, r, assignments)
+}
+
+// GetPersonAdvisees lists one page of the students a professor currently
+// advises. Only professors have advisees.
+func (s *Server) GetPersonAdvisees(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, PersonSortColumns)
+	if !ok {
+		return
+	}
+	for key := range r.URL.Query() {
+		if !slices.Contains(pageParams, key) {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return
+		}
+	}
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if person.Type != "professor" {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' is not a professor, so they have no advisees.", person.ID)
+		return
+	}
+
+	persons, total, err := s.store.ListPersons(PersonFilter{AdvisorID: person.ID}, page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	persons = writePage(w, r, page, persons, total)
+	render.JSON(w, r, NewPersonResponses(persons))
+}
+
+// validateAdvisor checks that student is a student and that the advisor
+// exists and is a professor, writing a 400 listing every failure.
+func (s *Server) validateAdvisor(w http.ResponseWriter, student Person, advisorID int) bool {
+	var errs []FieldError
+	if student.Type != "student" {
+		errs = append(errs, FieldError{Field: "id", Code: "type", Message: fmt.Sprintf("Person with id '%v' is not a student, so they cannot be advised.", student.ID)})
+	}
+	advisor, err := s.store.GetPerson(advisorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		errs = append(errs, FieldError{Field: "advisor_id", Code: "exists", Message: fmt.Sprintf("Person with id '%v' does not exist.", advisorID)})
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	} else if advisor.Type != "professor" {
+		errs = append(errs, FieldError{Field: "advisor_id", Code: "type", Message: fmt.Sprintf("Person with id '%v' is not a professor, so they cannot advise.", advisor.ID)})
+	}
+	return writeValidationProblem(w, errs)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/render"
+)
+
+/*
+Audit log: the actor of a request and GET /api/audit.
+
+The actor is whoever the client names in the X-Actor header. The API has no
+user accounts, so it is taken on trust and defaults to "anonymous". Changes
+that require authentication, such as grades, are recorded as made by the
+authenticated admin or person instead.
+*/
+
+const (
+	ActorHeader    = "X-Actor"
+	AnonymousActor = "anonymous"
+	maxActorLength = 100
+)
+
+var AuditSortColumns = []string{"id"}
+
+// auditFilterParams are the query parameters accepted by GET /api/audit, in
+// addition to the pagination parameters.
+var auditFilterParams = []string{"entity", "id", "actor", "since"}
+
+type actorKey struct{}
+
+// withActor stores the actor named by the X-Actor header in the request
+// context. It writes a 400 when the name is too long.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := strings.TrimSpace(r.Header.Get(ActorHeader))
+		if utf8.RuneCountInString(actor) > maxActorLength {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "%v header must be at most %d characters.", ActorHeader, maxActorLength)
+			return
+		}
+		if actor == "" {
+			actor = AnonymousActor
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+	})
+}
+
+// Actor returns the actor of the request context.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// audited returns the store that mutations made by the request go through,
+// which records them in the audit log.
+func (s *Server) audited(r *http.Request) Store {
+	return Audited(s.store, Actor(r.Context()))
+}
+
+// GetAudit lists the audit log to admins, oldest entry first.
+func (s *Server) GetAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	page, ok := ParsePage(w, r, AuditSortColumns)
+	if !ok {
+		return
+	}
+	filter, ok := ParseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	entries, total, err := s.store.ListAudit(filter, page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	entries = writePage(w, r, page, entries, total)
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	render.JSON(w, r, entries)
+}
+
+// ParseAuditFilter reads the filter query parameters of GET /api/audit. It
+// writes a 400 and returns false when one is unknown or invalid.
+func ParseAuditFilter(w http.ResponseWriter, r *http.Request) (AuditFilter, bool) {
+	var filter AuditFilter
+	query := r.URL.Query()
+
+	for key := range query {
+		if !slices.Contains(auditFilterParams, key) && !slices.Contains(pageParams, key) {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return filter, false
+		}
+	}
+
+	filter.Entity = query.Get("entity")
+	if filter.Entity != "" && !slices.Contains(AuditEntities, filter.Entity) {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid entity '%v' on query parameter. Must be one of %v.", filter.Entity, strings.Join(AuditEntities, ", "))
+		return filter, false
+	}
+
+	id, ok := parseOptionalInt(w, r, "id")
+	if !ok {
+		return filter, false
+	}
+	if id != nil {
+		if filter.Entity == "" {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "The id query parameter requires an entity.")
+			return filter, false
+		}
+		filter.EntityID = *id
+	}
+
+	filter.Actor = query.Get("actor")
+
+	if val := query.Get("since"); val != "" {
+		since, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid since '%v' on query parameter. Must be an RFC 3339 timestamp.", val)
+			return filter, false
+		}
+		filter.Since = since
+	}
+	return filter, true
+}
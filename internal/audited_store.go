@@ -0,0 +1,793 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// auditedStore is a Store that appends an AuditEntry for every person,
+// course, term, department, program and offering a mutation changes. Each
+// mutation runs in a transaction together with its entries, so a change is
+// never committed without them.
+type auditedStore struct {
+	Store
+	actor string
+}
+
+// Audited returns a view of store whose mutations are recorded in the audit
+// log as made by actor.
+func Audited(store Store, actor string) Store {
+	return &auditedStore{Store: store, actor: actor}
+}
+
+func (a *auditedStore) Transaction(fn func(tx Store) error) error {
+	return a.Store.Transaction(func(tx Store) error {
+		return fn(&auditedStore{Store: tx, actor: a.actor})
+	})
+}
+
+/*
+Courses.
+*/
+
+func (a *auditedStore) CreateCourse(course *Course) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreateCourse(course); err != nil {
+			return err
+		}
+		return a.record(tx, AuditCourse, course.ID, AuditCreate, nil, courseSnapshot(*course))
+	})
+}
+
+// UpdateCourse also records the students a raised capacity promotes.
+func (a *auditedStore) UpdateCourse(course *Course) error {
+	affected := func(tx Store) ([]int, error) {
+		return waitlistedFor(tx, nil, []int{course.ID})
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		before, err := tx.GetCourse(course.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateCourse(course); err != nil {
+			return err
+		}
+		return a.record(tx, AuditCourse, course.ID, AuditUpdate, courseSnapshot(before), courseSnapshot(*course))
+	})
+}
+
+func (a *auditedStore) DeleteCourse(id int, version int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetCourse(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteCourse(id, version); err != nil {
+			return err
+		}
+		return a.record(tx, AuditCourse, id, AuditDelete, courseSnapshot(before), nil)
+	})
+}
+
+func (a *auditedStore) RestoreCourse(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.RestoreCourse(id); err != nil {
+			return err
+		}
+		after, err := tx.GetCourse(id)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditCourse, id, AuditRestore, nil, courseSnapshot(after))
+	})
+}
+
+func (a *auditedStore) AddPrerequisite(courseID int, prerequisiteID int) error {
+	return a.prerequisites(courseID, func(tx Store) error {
+		return tx.AddPrerequisite(courseID, prerequisiteID)
+	})
+}
+
+func (a *auditedStore) RemovePrerequisite(courseID int, prerequisiteID int) error {
+	return a.prerequisites(courseID, func(tx Store) error {
+		return tx.RemovePrerequisite(courseID, prerequisiteID)
+	})
+}
+
+// prerequisites runs fn and records the change it made to the direct
+// prerequisites of a course.
+func (a *auditedStore) prerequisites(courseID int, fn func(tx Store) error) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := prerequisiteSnapshot(tx, courseID)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		after, err := prerequisiteSnapshot(tx, courseID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditCourse, courseID, AuditPrerequisites, before, after)
+	})
+}
+
+/*
+Persons.
+*/
+
+func (a *auditedStore) CreatePerson(person *Person) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreatePerson(person); err != nil {
+			return err
+		}
+		after, err := personSnapshot(tx, person.ID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditPerson, person.ID, AuditCreate, nil, after)
+	})
+}
+
+// UpdatePerson also records the students that take the seats the person
+// leaves.
+func (a *auditedStore) UpdatePerson(person *Person) error {
+	affected := func(tx Store) ([]int, error) {
+		if person.Courses == nil {
+			return nil, nil
+		}
+		current, err := tx.GetPerson(person.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := waitlistedFor(tx, nil, courseIDs(current.Courses))
+		return slices.DeleteFunc(ids, func(id int) bool { return id == person.ID }), err
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		before, err := personSnapshot(tx, person.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdatePerson(person); err != nil {
+			return err
+		}
+		after, err := personSnapshot(tx, person.ID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditPerson, person.ID, AuditUpdate, before, after)
+	})
+}
+
+// DeletePerson also records the students that take the seats the person
+// leaves.
+func (a *auditedStore) DeletePerson(id int, version int) error {
+	affected := func(tx Store) ([]int, error) {
+		current, err := tx.GetPerson(id)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := waitlistedFor(tx, nil, courseIDs(current.Courses))
+		return slices.DeleteFunc(ids, func(other int) bool { return other == id }), err
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		before, err := personSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeletePerson(id, version); err != nil {
+			return err
+		}
+		return a.record(tx, AuditPerson, id, AuditDelete, before, nil)
+	})
+}
+
+func (a *auditedStore) RestorePerson(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.RestorePerson(id); err != nil {
+			return err
+		}
+		after, err := personSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditPerson, id, AuditRestore, nil, after)
+	})
+}
+
+// SetCalendarToken records the change as an update of the person. The diff
+// holds the creation times of the tokens, never the tokens.
+func (a *auditedStore) SetCalendarToken(token *CalendarToken) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before := map[string]any{"calendar_token_created_at": nil}
+		current, err := tx.GetCalendarToken(token.PersonID)
+		if err == nil {
+			before["calendar_token_created_at"] = current.CreatedAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.SetCalendarToken(token); err != nil {
+			return err
+		}
+		after := map[string]any{"calendar_token_created_at": token.CreatedAt}
+		return a.record(tx, AuditPerson, token.PersonID, AuditUpdate, snapshot(before), snapshot(after))
+	})
+}
+
+// SetAccessToken records the change as an update of the person, like
+// SetCalendarToken.
+func (a *auditedStore) SetAccessToken(token *AccessToken) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before := map[string]any{"access_token_created_at": nil}
+		current, err := tx.GetAccessToken(token.PersonID)
+		if err == nil {
+			before["access_token_created_at"] = current.CreatedAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.SetAccessToken(token); err != nil {
+			return err
+		}
+		after := map[string]any{"access_token_created_at": token.CreatedAt}
+		return a.record(tx, AuditPerson, token.PersonID, AuditUpdate, snapshot(before), snapshot(after))
+	})
+}
+
+/*
+Terms and offerings.
+*/
+
+func (a *auditedStore) CreateTerm(term *Term) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreateTerm(term); err != nil {
+			return err
+		}
+		return a.record(tx, AuditTerm, term.ID, AuditCreate, nil, snapshot(term))
+	})
+}
+
+func (a *auditedStore) UpdateTerm(term *Term) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetTerm(term.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateTerm(term); err != nil {
+			return err
+		}
+		return a.record(tx, AuditTerm, term.ID, AuditUpdate, snapshot(before), snapshot(term))
+	})
+}
+
+func (a *auditedStore) DeleteTerm(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetTerm(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteTerm(id); err != nil {
+			return err
+		}
+		return a.record(tx, AuditTerm, id, AuditDelete, snapshot(before), nil)
+	})
+}
+
+// SetTermHolidays records the change as an update of the term.
+func (a *auditedStore) SetTermHolidays(termID int, holidays []Holiday) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.ListHolidays(termID)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetTermHolidays(termID, holidays); err != nil {
+			return err
+		}
+		after, err := tx.ListHolidays(termID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditTerm, termID, AuditUpdate, snapshot(map[string]any{"holidays": before}), snapshot(map[string]any{"holidays": after}))
+	})
+}
+
+func (a *auditedStore) CreateOffering(offering *CourseOffering) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreateOffering(offering); err != nil {
+			return err
+		}
+		return a.record(tx, AuditOffering, offering.ID, AuditCreate, nil, snapshot(offering))
+	})
+}
+
+func (a *auditedStore) UpdateOffering(offering *CourseOffering) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetOffering(offering.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateOffering(offering); err != nil {
+			return err
+		}
+		return a.record(tx, AuditOffering, offering.ID, AuditUpdate, snapshot(before), snapshot(offering))
+	})
+}
+
+func (a *auditedStore) DeleteOffering(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetOffering(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteOffering(id); err != nil {
+			return err
+		}
+		return a.record(tx, AuditOffering, id, AuditDelete, snapshot(before), nil)
+	})
+}
+
+// SetOfferingMeetings records the change as an update of the offering.
+func (a *auditedStore) SetOfferingMeetings(offeringID int, meetings []Meeting) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := meetingSnapshot(tx, offeringID)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetOfferingMeetings(offeringID, meetings); err != nil {
+			return err
+		}
+		after, err := meetingSnapshot(tx, offeringID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditOffering, offeringID, AuditUpdate, before, after)
+	})
+}
+
+/*
+Departments and programs.
+*/
+
+func (a *auditedStore) CreateDepartment(department *Department) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreateDepartment(department); err != nil {
+			return err
+		}
+		return a.record(tx, AuditDepartment, department.ID, AuditCreate, nil, snapshot(department))
+	})
+}
+
+func (a *auditedStore) UpdateDepartment(department *Department) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetDepartment(department.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateDepartment(department); err != nil {
+			return err
+		}
+		return a.record(tx, AuditDepartment, department.ID, AuditUpdate, snapshot(before), snapshot(department))
+	})
+}
+
+func (a *auditedStore) DeleteDepartment(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetDepartment(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteDepartment(id); err != nil {
+			return err
+		}
+		return a.record(tx, AuditDepartment, id, AuditDelete, snapshot(before), nil)
+	})
+}
+
+func (a *auditedStore) CreateProgram(program *Program) error {
+	return a.Store.Transaction(func(tx Store) error {
+		if err := tx.CreateProgram(program); err != nil {
+			return err
+		}
+		return a.record(tx, AuditProgram, program.ID, AuditCreate, nil, snapshot(program))
+	})
+}
+
+func (a *auditedStore) UpdateProgram(program *Program) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetProgram(program.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateProgram(program); err != nil {
+			return err
+		}
+		return a.record(tx, AuditProgram, program.ID, AuditUpdate, snapshot(before), snapshot(program))
+	})
+}
+
+func (a *auditedStore) DeleteProgram(id int) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.GetProgram(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteProgram(id); err != nil {
+			return err
+		}
+		return a.record(tx, AuditProgram, id, AuditDelete, snapshot(before), nil)
+	})
+}
+
+// SetProgramRequirements records the change as an update of the program.
+func (a *auditedStore) SetProgramRequirements(programID int, requirements []Requirement) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := tx.ListRequirements(programID)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetProgramRequirements(programID, requirements); err != nil {
+			return err
+		}
+		after, err := tx.ListRequirements(programID)
+		if err != nil {
+			return err
+		}
+		return a.record(tx, AuditProgram, programID, AuditUpdate, snapshot(map[string]any{"requirements": before}), snapshot(map[string]any{"requirements": after}))
+	})
+}
+
+// AssignAdvisor records a change of advisor as an update of the student.
+func (a *auditedStore) AssignAdvisor(assignment *AdvisorAssignment) error {
+	return a.advisor(assignment.StudentID, func(tx Store) error {
+		return tx.AssignAdvisor(assignment)
+	})
+}
+
+// EndAdvisorAssignment records the end as an update of the student.
+func (a *auditedStore) EndAdvisorAssignment(studentID int) error {
+	return a.advisor(studentID, func(tx Store) error {
+		return tx.EndAdvisorAssignment(studentID)
+	})
+}
+
+// advisor runs fn and records an update of the student when it changed their
+// advisor.
+func (a *auditedStore) advisor(studentID int, fn func(tx Store) error) error {
+	return a.Store.Transaction(func(tx Store) error {
+		before, err := advisorSnapshot(tx, studentID)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		after, err := advisorSnapshot(tx, studentID)
+		if err != nil || reflect.DeepEqual(before, after) {
+			return err
+		}
+		return a.record(tx, AuditPerson, studentID, AuditUpdate, before, after)
+	})
+}
+
+/*
+Enrollments. They are recorded on the persons whose courses, offerings or
+waitlist entries they change, including the students a drop promotes.
+*/
+
+func (a *auditedStore) Enroll(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := a.enrollment(persons(e.PersonID), func(tx Store) error {
+		var err error
+		entry, err = tx.Enroll(e)
+		return err
+	})
+	return entry, err
+}
+
+func (a *auditedStore) Drop(courseID int, personID int) error {
+	affected := func(tx Store) ([]int, error) {
+		return waitlistedFor(tx, []int{personID}, []int{courseID})
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		return tx.Drop(courseID, personID)
+	})
+}
+
+func (a *auditedStore) SetCoursePersons(courseID int, personIDs []int) error {
+	affected := func(tx Store) ([]int, error) {
+		roster, err := tx.ListCoursePersons(courseID, "")
+		if err != nil {
+			return nil, err
+		}
+		ids := slices.Clone(personIDs)
+		for _, person := range roster {
+			ids = append(ids, person.ID)
+		}
+		return waitlistedFor(tx, ids, []int{courseID})
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		return tx.SetCoursePersons(courseID, personIDs)
+	})
+}
+
+func (a *auditedStore) SetPersonCourses(personID int, ids []int) error {
+	affected := func(tx Store) ([]int, error) {
+		current, err := tx.GetPerson(personID)
+		if err != nil {
+			return nil, err
+		}
+		return waitlistedFor(tx, []int{personID}, courseIDs(current.Courses))
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		return tx.SetPersonCourses(personID, ids)
+	})
+}
+
+func (a *auditedStore) EnrollOffering(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := a.enrollment(persons(e.PersonID), func(tx Store) error {
+		var err error
+		entry, err = tx.EnrollOffering(e)
+		return err
+	})
+	return entry, err
+}
+
+func (a *auditedStore) DropOffering(offeringID int, personID int) error {
+	affected := func(tx Store) ([]int, error) {
+		offering, err := tx.GetOffering(offeringID)
+		if err != nil {
+			return nil, err
+		}
+		return waitlistedFor(tx, []int{personID}, []int{offering.CourseID})
+	}
+	return a.enrollment(affected, func(tx Store) error {
+		return tx.DropOffering(offeringID, personID)
+	})
+}
+
+// SetGrade records an AuditGrade entry on the person with the reason for the
+// change. Its diff always names the offering.
+func (a *auditedStore) SetGrade(change GradeChange) (PersonCourse, error) {
+	var e PersonCourse
+	err := a.Store.Transaction(func(tx Store) error {
+		before, err := tx.ListEnrollments(EnrollmentFilter{PersonID: change.PersonID, OfferingID: change.OfferingID})
+		if err != nil {
+			return err
+		}
+		if e, err = tx.SetGrade(change); err != nil {
+			return err
+		}
+		var previous PersonCourse
+		if len(before) > 0 {
+			previous = before[0]
+		}
+		diff := diffSnapshots(gradeSnapshot(previous), gradeSnapshot(e))
+		diff.Before["offering_id"], diff.After["offering_id"] = float64(e.OfferingID), float64(e.OfferingID)
+		return tx.AppendAudit(&AuditEntry{
+			Actor:     a.actor,
+			Entity:    AuditPerson,
+			EntityID:  e.PersonID,
+			Operation: AuditGrade,
+			Diff:      diff,
+			Reason:    change.Reason,
+		})
+	})
+	return e, err
+}
+
+// enrollment runs fn and records an AuditEnrollment entry for each of the
+// persons returned by affected whose courses, offerings or waitlist entries
+// it changed.
+func (a *auditedStore) enrollment(affected func(tx Store) ([]int, error), fn func(tx Store) error) error {
+	return a.Store.Transaction(func(tx Store) error {
+		ids, err := affected(tx)
+		if err != nil {
+			return err
+		}
+		ids = uniqueIDs(ids)
+		before, err := personSnapshots(tx, ids)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		after, err := personSnapshots(tx, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if before[id] == nil || after[id] == nil || reflect.DeepEqual(before[id], after[id]) {
+				continue
+			}
+			if err := a.record(tx, AuditPerson, id, AuditEnrollment, before[id], after[id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Helpers.
+*/
+
+// record appends an entry holding the fields that differ between the before
+// and after snapshots of an entity.
+func (a *auditedStore) record(tx Store, entity string, id int, operation string, before, after map[string]any) error {
+	return tx.AppendAudit(&AuditEntry{
+		Actor:     a.actor,
+		Entity:    entity,
+		EntityID:  id,
+		Operation: operation,
+		Diff:      diffSnapshots(before, after),
+	})
+}
+
+// diffSnapshots keeps the fields that differ when both snapshots are set,
+// and a whole snapshot otherwise.
+func diffSnapshots(before, after map[string]any) AuditDiff {
+	if before == nil || after == nil {
+		return AuditDiff{Before: before, After: after}
+	}
+	diff := AuditDiff{Before: map[string]any{}, After: map[string]any{}}
+	for key, value := range before {
+		if !reflect.DeepEqual(value, after[key]) {
+			diff.Before[key] = value
+			diff.After[key] = after[key]
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			diff.Before[key] = nil
+			diff.After[key] = value
+		}
+	}
+	return diff
+}
+
+// persons lists fixed ids as the persons an enrollment affects.
+func persons(ids ...int) func(tx Store) ([]int, error) {
+	return func(tx Store) ([]int, error) {
+		return ids, nil
+	}
+}
+
+// waitlistedFor returns ids followed by the persons waitlisted for the
+// offerings of courses, whom a change that frees seats there promotes.
+func waitlistedFor(tx Store, ids []int, courseIDs []int) ([]int, error) {
+	ids = slices.Clone(ids)
+	for _, courseID := range uniqueIDs(courseIDs) {
+		offerings, _, err := tx.ListOfferings(OfferingFilter{CourseID: courseID}, Page{})
+		if err != nil {
+			return nil, err
+		}
+		for _, offering := range offerings {
+			entries, err := tx.ListWaitlist(offering.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				ids = append(ids, entry.PersonID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// personSnapshots returns the snapshots of the persons ids that exist.
+func personSnapshots(tx Store, ids []int) (map[int]map[string]any, error) {
+	snapshots := make(map[int]map[string]any, len(ids))
+	for _, id := range ids {
+		snapshot, err := personSnapshot(tx, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		snapshots[id] = snapshot
+	}
+	return snapshots, nil
+}
+
+// personSnapshot is the request representation of a person, plus the ids of
+// its offerings and of those it is waitlisted for, as a generic JSON object,
+// so snapshots compare like the documents clients send.
+func personSnapshot(tx Store, id int) (map[string]any, error) {
+	person, err := tx.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	offerings, err := tx.ListPersonOfferings(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := tx.ListPersonWaitlist(id)
+	if err != nil {
+		return nil, err
+	}
+	object := snapshot(person.JSON())
+	ids := make([]any, len(offerings))
+	for i, offering := range offerings {
+		ids[i] = float64(offering.ID)
+	}
+	object["offerings"] = ids
+	waitlist := make([]any, len(entries))
+	for i, entry := range entries {
+		waitlist[i] = float64(entry.OfferingID)
+	}
+	object["waitlist"] = waitlist
+	return object, nil
+}
+
+func prerequisiteSnapshot(tx Store, courseID int) (map[string]any, error) {
+	courses, err := tx.ListPrerequisites(courseID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]any, len(courses))
+	for i, course := range courses {
+		ids[i] = float64(course.ID)
+	}
+	return map[string]any{"prerequisites": ids}, nil
+}
+
+// meetingSnapshot lists the meetings of an offering without their ids, which
+// every replacement renews.
+func meetingSnapshot(tx Store, offeringID int) (map[string]any, error) {
+	meetings, err := tx.ListMeetings(MeetingFilter{OfferingIDs: []int{offeringID}})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]any, len(meetings))
+	for i, m := range meetings {
+		m.ID = 0
+		list[i] = snapshot(m)
+	}
+	return map[string]any{"meetings": list}, nil
+}
+
+// advisorSnapshot holds the current advisor of a student, or null.
+func advisorSnapshot(tx Store, studentID int) (map[string]any, error) {
+	current, err := tx.ListAdvisorAssignments(AdvisorFilter{StudentID: studentID, Current: true})
+	if err != nil {
+		return nil, err
+	}
+	var advisorID *int
+	if len(current) > 0 {
+		advisorID = &current[0].AdvisorID
+	}
+	return snapshot(map[string]any{"advisor_id": advisorID}), nil
+}
+
+// courseSnapshot leaves out the enrollment summary, which enrollments change
+// without writing the course.
+func courseSnapshot(course Course) map[string]any {
+	object := snapshot(course)
+	delete(object, "instructors")
+	delete(object, "student_count")
+	return object
+}
+
+func gradeSnapshot(e PersonCourse) map[string]any {
+	object := map[string]any{"grade": nil, "grade_points": nil}
+	if e.Grade != nil {
+		object["grade"] = *e.Grade
+	}
+	if e.GradePoints != nil {
+		object["grade_points"] = *e.GradePoints
+	}
+	return object
+}
+
+func snapshot(v any) map[string]any {
+	data, _ := json.Marshal(v)
+	var object map[string]any
+	_ = json.Unmarshal(data, &object)
+	return object
+}
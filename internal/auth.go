@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Authentication: the admin bearer token and /api/person/{id}/access-token.
+
+Admins authenticate with the token the server is configured with. Persons
+authenticate with an access token an admin issues them, which instructors
+use to grade their offerings; issuing a new one revokes the previous one.
+*/
+
+// AdminActor is the audit actor of changes authenticated with the admin
+// token.
+const AdminActor = "admin"
+
+// requireAdmin checks that the request carries the admin bearer token. It
+// writes a 401 when the request has no bearer token and a 403 when the token
+// is not the admin one, or no admin token is configured.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := bearerToken(r); !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		WriteProblem(w, http.StatusUnauthorized, CodeUnauthorized, "This request requires the admin bearer token.")
+		return false
+	}
+	if !s.isAdmin(r) {
+		WriteProblem(w, http.StatusForbidden, CodeForbidden, "The bearer token does not grant admin access.")
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the request carries the admin bearer token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	token, ok := bearerToken(r)
+	return ok && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// authenticatedPerson returns the person whose access token the request
+// carries as its bearer token. It writes a 401 when the request has no bearer
+// token and a 403 when the token is not the current one of a person.
+func (s *Server) authenticatedPerson(w http.ResponseWriter, r *http.Request) (Person, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		WriteProblem(w, http.StatusUnauthorized, CodeUnauthorized, "This request requires an access token or the admin bearer token.")
+		return Person{}, false
+	}
+	stored, err := s.store.FindAccessToken(hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusForbidden, CodeForbidden, "The bearer token is not an access token.")
+		return Person{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Person{}, false
+	}
+	person, err := s.store.GetPerson(stored.PersonID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The person was deleted since the token was issued.
+		WriteProblem(w, http.StatusForbidden, CodeForbidden, "The bearer token is not an access token.")
+		return Person{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Person{}, false
+	}
+	return person, true
+}
+
+// IssueAccessToken creates a new access token for a person, replacing any
+// previous one. The token is only shown here.
+func (s *Server) IssueAccessToken(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	row := AccessToken{PersonID: person.ID, TokenHash: hashToken(token)}
+	if err := s.audited(r).SetAccessToken(&row); err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]any{
+		"person_id":  person.ID,
+		"token":      token,
+		"created_at": row.CreatedAt,
+	})
+}
+
+// personActor is the audit actor of changes authenticated with the access
+// token of a person.
+func personActor(personID int) string {
+	return fmt.Sprintf("person:%d", personID)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashToken is the form tokens are stored in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
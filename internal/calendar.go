@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Calendar feeds: /api/person/{id}/schedule.ics and
+/api/person/{id}/calendar-token.
+
+The feed is an RFC 5545 calendar with one weekly recurring event per meeting
+of the offerings a person is enrolled in. Each event repeats from the first
+meeting day of the term to its end date and skips the holidays of the term.
+Times are floating: calendar clients show them as the local time they are.
+
+Calendar clients cannot log in, so the feed is read with a per-person token
+in the query string. Admins issue the token; issuing a new one revokes the
+previous one. Admins can also read any feed with their bearer token.
+*/
+
+const (
+	CalendarContentType = "text/calendar; charset=utf-8"
+
+	icsDateTime = "20060102T150405"
+)
+
+// IssueCalendarToken creates a new calendar token for a person, replacing
+// any previous one, and returns it with the feed URL. The token is only
+// shown here.
+func (s *Server) IssueCalendarToken(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	row := CalendarToken{PersonID: person.ID, TokenHash: hashToken(token)}
+	if err := s.audited(r).SetCalendarToken(&row); err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]any{
+		"person_id":  person.ID,
+		"token":      token,
+		"url":        fmt.Sprintf("/api/person/%d/schedule.ics?token=%v", person.ID, token),
+		"created_at": row.CreatedAt,
+	})
+}
+
+// GetPersonCalendar writes the schedule feed of a person.
+func (s *Server) GetPersonCalendar(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if !s.isAdmin(r) && !s.checkCalendarToken(w, r, person.ID) {
+		return
+	}
+
+	events, err := calendarEvents(s.store, person.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if notModified(w, r, entityTag(events)) {
+		return
+	}
+	w.Header().Set("Content-Type", CalendarContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="schedule-%d.ics"`, person.ID))
+	writeCalendar(w, fmt.Sprintf("%v %v", person.FirstName, person.LastName), r.Host, events)
+}
+
+// checkCalendarToken writes a 401 when the request has no token query
+// parameter and a 403 when it is not the current token of the person.
+func (s *Server) checkCalendarToken(w http.ResponseWriter, r *http.Request, personID int) bool {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		WriteProblem(w, http.StatusUnauthorized, CodeUnauthorized, "This feed requires the calendar token of the person.")
+		return false
+	}
+	stored, err := s.store.GetCalendarToken(personID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(stored.TokenHash)) != 1 {
+		WriteProblem(w, http.StatusForbidden, CodeForbidden, "The token does not grant access to the calendar of person with id '%v'.", personID)
+		return false
+	}
+	return true
+}
+
+// calendarEvent is one weekly recurring meeting.
+type calendarEvent struct {
+	MeetingID int
+	Summary   string
+	Location  string
+	Role      string
+	Start     time.Time
+	End       time.Time
+	Until     time.Time
+	Skipped   []time.Time
+}
+
+// calendarEvents returns the events of the schedule of a person. Meetings
+// whose day does not occur in their term are left out.
+func calendarEvents(store Store, personID int) ([]calendarEvent, error) {
+	schedule, err := buildSchedule(store, personID, MeetingFilter{})
+	if err != nil {
+		return nil, err
+	}
+	terms := map[int]Term{}
+	holidays := map[int][]Holiday{}
+	var events []calendarEvent
+	for _, entry := range schedule {
+		term, ok := terms[entry.TermID]
+		if !ok {
+			if term, err = store.GetTerm(entry.TermID); err != nil {
+				return nil, err
+			}
+			if holidays[term.ID], err = store.ListHolidays(term.ID); err != nil {
+				return nil, err
+			}
+			terms[term.ID] = term
+		}
+
+		first := term.StartDate.Time
+		for first.Weekday() != weekday(entry.Day) {
+			first = first.AddDate(0, 0, 1)
+		}
+		if first.After(term.EndDate.Time) {
+			continue
+		}
+		event := calendarEvent{
+			MeetingID: entry.ID,
+			Summary:   fmt.Sprintf("%v (%v)", entry.CourseName, entry.Section),
+			Location:  entry.Room,
+			Role:      entry.Role,
+			Start:     atClock(first, entry.StartTime),
+			End:       atClock(first, entry.EndTime),
+			Until:     term.EndDate.Add(24*time.Hour - time.Second),
+		}
+		for _, holiday := range holidays[term.ID] {
+			if holiday.Date.Weekday() == first.Weekday() && !holiday.Date.Before(first) && !holiday.Date.After(term.EndDate.Time) {
+				event.Skipped = append(event.Skipped, atClock(holiday.Date.Time, entry.StartTime))
+			}
+		}
+		events = append(events, event)
+	}
+	slices.SortStableFunc(events, func(a, b calendarEvent) int { return a.Start.Compare(b.Start) })
+	return events, nil
+}
+
+func weekday(day string) time.Weekday {
+	return time.Weekday((slices.Index(Weekdays, day) + 1) % 7)
+}
+
+func atClock(day time.Time, clock ClockTime) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(clock), 0, 0, time.UTC)
+}
+
+// writeCalendar writes events as an iCalendar object.
+func writeCalendar(w http.ResponseWriter, name string, host string, events []calendarEvent) {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Go-API-Tech-Challenge//Schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%v", escapeICSText("Schedule of "+name))
+	stamp := time.Now().UTC().Format(icsDateTime) + "Z"
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:meeting-%d@%v", event.MeetingID, host)
+		line("DTSTAMP:%v", stamp)
+		line("DTSTART:%v", event.Start.Format(icsDateTime))
+		line("DTEND:%v", event.End.Format(icsDateTime))
+		line("RRULE:FREQ=WEEKLY;UNTIL=%v", event.Until.Format(icsDateTime))
+		if len(event.Skipped) > 0 {
+			dates := make([]string, len(event.Skipped))
+			for i, skipped := range event.Skipped {
+				dates[i] = skipped.Format(icsDateTime)
+			}
+			line("EXDATE:%v", strings.Join(dates, ","))
+		}
+		line("SUMMARY:%v", escapeICSText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION:%v", escapeICSText(event.Location))
+		}
+		line("DESCRIPTION:%v", escapeICSText("Role: "+event.Role))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// escapeICSText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// foldICSLine ends a content line with CRLF, folding it into lines of at
+// most 75 octets without splitting characters (RFC 5545 section 3.1).
+func foldICSLine(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space, which counts.
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -4,41 +4,71 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/render"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-func GetCourses(w http.ResponseWriter, r *http.Request) {
-	var courses []Course
-	DB.Find(&courses)
+func (s *Server) GetCourses(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, CourseSortColumns)
+	if !ok {
+		return
+	}
+	store, ok := s.readStore(w, r)
+	if !ok {
+		return
+	}
+	format, ok := listFormat(w, r)
+	if !ok {
+		return
+	}
+
+	filter := CourseFilter{Department: strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("department")))}
+	if format == CSVMediaType {
+		exportCourses(w, r, store, filter, page)
+		return
+	}
+	courses, total, err := store.ListCourses(filter, page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	courses = writePage(w, r, page, courses, total)
+	if courses == nil {
+		courses = []Course{}
+	}
 	render.JSON(w, r, courses)
 }
 
-func GetCourse(w http.ResponseWriter, r *http.Request) {
-	id, err := ParseIntParam(w, r, "id")
-	if err != nil {
+func (s *Server) GetCourse(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.readStore(w, r)
+	if !ok {
 		return
 	}
-	course := Course{ID: id}
-	err = DB.First(&course).Error
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Course with id '%v' not found.", id), http.StatusNotFound)
+	course, ok := s.findCourse(w, r, store)
+	if !ok {
+		return
+	}
+	if notModified(w, r, course.ETag()) {
 		return
 	}
 	render.JSON(w, r, course)
 }
 
-func CreateCourse(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateCourse(w http.ResponseWriter, r *http.Request) {
 	var newCourse Course
-	if err = CheckJSON(w, r, &newCourse); err != nil {
+	if err := CheckJSON(w, r, &newCourse); err != nil {
+		return
+	}
+	if !s.validateCourse(w, newCourse) {
 		return
 	}
 
-	err = DB.Create(&newCourse).Error
+	err := s.audited(r).CreateCourse(&newCourse)
 	if errors.Is(err, gorm.ErrDuplicatedKey) {
-		http.Error(w, fmt.Sprintf("JSON id '%v' conflicts with existing course data.", newCourse.ID), http.StatusConflict)
+		WriteProblem(w, http.StatusConflict, CodeConflict, "JSON id '%v' conflicts with existing course data.", newCourse.ID)
 		return
 	} else if err != nil {
 		HandleDBErrorGeneric(w, err)
@@ -51,63 +81,135 @@ func CreateCourse(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, output)
 }
 
-func UpdateCourse(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateCourse(w http.ResponseWriter, r *http.Request) {
 	var newCourse Course
-	if err = CheckJSON(w, r, &newCourse); err != nil {
+	if err := CheckJSON(w, r, &newCourse); err != nil {
 		return
 	}
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+	s.updateCourse(w, r, course, newCourse)
+}
 
-	id, err := ParseIntParam(w, r, "id")
-	if err != nil {
+func (s *Server) PatchCourse(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	var newCourse Course
+	if !readPatch(w, r, course, &newCourse) {
 		return
 	}
+	s.updateCourse(w, r, course, newCourse)
+}
 
-	course := Course{ID: id}
-	if err = DB.First(&course).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Course with id '%v' not found.", id), http.StatusNotFound)
+func (s *Server) updateCourse(w http.ResponseWriter, r *http.Request, course Course, newCourse Course) {
+	resource := fmt.Sprintf("course '%v'", course.ID)
+	if !checkIfMatch(w, r, course.ETag(), resource) {
 		return
 	}
 
-	newCourse.ID = id
-	if err = DB.Updates(newCourse).Error; err != nil {
+	newCourse.ID = course.ID
+	newCourse.Version = expectedVersion(r, course.Version)
+	if !s.validateCourse(w, newCourse) {
+		return
+	}
+	if err := s.audited(r).UpdateCourse(&newCourse); errors.Is(err, ErrVersionConflict) {
+		writeVersionConflict(w, resource)
+		return
+	} else if err != nil {
 		HandleDBErrorGeneric(w, err)
 		return
 	}
+	w.Header().Set("ETag", newCourse.ETag())
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, newCourse)
 }
 
-func DeleteCourse(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteCourse(w http.ResponseWriter, r *http.Request) {
 	id, err := ParseIntParam(w, r, "id")
 	if err != nil {
 		return
 	}
 
-	course := Course{ID: id}
+	course, err := s.store.GetCourse(id)
+	if err == nil {
+		if !checkIfMatch(w, r, course.ETag(), fmt.Sprintf("course '%v'", id)) {
+			return
+		}
+		err = s.audited(r).DeleteCourse(id, expectedVersion(r, course.Version))
+	}
 
 	var msg string
-	if course, err = LoadCourse(DB, &course); errors.Is(err, logger.ErrRecordNotFound) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		msg = fmt.Sprintf("No course found with id '%v'", id)
 		// render.Status(r, http.StatusNoContent)
+	} else if errors.Is(err, ErrVersionConflict) {
+		writeVersionConflict(w, fmt.Sprintf("course '%v'", id))
+		return
 	} else if err != nil {
 		HandleDBErrorGeneric(w, err)
 		return
 	} else {
-		if len(course.Persons) > 0 {
-			if err = DB.Model(&course).Association("Persons").Delete(course.Persons); err != nil {
-				HandleDBErrorGeneric(w, err)
-				return
-			}
-		}
-
-		if err := DB.Delete(&course).Error; err != nil {
-			HandleDBErrorGeneric(w, err)
-			return
-		}
-
 		msg = "Deletion Successful."
 	}
 
 	output := map[string]string{"message": msg}
 	render.JSON(w, r, output)
 }
+
+// findCourse loads the course identified by the {id} URL parameter from
+// store, writing a 404 when it does not exist.
+func (s *Server) findCourse(w http.ResponseWriter, r *http.Request, store Store) (Course, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return Course{}, false
+	}
+
+	course, err := store.GetCourse(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Course with id '%v' not found.", id)
+		return Course{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Course{}, false
+	}
+	return course, true
+}
+
+// validateCourse checks the validate rules of course, that its department
+// exists and that no other course of the department has its number, writing
+// a 400 listing all violations.
+func (s *Server) validateCourse(w http.ResponseWriter, course Course) bool {
+	errs := Validate(course)
+	if course.DepartmentID == nil {
+		if course.Number != "" {
+			errs = append(errs, FieldError{Field: "number", Code: "required_with", Message: "Requires department_id."})
+		}
+		return writeValidationProblem(w, errs)
+	}
+
+	department, err := s.store.GetDepartment(*course.DepartmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		errs = append(errs, FieldError{Field: "department_id", Code: "exists", Message: fmt.Sprintf("Department with id '%v' does not exist.", *course.DepartmentID)})
+		return writeValidationProblem(w, errs)
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+	if course.Number != "" {
+		// Deleted courses keep their number.
+		courses, _, err := s.store.WithDeleted().ListCourses(CourseFilter{Department: department.Code}, Page{})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+		if slices.ContainsFunc(courses, func(other Course) bool { return other.ID != course.ID && other.Number == course.Number }) {
+			errs = append(errs, FieldError{Field: "number", Code: "unique", Message: fmt.Sprintf("Course '%v' already exists.", courseCode(department.Code, course.Number))})
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
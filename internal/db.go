@@ -12,8 +12,6 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
-
 func InitDB() (*gorm.DB, error) {
 	DATABASE_HOST := os.Getenv("DATABASE_HOST")
 	DATABASE_PORT, _ := strconv.ParseInt(os.Getenv("DATABASE_PORT"), 10, 0)
@@ -33,9 +31,37 @@ func InitDB() (*gorm.DB, error) {
 			Colorful:                  true,          // Disable color
 		},
 	)
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger:         dbLogger,
 		TranslateError: true,
 	})
-	return DB, err
+}
+
+// MigrateOnStart prepares the schema before the server starts. Pending
+// migrations are applied when autoMigrate is set; otherwise they are reported
+// as an error. Drift between the database and the embedded migrations is
+// always an error.
+func MigrateOnStart(db *gorm.DB, autoMigrate bool) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	if err = migrator.Check(); err != nil {
+		return err
+	}
+	if !autoMigrate {
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations; run 'migrate up' or set DATABASE_AUTO_MIGRATE=true", len(pending))
+		}
+		return nil
+	}
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		Outf("Applied migration %04d_%v", migration.Version, migration.Name)
+	}
+	return err
 }
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+/*
+Degree audits: /api/person/{id}/degree-audit.
+
+An audit checks the transcript of a student against the requirements of
+their major. Courses graded P or with grade points above zero are completed,
+and ungraded or incomplete ones in progress; failed and withdrawn attempts
+do not count. The best attempt at each course counts, toward every
+requirement that lists it.
+
+A requirement is satisfied by completed courses alone, and pending when the
+courses in progress would satisfy it once completed. GPA requirements are
+pending while nothing is graded yet but courses are in progress.
+*/
+
+// GetPersonDegreeAudit evaluates a student against the requirements of their
+// major. Only students with a major have one.
+func (s *Server) GetPersonDegreeAudit(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if person.Type != "student" {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' is not a student, so they have no degree audit.", person.ID)
+		return
+	}
+	if person.MajorID == nil {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' has not declared a major, so they have no degree audit.", person.ID)
+		return
+	}
+
+	audit, err := buildDegreeAudit(s.store, person.ID, *person.MajorID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, audit)
+}
+
+// buildDegreeAudit evaluates each requirement of the program against the
+// courses the person completed or is taking.
+func buildDegreeAudit(store Store, personID int, programID int) (DegreeAudit, error) {
+	transcript, err := buildTranscript(store, personID)
+	if err != nil {
+		return DegreeAudit{}, err
+	}
+	requirements, err := store.ListRequirements(programID)
+	if err != nil {
+		return DegreeAudit{}, err
+	}
+
+	// taken holds the best attempt at each course, in the order the courses
+	// were first taken.
+	taken := map[int]DegreeAuditCourse{}
+	var order []int
+	for _, term := range transcript.Terms {
+		for _, course := range term.Courses {
+			status := courseProgress(course.Grade)
+			if status == "" {
+				continue
+			}
+			current, ok := taken[course.CourseID]
+			if ok && current.Status == ProgressCompleted {
+				continue
+			} else if !ok {
+				order = append(order, course.CourseID)
+			}
+			taken[course.CourseID] = DegreeAuditCourse{
+				CourseID:    course.CourseID,
+				Name:        course.Name,
+				CreditHours: course.CreditHours,
+				Grade:       course.Grade,
+				Status:      status,
+			}
+		}
+	}
+
+	audit := DegreeAudit{
+		PersonID:    personID,
+		ProgramID:   programID,
+		GPA:         transcript.GPA,
+		Satisfied:   []RequirementAudit{},
+		Unsatisfied: []RequirementAudit{},
+	}
+	courses := make([]DegreeAuditCourse, len(order))
+	for i, id := range order {
+		course, err := store.GetCourse(id)
+		if err != nil {
+			return DegreeAudit{}, err
+		}
+		entry := taken[id]
+		entry.Code = course.Code
+		taken[id], courses[i] = entry, entry
+		if entry.Status == ProgressCompleted {
+			audit.CompletedCredits += entry.CreditHours
+		} else {
+			audit.InProgressCredits += entry.CreditHours
+		}
+	}
+
+	for _, requirement := range requirements {
+		result := auditRequirement(requirement, taken, courses, transcript.GPA)
+		if result.Status == ProgressSatisfied {
+			audit.Satisfied = append(audit.Satisfied, result)
+		} else {
+			audit.Unsatisfied = append(audit.Unsatisfied, result)
+		}
+	}
+	audit.Complete = len(audit.Unsatisfied) == 0
+	return audit, nil
+}
+
+// auditRequirement evaluates one requirement. taken holds the courses the
+// student completed or is taking, and courses the same in the order taken.
+func auditRequirement(requirement Requirement, taken map[int]DegreeAuditCourse, courses []DegreeAuditCourse, gpa *float64) RequirementAudit {
+	result := RequirementAudit{Requirement: requirement, Courses: []DegreeAuditCourse{}}
+	var completed, inProgress int
+	switch requirement.Kind {
+	case RequirementCourses, RequirementElectives:
+		for _, id := range requirement.CourseIDs {
+			course, ok := taken[id]
+			if !ok {
+				result.Remaining = append(result.Remaining, id)
+				continue
+			}
+			result.Courses = append(result.Courses, course)
+			if course.Status == ProgressCompleted {
+				completed++
+			} else {
+				inProgress++
+			}
+		}
+		need := len(requirement.CourseIDs)
+		if requirement.Kind == RequirementElectives {
+			need = requirement.Choose
+		}
+		result.Status = requirementProgress(completed >= need, completed+inProgress >= need)
+	case RequirementCredits:
+		for _, course := range courses {
+			result.Courses = append(result.Courses, course)
+			if course.Status == ProgressCompleted {
+				completed += course.CreditHours
+			} else {
+				inProgress += course.CreditHours
+			}
+		}
+		result.Status = requirementProgress(completed >= requirement.MinCredits, completed+inProgress >= requirement.MinCredits)
+	case RequirementGPA:
+		for _, course := range courses {
+			if course.Grade != nil && GradePoints(*course.Grade) != nil {
+				result.Courses = append(result.Courses, course)
+			} else if course.Status == ProgressInProgress {
+				inProgress++
+			}
+		}
+		met := gpa != nil && requirement.MinGPA != nil && *gpa >= *requirement.MinGPA
+		result.Status = requirementProgress(met, met || gpa == nil && inProgress > 0)
+	}
+	if result.Status == ProgressSatisfied {
+		result.Remaining = nil
+	}
+	return result
+}
+
+// courseProgress is the status of an attempt at a course with grade, or ""
+// when the attempt does not count.
+func courseProgress(grade *string) string {
+	switch {
+	case grade == nil || *grade == "I":
+		return ProgressInProgress
+	case *grade == "P":
+		return ProgressCompleted
+	}
+	if points := GradePoints(*grade); points != nil && *points > 0 {
+		return ProgressCompleted
+	}
+	return ""
+}
+
+func requirementProgress(satisfied bool, pending bool) string {
+	switch {
+	case satisfied:
+		return ProgressSatisfied
+	case pending:
+		return ProgressPending
+	default:
+		return ProgressUnsatisfied
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Soft-deleted persons and courses: the admin include_deleted view and the
+restore endpoints.
+*/
+
+// readStore returns the store a read should use. With include_deleted=true,
+// which is reserved to admins, it is a view that includes soft-deleted rows.
+func (s *Server) readStore(w http.ResponseWriter, r *http.Request) (Store, bool) {
+	val := r.URL.Query().Get("include_deleted")
+	if val == "" {
+		return s.store, true
+	}
+	include, err := strconv.ParseBool(val)
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid include_deleted '%v' on query parameter. Must be true or false.", val)
+		return nil, false
+	}
+	if !include {
+		return s.store, true
+	}
+	if !s.requireAdmin(w, r) {
+		return nil, false
+	}
+	return s.store.WithDeleted(), true
+}
+
+// RestorePerson undeletes a soft-deleted person together with its
+// enrollments. Like the view of deleted rows, it is reserved to admins.
+func (s *Server) RestorePerson(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	person, ok := s.findPersonByID(w, r, s.store.WithDeleted())
+	if !ok {
+		return
+	}
+	if !person.DeletedAt.Valid {
+		WriteProblem(w, http.StatusConflict, CodeNotDeleted, "Person with id '%v' is not deleted.", person.ID)
+		return
+	}
+
+	if err := s.audited(r).RestorePerson(person.ID); errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusConflict, CodeNotDeleted, "Person with id '%v' is not deleted.", person.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+
+	s.GetPersonByID(w, r)
+}
+
+// RestoreCourse undeletes a soft-deleted course. Its enrollments come back
+// with it. It is reserved to admins.
+func (s *Server) RestoreCourse(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	course, ok := s.findCourse(w, r, s.store.WithDeleted())
+	if !ok {
+		return
+	}
+	if !course.DeletedAt.Valid {
+		WriteProblem(w, http.StatusConflict, CodeNotDeleted, "Course with id '%v' is not deleted.", course.ID)
+		return
+	}
+
+	if err := s.audited(r).RestoreCourse(course.ID); errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusConflict, CodeNotDeleted, "Course with id '%v' is not deleted.", course.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+
+	course, ok = s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", course.ETag())
+	render.JSON(w, r, course)
+}
@@ -0,0 +1,395 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var (
+	DepartmentSortColumns = []string{"id", "code", "name"}
+	ProgramSortColumns    = []string{"id", "code", "name"}
+)
+
+// programFilterParams are the query parameters accepted by GET /api/program,
+// in addition to the pagination parameters.
+var programFilterParams = []string{"department_id"}
+
+/*
+Departments: /api/department
+*/
+
+func (s *Server) GetDepartments(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, DepartmentSortColumns)
+	if !ok {
+		return
+	}
+
+	departments, total, err := s.store.ListDepartments(page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	departments = writePage(w, r, page, departments, total)
+	if departments == nil {
+		departments = []Department{}
+	}
+	render.JSON(w, r, departments)
+}
+
+func (s *Server) GetDepartment(w http.ResponseWriter, r *http.Request) {
+	department, ok := s.findDepartment(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, department)
+}
+
+func (s *Server) CreateDepartment(w http.ResponseWriter, r *http.Request) {
+	var newDepartment Department
+	if err := CheckJSON(w, r, &newDepartment); err != nil {
+		return
+	}
+	if !s.validateDepartment(w, newDepartment) {
+		return
+	}
+
+	if err := s.audited(r).CreateDepartment(&newDepartment); err != nil {
+		handleDepartmentWriteError(w, newDepartment, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]int{"id": newDepartment.ID})
+}
+
+func (s *Server) UpdateDepartment(w http.ResponseWriter, r *http.Request) {
+	var newDepartment Department
+	if err := CheckJSON(w, r, &newDepartment); err != nil {
+		return
+	}
+	department, ok := s.findDepartment(w, r)
+	if !ok {
+		return
+	}
+	if !s.validateDepartment(w, newDepartment) {
+		return
+	}
+
+	newDepartment.ID = department.ID
+	if err := s.audited(r).UpdateDepartment(&newDepartment); err != nil {
+		handleDepartmentWriteError(w, newDepartment, err)
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, newDepartment)
+}
+
+func (s *Server) DeleteDepartment(w http.ResponseWriter, r *http.Request) {
+	department, ok := s.findDepartment(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.audited(r).DeleteDepartment(department.ID)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Department with id '%v' still has programs, courses or professors.", department.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Deletion Successful."})
+}
+
+// findDepartment loads the department identified by the {id} URL parameter,
+// writing a 404 when it does not exist.
+func (s *Server) findDepartment(w http.ResponseWriter, r *http.Request) (Department, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return Department{}, false
+	}
+
+	department, err := s.store.GetDepartment(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Department with id '%v' not found.", id)
+		return Department{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Department{}, false
+	}
+	return department, true
+}
+
+// validateDepartment checks the validate rules of department, the format of
+// its code and that its chair is a professor, writing a 400 listing all
+// violations.
+func (s *Server) validateDepartment(w http.ResponseWriter, department Department) bool {
+	errs := Validate(department)
+	if department.Code != "" && !departmentCodePattern.MatchString(department.Code) {
+		errs = append(errs, FieldError{Field: "code", Code: "pattern", Message: "Must be 2 to 6 uppercase letters."})
+	}
+	if department.ChairID != nil {
+		chair, err := s.store.GetPerson(*department.ChairID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs = append(errs, FieldError{Field: "chair_id", Code: "exists", Message: fmt.Sprintf("Person with id '%v' does not exist.", *department.ChairID)})
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		} else if chair.Type != "professor" {
+			errs = append(errs, FieldError{Field: "chair_id", Code: "type", Message: fmt.Sprintf("Person with id '%v' is not a professor.", chair.ID)})
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
+
+func handleDepartmentWriteError(w http.ResponseWriter, department Department, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "A department with code '%v' already exists.", department.Code)
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
+
+/*
+Programs: /api/program
+*/
+
+func (s *Server) GetPrograms(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, ProgramSortColumns)
+	if !ok {
+		return
+	}
+	for key := range r.URL.Query() {
+		if !slices.Contains(programFilterParams, key) && !slices.Contains(pageParams, key) {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return
+		}
+	}
+	departmentID, ok := parseOptionalInt(w, r, "department_id")
+	if !ok {
+		return
+	}
+	var filter ProgramFilter
+	if departmentID != nil {
+		filter.DepartmentID = *departmentID
+	}
+
+	programs, total, err := s.store.ListPrograms(filter, page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	programs = writePage(w, r, page, programs, total)
+	if programs == nil {
+		programs = []Program{}
+	}
+	render.JSON(w, r, programs)
+}
+
+func (s *Server) GetProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := s.findProgram(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, program)
+}
+
+func (s *Server) CreateProgram(w http.ResponseWriter, r *http.Request) {
+	var newProgram Program
+	if err := CheckJSON(w, r, &newProgram); err != nil {
+		return
+	}
+	if !s.validateProgram(w, newProgram) {
+		return
+	}
+
+	if err := s.audited(r).CreateProgram(&newProgram); err != nil {
+		handleProgramWriteError(w, newProgram, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]int{"id": newProgram.ID})
+}
+
+func (s *Server) UpdateProgram(w http.ResponseWriter, r *http.Request) {
+	var newProgram Program
+	if err := CheckJSON(w, r, &newProgram); err != nil {
+		return
+	}
+	program, ok := s.findProgram(w, r)
+	if !ok {
+		return
+	}
+	if !s.validateProgram(w, newProgram) {
+		return
+	}
+
+	newProgram.ID = program.ID
+	if err := s.audited(r).UpdateProgram(&newProgram); err != nil {
+		handleProgramWriteError(w, newProgram, err)
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, newProgram)
+}
+
+func (s *Server) DeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := s.findProgram(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.audited(r).DeleteProgram(program.ID)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Program with id '%v' is still the major of students.", program.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Deletion Successful."})
+}
+
+func (s *Server) GetProgramRequirements(w http.ResponseWriter, r *http.Request) {
+	program, ok := s.findProgram(w, r)
+	if !ok {
+		return
+	}
+
+	requirements, err := s.store.ListRequirements(program.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if requirements == nil {
+		requirements = []Requirement{}
+	}
+	render.JSON(w, r, requirements)
+}
+
+// ReplaceProgramRequirements replaces the rules degree audits check the
+// students of a program against.
+func (s *Server) ReplaceProgramRequirements(w http.ResponseWriter, r *http.Request) {
+	var req RequirementsRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	program, ok := s.findProgram(w, r)
+	if !ok {
+		return
+	}
+	if !s.validateRequirements(w, req.Requirements) {
+		return
+	}
+
+	requirements := slices.Clone(req.Requirements)
+	if requirements == nil {
+		requirements = []Requirement{}
+	}
+	if err := s.audited(r).SetProgramRequirements(program.ID, requirements); err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	requirements, err := s.store.ListRequirements(program.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, requirements)
+}
+
+// findProgram loads the program identified by the {id} URL parameter,
+// writing a 404 when it does not exist.
+func (s *Server) findProgram(w http.ResponseWriter, r *http.Request) (Program, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return Program{}, false
+	}
+
+	program, err := s.store.GetProgram(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Program with id '%v' not found.", id)
+		return Program{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Program{}, false
+	}
+	return program, true
+}
+
+// validateProgram checks the validate rules of program and that its
+// department exists, writing a 400 listing all violations.
+func (s *Server) validateProgram(w http.ResponseWriter, program Program) bool {
+	errs := Validate(program)
+	if program.DepartmentID != 0 {
+		_, err := s.store.GetDepartment(program.DepartmentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs = append(errs, FieldError{Field: "department_id", Code: "exists", Message: fmt.Sprintf("Department with id '%v' does not exist.", program.DepartmentID)})
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
+
+// validateRequirements checks the validate rules of each requirement, that
+// it sets the fields of its kind and that the courses it lists exist, once
+// each, naming fields after their index in the request. It writes a 400
+// listing all violations.
+func (s *Server) validateRequirements(w http.ResponseWriter, requirements []Requirement) bool {
+	var errs []FieldError
+	for i, requirement := range requirements {
+		prefix := fmt.Sprintf("requirements[%d].", i)
+		for _, err := range Validate(requirement) {
+			err.Field = prefix + err.Field
+			errs = append(errs, err)
+		}
+
+		switch requirement.Kind {
+		case RequirementCourses, RequirementElectives:
+			if len(requirement.CourseIDs) == 0 {
+				errs = append(errs, FieldError{Field: prefix + "course_ids", Code: "required", Message: "Is required."})
+			} else if len(uniqueIDs(requirement.CourseIDs)) < len(requirement.CourseIDs) {
+				errs = append(errs, FieldError{Field: prefix + "course_ids", Code: "unique", Message: "Lists a course more than once."})
+			}
+			if requirement.Kind == RequirementElectives && (requirement.Choose < 1 || requirement.Choose > len(requirement.CourseIDs)) {
+				errs = append(errs, FieldError{Field: prefix + "choose", Code: "range", Message: fmt.Sprintf("Must be between 1 and the %d courses listed.", len(requirement.CourseIDs))})
+			}
+		case RequirementCredits:
+			if requirement.MinCredits < 1 {
+				errs = append(errs, FieldError{Field: prefix + "min_credits", Code: "min", Message: "Must be at least 1."})
+			}
+		case RequirementGPA:
+			if requirement.MinGPA == nil || *requirement.MinGPA < 0 || *requirement.MinGPA > 4 {
+				errs = append(errs, FieldError{Field: prefix + "min_gpa", Code: "range", Message: "Must be between 0 and 4."})
+			}
+		}
+
+		missing, err := s.store.MissingCourseIDs(requirement.CourseIDs)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+		for _, id := range missing {
+			errs = append(errs, FieldError{Field: prefix + "course_ids", Code: "exists", Message: fmt.Sprintf("Course with id '%v' does not exist.", id)})
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
+
+func handleProgramWriteError(w http.ResponseWriter, program Program, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "A program with code '%v' already exists.", program.Code)
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
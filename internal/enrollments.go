@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var (
+	errMissingReference = errors.New("referenced course or person does not exist")
+	errNotProfessor     = errors.New("instructor is not a professor")
+)
+
+/*
+Course roster: /api/course/{id}/persons
+*/
+
+func (s *Server) GetCoursePersons(w http.ResponseWriter, r *http.Request) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	personType := r.URL.Query().Get("type")
+	if personType != "" && !slices.Contains(PersonTypes, personType) {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid type '%v' on query parameter. Type must be either 'student' or 'professor'.", personType)
+		return
+	}
+	if !coursesExist(w, s.store, []int{id}) {
+		return
+	}
+
+	persons, err := s.store.ListCoursePersons(id, personType)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, NewPersonResponses(persons))
+}
+
+func (s *Server) EnrollCoursePerson(w http.ResponseWriter, r *http.Request) {
+	var req EnrollmentRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	s.enroll(w, r, PersonCourse{PersonID: req.PersonID, CourseID: id, Role: req.Role})
+}
+
+func (s *Server) ReplaceCoursePersons(w http.ResponseWriter, r *http.Request) {
+	var req RosterRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
+
+	err = s.audited(r).Transaction(func(tx Store) error {
+		if !coursesExist(w, tx, []int{id}) || !personsExist(w, tx, req.PersonIDs) {
+			return errMissingReference
+		}
+		if enforced && !checkPersonPrerequisites(w, tx, req.PersonIDs, []int{id}) {
+			return errMissingPrerequisites
+		}
+		filter := EnrollmentFilter{CourseID: id}
+		before, err := tx.ListEnrollments(filter)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		if err := tx.SetCoursePersons(id, req.PersonIDs); err != nil {
+			handleEnrollmentError(w, err)
+			return err
+		}
+		return checkAddedSchedules(w, tx, before, filter)
+	})
+	if err != nil {
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	s.GetCoursePersons(w, r)
+}
+
+func (s *Server) DropCoursePerson(w http.ResponseWriter, r *http.Request) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	personID, err := ParseIntParam(w, r, "personId")
+	if err != nil {
+		return
+	}
+	s.drop(w, r, id, personID)
+}
+
+/*
+Person schedule: /api/person/{id}/courses
+*/
+
+func (s *Server) GetPersonCourses(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	courses := person.Courses
+	if courses == nil {
+		courses = []Course{}
+	}
+	render.JSON(w, r, courses)
+}
+
+func (s *Server) EnrollPersonCourse(w http.ResponseWriter, r *http.Request) {
+	var req EnrollmentRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	s.enroll(w, r, PersonCourse{PersonID: id, CourseID: req.CourseID, Role: req.Role})
+}
+
+func (s *Server) ReplacePersonCourses(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
+
+	err = s.audited(r).Transaction(func(tx Store) error {
+		if !personsExist(w, tx, []int{id}) || !coursesExist(w, tx, req.CourseIDs) {
+			return errMissingReference
+		}
+		if enforced && !checkPersonPrerequisites(w, tx, []int{id}, req.CourseIDs) {
+			return errMissingPrerequisites
+		}
+		filter := EnrollmentFilter{PersonID: id}
+		before, err := tx.ListEnrollments(filter)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		if err := tx.SetPersonCourses(id, req.CourseIDs); err != nil {
+			handleEnrollmentError(w, err)
+			return err
+		}
+		return checkAddedSchedules(w, tx, before, filter)
+	})
+	if err != nil {
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	s.GetPersonCourses(w, r)
+}
+
+func (s *Server) DropPersonCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return
+	}
+	courseID, err := ParseIntParam(w, r, "courseId")
+	if err != nil {
+		return
+	}
+	s.drop(w, r, courseID, id)
+}
+
+/*
+Enrollment records, with role and time: /api/course/{id}/enrollments and
+/api/person/{id}/enrollments
+*/
+
+func (s *Server) GetCourseEnrollments(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+	s.listEnrollments(w, r, EnrollmentFilter{CourseID: course.ID})
+}
+
+func (s *Server) GetPersonEnrollments(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	s.listEnrollments(w, r, EnrollmentFilter{PersonID: person.ID})
+}
+
+// listEnrollments writes the enrollments matching filter, narrowed to one
+// role by the role query parameter.
+func (s *Server) listEnrollments(w http.ResponseWriter, r *http.Request, filter EnrollmentFilter) {
+	filter.Role = r.URL.Query().Get("role")
+	if filter.Role != "" && !slices.Contains(EnrollmentRoles, filter.Role) {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid role '%v' on query parameter. Must be one of %v.", filter.Role, strings.Join(EnrollmentRoles, ", "))
+		return
+	}
+
+	enrollments, err := s.store.ListEnrollments(filter)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if enrollments == nil {
+		enrollments = []PersonCourse{}
+	}
+	render.JSON(w, r, enrollments)
+}
+
+/*
+Shared enrollment operations.
+*/
+
+// enroll enrolls e.PersonID in the default offering of e.CourseID.
+func (s *Server) enroll(w http.ResponseWriter, r *http.Request, e PersonCourse) {
+	if !writeValidationProblem(w, validateRole(e.Role)) {
+		return
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
+
+	var entry *WaitlistEntry
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if !coursesExist(w, tx, []int{e.CourseID}) || !personsExist(w, tx, []int{e.PersonID}) {
+			return errMissingReference
+		}
+		if err := checkEnrollment(w, tx, &e, enforced); err != nil {
+			return err
+		}
+		var err error
+		if entry, err = tx.Enroll(&e); err != nil {
+			handleEnrollError(w, e, err)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+	writeEnrollment(w, r, e, entry)
+}
+
+func (s *Server) drop(w http.ResponseWriter, r *http.Request, courseID int, personID int) {
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if !coursesExist(w, tx, []int{courseID}) || !personsExist(w, tx, []int{personID}) {
+			return errMissingReference
+		}
+		err := tx.Drop(courseID, personID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			WriteProblem(w, http.StatusNotFound, CodeNotEnrolled, "Person with id '%v' is not enrolled in or waitlisted for course '%v'.", personID, courseID)
+			return err
+		} else if err != nil {
+			handleEnrollmentError(w, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	output := map[string]string{"message": "Enrollment removed."}
+	render.JSON(w, r, output)
+}
+
+// writeEnrollment writes a 201 with the enrollment e, or a 202 with the
+// waitlist entry when the person was waitlisted instead.
+func writeEnrollment(w http.ResponseWriter, r *http.Request, e PersonCourse, entry *WaitlistEntry) {
+	if entry != nil {
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, entry)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, e)
+}
+
+// validateRole checks the role of an enrollment request, which may be
+// omitted.
+func validateRole(role string) []FieldError {
+	if role != "" && !slices.Contains(EnrollmentRoles, role) {
+		return []FieldError{{Field: "role", Code: "oneof", Message: fmt.Sprintf("Must be one of '%v'.", strings.Join(EnrollmentRoles, "', '"))}}
+	}
+	return nil
+}
+
+// checkEnrollment defaults the role of e to the one of the person's type,
+// then writes a 422 and returns an error when it makes an instructor of a
+// person who is not a professor, or when enforced and a student lacks
+// prerequisites of the course. Schedule conflicts are written as a 409.
+func checkEnrollment(w http.ResponseWriter, tx Store, e *PersonCourse, enforced bool) error {
+	person, err := tx.GetPerson(e.PersonID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	if e.Role == "" {
+		e.Role = defaultRole(person.Type)
+	}
+	if e.Role == RoleInstructor && person.Type != "professor" {
+		writeNotProfessor(w, person.ID)
+		return errNotProfessor
+	}
+	if enforced && !checkPrerequisites(w, tx, []Person{person}, []int{e.CourseID}, e.Role) {
+		return errMissingPrerequisites
+	}
+	return checkSchedule(w, tx, *e)
+}
+
+func writeNotProfessor(w http.ResponseWriter, personID int) {
+	WriteProblem(w, http.StatusUnprocessableEntity, CodeNotProfessor, "Person with id '%v' is not a professor, so they cannot be an instructor.", personID)
+}
+
+// handleEnrollError writes the error of the course-level enrollment e.
+func handleEnrollError(w http.ResponseWriter, e PersonCourse, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeAlreadyEnrolled, "Person with id '%v' is already enrolled in course '%v'.", e.PersonID, e.CourseID)
+	case errors.Is(err, ErrAlreadyWaitlisted):
+		WriteProblem(w, http.StatusConflict, CodeAlreadyWaitlisted, "Person with id '%v' is already waitlisted for course '%v'.", e.PersonID, e.CourseID)
+	default:
+		handleEnrollmentError(w, err)
+	}
+}
+
+// handleEnrollmentError writes the error of a course-level enrollment change.
+func handleEnrollmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNoOffering):
+		WriteProblem(w, http.StatusConflict, CodeNoOffering, "The course has no offering to enroll in. Create one with POST /api/offering.")
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		WriteProblem(w, http.StatusUnprocessableEntity, CodeNotProfessor, "Only professors can be instructors.")
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
+
+func coursesExist(w http.ResponseWriter, store Store, ids []int) bool {
+	missing, err := store.MissingCourseIDs(ids)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+	if len(missing) == 1 {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Course with id '%v' not found.", missing[0])
+		return false
+	} else if len(missing) > 1 {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Courses with ids %v not found.", missing)
+		return false
+	}
+	return true
+}
+
+func personsExist(w http.ResponseWriter, store Store, ids []int) bool {
+	missing, err := store.MissingPersonIDs(ids)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+	if len(missing) == 1 {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' not found.", missing[0])
+		return false
+	} else if len(missing) > 1 {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Persons with ids %v not found.", missing)
+		return false
+	}
+	return true
+}
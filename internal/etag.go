@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+Conditional requests (RFC 9110 section 13).
+
+GETs of a single person or course send a strong ETag and answer a matching
+If-None-Match with 304. PUT, PATCH and DELETE honour If-Match: a stale tag is
+rejected with 412, and the write is made conditional on the version that was
+checked, so a concurrent write in between is rejected too.
+*/
+
+// entityTag hashes parts into a quoted strong entity tag.
+func entityTag(parts ...any) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(parts...)))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// notModified sets the ETag header and, when If-None-Match matches it,
+// writes a 304 and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// checkIfMatch writes a 412 and returns false when the request has an
+// If-Match header that does not match etag.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, etag string, resource string) bool {
+	if header := r.Header.Get("If-Match"); header != "" && !etagMatches(header, etag, false) {
+		WriteProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, "If-Match does not match the current ETag of %v.", resource)
+		return false
+	}
+	return true
+}
+
+// expectedVersion is the version a write must be conditional on: the version
+// checked against If-Match, or zero when the request has none.
+func expectedVersion(r *http.Request, version int) int {
+	if r.Header.Get("If-Match") == "" {
+		return 0
+	}
+	return version
+}
+
+// writeVersionConflict writes the 412 for a write that lost a race with
+// another one after its If-Match check.
+func writeVersionConflict(w http.ResponseWriter, resource string) {
+	WriteProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, "%v was modified concurrently.", resource)
+}
+
+// etagMatches reports whether etag is listed in the If-Match or
+// If-None-Match header value. Weak comparison ignores the W/ prefix; strong
+// comparison never matches weak tags.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
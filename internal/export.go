@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+CSV exports: GET /api/person and GET /api/course with Accept: text/csv.
+
+Lists answer with JSON unless the Accept header prefers text/csv, in which
+case they answer with one CSV record per person or course under a header row.
+Filters and sorting are the same for both. Lists of a person or course, such
+as its courses, are joined with "; ", escaping semicolons and backslashes in
+their items with a backslash. Departments and majors are given by code, as
+the import reads them, and an exported file can be imported again: the
+import ignores the columns it cannot set, such as ids and these lists.
+
+With the limit query parameter, a CSV export is one page with the same
+X-Total-Count and Link headers as the JSON list. Without it, it holds every
+row from the offset or cursor on: rows are read from the store csvBatchSize
+at a time, and each batch is written and flushed to the client before the
+next is read. Cells that spreadsheets would evaluate as formulas are
+prefixed with a quote, which an import keeps.
+*/
+
+const (
+	JSONMediaType  = "application/json"
+	CSVMediaType   = "text/csv"
+	CSVContentType = "text/csv; charset=utf-8"
+
+	csvBatchSize = 100
+)
+
+// listFormat negotiates the media type of a list, JSON or CSV, from the
+// Accept header. It writes a 406 and returns false when the header accepts
+// neither.
+func listFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	format := negotiate(r, JSONMediaType, CSVMediaType)
+	if format == "" {
+		WriteProblem(w, http.StatusNotAcceptable, CodeNotAcceptable, "Accept header allows none of '%v', '%v'.", JSONMediaType, CSVMediaType)
+		return "", false
+	}
+	return format, true
+}
+
+// negotiate returns the offer the Accept header of r gives the highest
+// quality, taken from its most specific matching media range. Ties go to the
+// earlier offer, and so does a missing header. It returns "" when every
+// offer has quality zero.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			params := strings.Split(part, ";")
+			mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+			s := -1
+			switch {
+			case mediaRange == offer:
+				s = 2
+			case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*")):
+				s = 1
+			case mediaRange == "*/*":
+				s = 0
+			}
+			if s <= specificity {
+				continue
+			}
+			quality, specificity = 1, s
+			for _, param := range params[1:] {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "q") {
+					if q, err := strconv.ParseFloat(val, 64); err == nil && q >= 0 && q <= 1 {
+						quality = q
+					}
+				}
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+// exportCSV writes the rows of req that list returns as a CSV table with
+// header, one record per row. Without the limit query parameter it reads
+// every row in batches, following each with a keyset cursor after its last
+// row.
+func exportCSV[T sortable](w http.ResponseWriter, r *http.Request, req pageRequest, filename string, header []string, list func(Page) ([]T, int64, error), record func(T) []string) {
+	all := !r.URL.Query().Has("limit")
+	page := req.fetch()
+	if all {
+		page.Limit = csvBatchSize
+	}
+	rows, total, err := list(page)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if all {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	} else {
+		rows = writePage(w, r, req, rows, total)
+	}
+
+	w.Header().Set("Content-Type", CSVContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%v"`, filename))
+	writer := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	if err := writer.Write(header); err != nil {
+		Out("ERROR", err)
+		return
+	}
+	for {
+		for _, row := range rows {
+			cells := record(row)
+			for i := range cells {
+				cells[i] = csvCell(cells[i])
+			}
+			if err := writer.Write(cells); err != nil {
+				// The client went away.
+				Out("ERROR", err)
+				return
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			Out("ERROR", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !all || len(rows) < csvBatchSize {
+			return
+		}
+		page = Page{Limit: csvBatchSize, Sort: req.Sort, After: cursorValues(rows[len(rows)-1], req.Sort)}
+		if rows, _, err = list(page); err != nil {
+			// The status line is sent, so abort the response rather than
+			// end the table as if it were complete.
+			Out("ERROR", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// csvCell escapes a cell that a spreadsheet would evaluate as a formula.
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// affiliationCodes maps the ids of departments and programs to their codes.
+func affiliationCodes(store Store) (map[int]string, map[int]string, error) {
+	departments, _, err := store.ListDepartments(Page{})
+	if err != nil {
+		return nil, nil, err
+	}
+	programs, _, err := store.ListPrograms(ProgramFilter{}, Page{})
+	if err != nil {
+		return nil, nil, err
+	}
+	departmentCodes, programCodes := map[int]string{}, map[int]string{}
+	for _, department := range departments {
+		departmentCodes[department.ID] = department.Code
+	}
+	for _, program := range programs {
+		programCodes[program.ID] = program.Code
+	}
+	return departmentCodes, programCodes, nil
+}
+
+// exportPersons writes the persons matching filter as a CSV table, with the
+// names of their courses.
+func exportPersons(w http.ResponseWriter, r *http.Request, store Store, filter PersonFilter, req pageRequest) {
+	departments, programs, err := affiliationCodes(store)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	header := []string{"id", "first_name", "last_name", "type", "age", "department", "major", "courses"}
+	list := func(page Page) ([]Person, int64, error) { return store.ListPersons(filter, page) }
+	exportCSV(w, r, req, "persons.csv", header, list, func(person Person) []string {
+		var courses []string
+		for _, course := range distinctCourses(person.Courses) {
+			courses = append(courses, course.Name)
+		}
+		return []string{
+			strconv.Itoa(person.ID),
+			person.FirstName,
+			person.LastName,
+			person.Type,
+			strconv.Itoa(person.age()),
+			codeOf(departments, person.DepartmentID),
+			codeOf(programs, person.MajorID),
+			joinList(courses),
+		}
+	})
+}
+
+// exportCourses writes the courses matching filter as a CSV table, with the
+// names of their instructors.
+func exportCourses(w http.ResponseWriter, r *http.Request, store Store, filter CourseFilter, req pageRequest) {
+	departments, _, err := affiliationCodes(store)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	header := []string{"id", "code", "name", "department", "number", "credit_hours", "capacity", "instructors", "student_count"}
+	list := func(page Page) ([]Course, int64, error) { return store.ListCourses(filter, page) }
+	exportCSV(w, r, req, "courses.csv", header, list, func(course Course) []string {
+		var capacity string
+		if course.Capacity != nil {
+			capacity = strconv.Itoa(*course.Capacity)
+		}
+		var instructors []string
+		for _, instructor := range course.Instructors {
+			instructors = append(instructors, instructor.FirstName+" "+instructor.LastName)
+		}
+		return []string{
+			strconv.Itoa(course.ID),
+			course.Code,
+			course.Name,
+			codeOf(departments, course.DepartmentID),
+			course.Number,
+			strconv.Itoa(course.CreditHours),
+			capacity,
+			joinList(instructors),
+			strconv.Itoa(course.StudentCount),
+		}
+	})
+}
+
+// listEscaper escapes the separator of joinList and itself in list items.
+var listEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`)
+
+// joinList joins items with "; ", so a semicolon in an item is escaped.
+func joinList(items []string) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		escaped[i] = listEscaper.Replace(item)
+	}
+	return strings.Join(escaped, "; ")
+}
+
+// codeOf returns the code of id in codes, or "" when id is nil.
+func codeOf(codes map[int]string, id *int) string {
+	if id == nil {
+		return ""
+	}
+	return codes[*id]
+}
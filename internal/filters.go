@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MatchMode selects how a StringMatch compares text. Every mode ignores case.
+type MatchMode string
+
+const (
+	MatchExact    MatchMode = "exact"
+	MatchPrefix   MatchMode = "prefix"
+	MatchContains MatchMode = "contains"
+)
+
+// StringMatch compares a person column against Value.
+type StringMatch struct {
+	Column string
+	Mode   MatchMode
+	Value  string
+}
+
+// Matches reports whether text satisfies the match.
+func (m StringMatch) Matches(text string) bool {
+	text, value := strings.ToLower(text), strings.ToLower(m.Value)
+	switch m.Mode {
+	case MatchPrefix:
+		return strings.HasPrefix(text, value)
+	case MatchContains:
+		return strings.Contains(text, value)
+	default:
+		return text == value
+	}
+}
+
+// PersonFilter narrows ListPersons. Zero values are ignored and every set
+// field must match.
+type PersonFilter struct {
+	Age    *int
+	AgeGte *int
+	AgeLte *int
+	Type   string
+	// Name is a full "first last" name normalized by ParseName.
+	Name  string
+	Names []StringMatch
+	// EnrolledIn keeps persons enrolled in any of the courses, or in all of
+	// them when EnrolledInAll is set.
+	EnrolledIn    []int
+	EnrolledInAll bool
+	// Terms are free-text words that must each appear in the first or last name.
+	Terms []string
+	// Department is the code of a department. It keeps the professors of the
+	// department and the students majoring in one of its programs.
+	Department string
+	// AdvisorID keeps the students the professor currently advises.
+	AdvisorID int
+}
+
+// personFilterParams are the query parameters accepted by GET /api/person, in
+// addition to the pagination parameters.
+var personFilterParams = []string{
+	"age", "age_gte", "age_lte", "type", "name",
+	"first_name", "first_name_prefix", "first_name_contains",
+	"last_name", "last_name_prefix", "last_name_contains",
+	"enrolled_in", "enrolled_match", "q", "department", "advisor",
+}
+
+var pageParams = []string{"limit", "offset", "cursor", "sort"}
+
+// viewParams select which rows a list reads rather than filtering them.
+var viewParams = []string{"include_deleted"}
+
+// ParsePersonFilter reads the filter query parameters of GET /api/person. It
+// writes a 400 naming the offending parameter and returns false when one is
+// unknown or invalid.
+func ParsePersonFilter(w http.ResponseWriter, r *http.Request) (PersonFilter, bool) {
+	var filter PersonFilter
+	query := r.URL.Query()
+
+	for key := range query {
+		if !slices.Contains(personFilterParams, key) && !slices.Contains(pageParams, key) && !slices.Contains(viewParams, key) {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return filter, false
+		}
+	}
+
+	var ok bool
+	if filter.Age, ok = parseOptionalInt(w, r, "age"); !ok {
+		return filter, false
+	}
+	if filter.AgeGte, ok = parseOptionalInt(w, r, "age_gte"); !ok {
+		return filter, false
+	}
+	if filter.AgeLte, ok = parseOptionalInt(w, r, "age_lte"); !ok {
+		return filter, false
+	}
+	if filter.AgeGte != nil && filter.AgeLte != nil && *filter.AgeGte > *filter.AgeLte {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid age_gte '%d' on query parameter. Must not exceed age_lte '%d'.", *filter.AgeGte, *filter.AgeLte)
+		return filter, false
+	}
+
+	filter.Type = query.Get("type")
+	if filter.Type != "" && !slices.Contains(PersonTypes, filter.Type) {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid type '%v' on query parameter. Type must be either 'student' or 'professor'.", filter.Type)
+		return filter, false
+	}
+
+	if name := query.Get("name"); name != "" {
+		var err error
+		if filter.Name, err = ParseName(w, name); err != nil {
+			return filter, false
+		}
+	}
+
+	for _, column := range []string{"first_name", "last_name"} {
+		for _, mode := range []MatchMode{MatchExact, MatchPrefix, MatchContains} {
+			key := column
+			if mode != MatchExact {
+				key += "_" + string(mode)
+			}
+			if _, set := query[key]; !set {
+				continue
+			}
+			value := strings.TrimSpace(query.Get(key))
+			if value == "" {
+				WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid %v on query parameter. Must not be empty.", key)
+				return filter, false
+			}
+			filter.Names = append(filter.Names, StringMatch{Column: column, Mode: mode, Value: value})
+		}
+	}
+
+	if val := query.Get("enrolled_in"); val != "" {
+		for _, part := range strings.Split(val, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid enrolled_in '%v' on query parameter. Must be a comma-separated list of course ids.", val)
+				return filter, false
+			}
+			filter.EnrolledIn = append(filter.EnrolledIn, id)
+		}
+		filter.EnrolledIn = uniqueIDs(filter.EnrolledIn)
+	}
+	switch mode := query.Get("enrolled_match"); mode {
+	case "", "any":
+	case "all":
+		filter.EnrolledInAll = true
+	default:
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid enrolled_match '%v' on query parameter. Must be either 'any' or 'all'.", mode)
+		return filter, false
+	}
+
+	advisor, ok := parseOptionalInt(w, r, "advisor")
+	if !ok {
+		return filter, false
+	}
+	if advisor != nil && *advisor < 1 {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid advisor '%d' on query parameter. Must be the id of a person.", *advisor)
+		return filter, false
+	} else if advisor != nil {
+		filter.AdvisorID = *advisor
+	}
+
+	filter.Terms = strings.Fields(strings.ToLower(query.Get("q")))
+	filter.Department = strings.ToUpper(strings.TrimSpace(query.Get("department")))
+	return filter, true
+}
+
+// parseOptionalInt reads an optional integer query parameter. It writes a 400
+// and returns false when the parameter is present but not an integer.
+func parseOptionalInt(w http.ResponseWriter, r *http.Request, key string) (*int, bool) {
+	val, err := ParseIntQuery(w, r, key)
+	if err == ErrNoParameter {
+		return nil, true
+	} else if err != nil {
+		return nil, false
+	}
+	return &val, true
+}
@@ -0,0 +1,1572 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormStore implements Store on top of a gorm connection to Postgres.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx})
+	})
+}
+
+func (s *GormStore) WithDeleted() Store {
+	return &GormStore{db: s.db.Unscoped()}
+}
+
+/*
+Courses.
+*/
+
+func (s *GormStore) ListCourses(filter CourseFilter, page Page) ([]Course, int64, error) {
+	query := s.db.Model(&Course{})
+	if filter.Department != "" {
+		query = query.Where("course.department_id IN (?)", s.db.Model(&Department{}).Select("id").Where("code = ?", filter.Department))
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var courses []Course
+	if err := applyPage(query, "course", page).Find(&courses).Error; err != nil {
+		return nil, 0, err
+	}
+	return courses, total, fillCourseStats(s.db, courses)
+}
+
+func (s *GormStore) GetCourse(id int) (Course, error) {
+	var course Course
+	if err := s.db.First(&course, id).Error; err != nil {
+		return course, err
+	}
+	courses := []Course{course}
+	err := fillCourseStats(s.db, courses)
+	return courses[0], err
+}
+
+func (s *GormStore) CreateCourse(course *Course) error {
+	course.Version = 1
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Omit("Persons").Create(course).Error; err != nil {
+			return err
+		}
+		var term Term
+		err := db.Order("start_date DESC, id DESC").First(&term).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return db.Create(&CourseOffering{CourseID: course.ID, TermID: term.ID, Section: DefaultSection}).Error
+	})
+}
+
+func (s *GormStore) UpdateCourse(course *Course) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		values := map[string]any{
+			"name":          course.Name,
+			"capacity":      course.Capacity,
+			"credit_hours":  course.CreditHours,
+			"department_id": course.DepartmentID,
+			"number":        course.Number,
+		}
+		if err := updateVersioned(db, &Course{}, course.ID, course.Version, values); err != nil {
+			return err
+		}
+		var offeringIDs []int
+		if err := db.Model(&CourseOffering{}).Where("course_id = ?", course.ID).Pluck("id", &offeringIDs).Error; err != nil {
+			return err
+		}
+		if err := lockOfferings(db, offeringIDs); err != nil {
+			return err
+		}
+		for _, offeringID := range offeringIDs {
+			if err := promote(db, offeringID); err != nil {
+				return err
+			}
+		}
+		reloaded, err := (&GormStore{db: db}).GetCourse(course.ID)
+		*course = reloaded
+		return err
+	})
+}
+
+func (s *GormStore) DeleteCourse(id int, version int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		values := map[string]any{"deleted_at": time.Now()}
+		if err := updateVersioned(db, &Course{}, id, version, values); err != nil {
+			return err
+		}
+		return touchPersons(db, db.Model(&PersonCourse{}).Select("person_id").Where("course_id = ?", id))
+	})
+}
+
+func (s *GormStore) RestoreCourse(id int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := restore(db, &Course{}, id); err != nil {
+			return err
+		}
+		return touchPersons(db, db.Model(&PersonCourse{}).Select("person_id").Where("course_id = ?", id))
+	})
+}
+
+func (s *GormStore) MissingCourseIDs(ids []int) ([]int, error) {
+	return s.missingIDs(&Course{}, ids)
+}
+
+/*
+Prerequisites.
+*/
+
+// prerequisiteClosure selects the ids of every course a course requires,
+// directly or not.
+const prerequisiteClosure = `WITH RECURSIVE closure (id) AS (
+	SELECT prerequisite_id FROM course_prerequisite WHERE course_id = ?
+	UNION
+	SELECT course_prerequisite.prerequisite_id
+	FROM course_prerequisite JOIN closure ON course_prerequisite.course_id = closure.id
+) SELECT id FROM closure`
+
+func (s *GormStore) ListPrerequisites(courseID int) ([]Course, error) {
+	direct := s.db.Model(&CoursePrerequisite{}).Select("prerequisite_id").Where("course_id = ?", courseID)
+	var courses []Course
+	if err := s.db.Where("id IN (?)", direct).Order("id").Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, fillCourseStats(s.db, courses)
+}
+
+func (s *GormStore) ListPrerequisiteClosure(courseID int) ([]Course, error) {
+	var courses []Course
+	if err := s.db.Where("id IN (?)", gorm.Expr(prerequisiteClosure, courseID)).Order("id").Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, fillCourseStats(s.db, courses)
+}
+
+func (s *GormStore) AddPrerequisite(courseID int, prerequisiteID int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		// Two edges added concurrently could close a cycle that neither
+		// transaction sees, so additions are serialized.
+		if err := db.Exec("LOCK TABLE course_prerequisite IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		var closure []int
+		if err := db.Raw(prerequisiteClosure, prerequisiteID).Scan(&closure).Error; err != nil {
+			return err
+		}
+		if courseID == prerequisiteID || slices.Contains(closure, courseID) {
+			return ErrPrerequisiteCycle
+		}
+		return db.Create(&CoursePrerequisite{CourseID: courseID, PrerequisiteID: prerequisiteID}).Error
+	})
+}
+
+func (s *GormStore) RemovePrerequisite(courseID int, prerequisiteID int) error {
+	result := s.db.Where("course_id = ? AND prerequisite_id = ?", courseID, prerequisiteID).Delete(&CoursePrerequisite{})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+/*
+Persons.
+*/
+
+func (s *GormStore) ListPersons(filter PersonFilter, page Page) ([]Person, int64, error) {
+	var total int64
+	if err := s.filterPersons(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	persons, err := s.loadPersons(applyPage(s.filterPersons(filter), "person", page))
+	return persons, total, err
+}
+
+func (s *GormStore) filterPersons(filter PersonFilter) *gorm.DB {
+	query := s.db.Model(&Person{})
+	if filter.Age != nil {
+		query = query.Where("person.age = ?", *filter.Age)
+	}
+	if filter.AgeGte != nil {
+		query = query.Where("person.age >= ?", *filter.AgeGte)
+	}
+	if filter.AgeLte != nil {
+		query = query.Where("person.age <= ?", *filter.AgeLte)
+	}
+	if filter.Type != "" {
+		query = query.Where("person.type = ?", filter.Type)
+	}
+	if filter.Name != "" {
+		query = query.Where("LOWER(person.first_name || ' ' || person.last_name) = ?", filter.Name)
+	}
+	for _, match := range filter.Names {
+		// Column names come from the whitelist in ParsePersonFilter.
+		column := "LOWER(person." + match.Column + ")"
+		switch match.Mode {
+		case MatchPrefix:
+			query = query.Where(column+" LIKE ?", escapeLike(strings.ToLower(match.Value))+"%")
+		case MatchContains:
+			query = query.Where(column+" LIKE ?", "%"+escapeLike(strings.ToLower(match.Value))+"%")
+		default:
+			query = query.Where(column+" = ?", strings.ToLower(match.Value))
+		}
+	}
+	if len(filter.EnrolledIn) > 0 {
+		enrolled := s.db.Model(&PersonCourse{}).Select("person_id").Where("course_id IN ?", filter.EnrolledIn)
+		if filter.EnrolledInAll {
+			enrolled = enrolled.Group("person_id").Having("COUNT(DISTINCT course_id) = ?", len(filter.EnrolledIn))
+		}
+		query = query.Where("person.id IN (?)", enrolled)
+	}
+	for _, term := range filter.Terms {
+		pattern := "%" + escapeLike(term) + "%"
+		query = query.Where("(LOWER(person.first_name) LIKE ? OR LOWER(person.last_name) LIKE ?)", pattern, pattern)
+	}
+	if filter.AdvisorID != 0 {
+		advisees := s.db.Model(&AdvisorAssignment{}).Select("student_id").Where("advisor_id = ? AND ended_at IS NULL", filter.AdvisorID)
+		query = query.Where("person.id IN (?)", advisees)
+	}
+	if filter.Department != "" {
+		departments := s.db.Model(&Department{}).Select("id").Where("code = ?", filter.Department)
+		programs := s.db.Model(&Program{}).Select("id").Where("department_id IN (?)", departments)
+		query = query.Where("(person.department_id IN (?) OR person.major_id IN (?))", departments, programs)
+	}
+	return query
+}
+
+func (s *GormStore) GetPerson(id int) (Person, error) {
+	persons, err := s.loadPersons(s.db.Where("person.id = ?", id))
+	if err != nil {
+		return Person{}, err
+	} else if len(persons) == 0 {
+		return Person{}, gorm.ErrRecordNotFound
+	}
+	return persons[0], nil
+}
+
+func (s *GormStore) FindPersonsByName(name string) ([]Person, error) {
+	persons, _, err := s.ListPersons(PersonFilter{Name: name}, Page{})
+	return persons, err
+}
+
+func (s *GormStore) CreatePerson(person *Person) error {
+	person.Version = 1
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Omit("Courses").Create(person).Error; err != nil {
+			return err
+		}
+		return setPersonEnrollments(db, person.ID, courseIDs(person.Courses))
+	})
+}
+
+func (s *GormStore) UpdatePerson(person *Person) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		values := map[string]any{
+			"first_name":    person.FirstName,
+			"last_name":     person.LastName,
+			"type":          person.Type,
+			"age":           person.Age,
+			"department_id": person.DepartmentID,
+			"major_id":      person.MajorID,
+		}
+		if err := updateVersioned(db, &Person{}, person.ID, person.Version, values); err != nil {
+			return err
+		}
+		if person.Courses != nil {
+			if err := setPersonEnrollments(db, person.ID, courseIDs(person.Courses)); err != nil {
+				return err
+			}
+		}
+		reloaded, err := (&GormStore{db: db}).GetPerson(person.ID)
+		*person = reloaded
+		return err
+	})
+}
+
+func (s *GormStore) DeletePerson(id int, version int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		offeringIDs, err := studentOfferingIDs(db, id)
+		if err != nil {
+			return err
+		}
+		if err := lockOfferings(db, offeringIDs); err != nil {
+			return err
+		}
+		if err := updateVersioned(db, &Person{}, id, version, map[string]any{"deleted_at": time.Now()}); err != nil {
+			return err
+		}
+		// The seats of a deleted student go to the waitlist.
+		for _, offeringID := range offeringIDs {
+			if err := promote(db, offeringID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) RestorePerson(id int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		offeringIDs, err := studentOfferingIDs(db, id)
+		if err != nil {
+			return err
+		}
+		var waitlisted []int
+		if err := db.Model(&WaitlistEntry{}).Where("person_id = ?", id).Pluck("offering_id", &waitlisted).Error; err != nil {
+			return err
+		}
+		if err := lockOfferings(db, append(slices.Clone(offeringIDs), waitlisted...)); err != nil {
+			return err
+		}
+		// A restored student whose seat was given away is waitlisted again.
+		for _, offeringID := range offeringIDs {
+			if seat, err := hasSeat(db, offeringID); err != nil {
+				return err
+			} else if seat {
+				continue
+			}
+			var e PersonCourse
+			if err := db.Where("person_id = ? AND offering_id = ?", id, offeringID).Take(&e).Error; err != nil {
+				return err
+			}
+			if err := db.Delete(&e).Error; err != nil {
+				return err
+			}
+			entry := WaitlistEntry{PersonID: id, CourseID: e.CourseID, OfferingID: offeringID, CreatedAt: time.Now()}
+			if err := db.Create(&entry).Error; err != nil {
+				return err
+			}
+		}
+		if err := restore(db, &Person{}, id); err != nil {
+			return err
+		}
+		for _, offeringID := range uniqueIDs(waitlisted) {
+			if err := promote(db, offeringID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) MissingPersonIDs(ids []int) ([]int, error) {
+	return s.missingIDs(&Person{}, ids)
+}
+
+/*
+Enrollments.
+*/
+
+func (s *GormStore) ListCoursePersons(courseID int, personType string) ([]Person, error) {
+	enrolled := s.db.Model(&PersonCourse{}).Select("person_id").Where("course_id = ?", courseID)
+	query := s.db.Where("person.id IN (?)", enrolled).Order("person.id")
+	if personType != "" {
+		query = query.Where("person.type = ?", personType)
+	}
+	return s.loadPersons(query)
+}
+
+func (s *GormStore) ListEnrollments(filter EnrollmentFilter) ([]PersonCourse, error) {
+	query := s.db.Model(&PersonCourse{})
+	if !s.db.Statement.Unscoped {
+		query = query.Where("person_id NOT IN (SELECT id FROM person WHERE deleted_at IS NOT NULL)").
+			Where("course_id NOT IN (SELECT id FROM course WHERE deleted_at IS NOT NULL)")
+	}
+	if filter.PersonID != 0 {
+		query = query.Where("person_id = ?", filter.PersonID)
+	}
+	if filter.CourseID != 0 {
+		query = query.Where("course_id = ?", filter.CourseID)
+	}
+	if filter.OfferingID != 0 {
+		query = query.Where("offering_id = ?", filter.OfferingID)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	var enrollments []PersonCourse
+	err := query.Order("offering_id, person_id").Find(&enrollments).Error
+	return enrollments, err
+}
+
+func (s *GormStore) Enroll(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := s.db.Transaction(func(db *gorm.DB) error {
+		offerings, err := defaultOfferings(db, []int{e.CourseID})
+		if err != nil {
+			return err
+		}
+		e.OfferingID = offerings[e.CourseID]
+		entry, err = enroll(db, e)
+		return err
+	})
+	return entry, err
+}
+
+func (s *GormStore) Drop(courseID int, personID int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		offerings, err := defaultOfferings(db, []int{courseID})
+		if err != nil {
+			return err
+		}
+		return release(db, offerings[courseID], personID)
+	})
+}
+
+func (s *GormStore) SetCoursePersons(courseID int, personIDs []int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		offerings, err := defaultOfferings(db, []int{courseID})
+		if err != nil {
+			return err
+		}
+		rows := make([]PersonCourse, 0, len(personIDs))
+		for _, personID := range uniqueIDs(personIDs) {
+			rows = append(rows, PersonCourse{PersonID: personID, CourseID: courseID, OfferingID: offerings[courseID]})
+		}
+		var touched []int
+		if err := db.Model(&PersonCourse{}).Where("offering_id = ?", offerings[courseID]).Pluck("person_id", &touched).Error; err != nil {
+			return err
+		}
+		if err := setEnrollments(db, courseEnrollments, courseID, rows); err != nil {
+			return err
+		}
+		return touchPersons(db, uniqueIDs(append(touched, personIDs...)))
+	})
+}
+
+func (s *GormStore) SetPersonCourses(personID int, courseIDs []int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := setPersonEnrollments(db, personID, courseIDs); err != nil {
+			return err
+		}
+		return touchPersons(db, []int{personID})
+	})
+}
+
+func (s *GormStore) ListOfferingPersons(offeringID int) ([]Person, error) {
+	enrolled := s.db.Model(&PersonCourse{}).Select("person_id").Where("offering_id = ?", offeringID)
+	return s.loadPersons(s.db.Where("person.id IN (?)", enrolled).Order("person.id"))
+}
+
+func (s *GormStore) ListPersonOfferings(personID int) ([]CourseOffering, error) {
+	enrolled := s.db.Model(&PersonCourse{}).Select("offering_id").Where("person_id = ?", personID)
+	var offerings []CourseOffering
+	err := s.offerings().Where("course_offering.id IN (?)", enrolled).Order("course_offering.id").Find(&offerings).Error
+	return offerings, err
+}
+
+func (s *GormStore) EnrollOffering(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := s.db.Transaction(func(db *gorm.DB) error {
+		var offering CourseOffering
+		if err := db.First(&offering, e.OfferingID).Error; err != nil {
+			return err
+		}
+		e.CourseID = offering.CourseID
+		var err error
+		entry, err = enroll(db, e)
+		return err
+	})
+	return entry, err
+}
+
+func (s *GormStore) DropOffering(offeringID int, personID int) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		return release(db, offeringID, personID)
+	})
+}
+
+func (s *GormStore) ListWaitlist(offeringID int) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	err := s.db.Where("offering_id = ?", offeringID).Order("id").Find(&entries).Error
+	for i := range entries {
+		entries[i].Position = i + 1
+	}
+	return entries, err
+}
+
+func (s *GormStore) ListPersonWaitlist(personID int) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	if err := s.db.Where("person_id = ?", personID).Order("offering_id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		position, err := waitlistPosition(s.db, entries[i])
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Position = position
+	}
+	return entries, nil
+}
+
+func (s *GormStore) SetGrade(change GradeChange) (PersonCourse, error) {
+	var e PersonCourse
+	err := s.db.Transaction(func(db *gorm.DB) error {
+		err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("person_id = ? AND offering_id = ?", change.PersonID, change.OfferingID).Take(&e).Error
+		if err != nil {
+			return err
+		}
+		if e.Role != RoleStudent {
+			return gorm.ErrCheckConstraintViolated
+		}
+		now := time.Now()
+		e.Grade, e.GradePoints, e.GradedAt = &change.Grade, GradePoints(change.Grade), &now
+		values := map[string]any{"grade": e.Grade, "grade_points": e.GradePoints, "graded_at": e.GradedAt}
+		return db.Model(&PersonCourse{}).
+			Where("person_id = ? AND offering_id = ?", change.PersonID, change.OfferingID).
+			Updates(values).Error
+	})
+	return e, err
+}
+
+/*
+Terms.
+*/
+
+func (s *GormStore) ListTerms(page Page) ([]Term, int64, error) {
+	var total int64
+	if err := s.db.Model(&Term{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var terms []Term
+	err := applyPage(s.db.Model(&Term{}), "term", page).Find(&terms).Error
+	return terms, total, err
+}
+
+func (s *GormStore) GetTerm(id int) (Term, error) {
+	var term Term
+	err := s.db.First(&term, id).Error
+	return term, err
+}
+
+func (s *GormStore) CreateTerm(term *Term) error {
+	return s.db.Create(term).Error
+}
+
+func (s *GormStore) UpdateTerm(term *Term) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&Term{}).Where("id = ?", term.ID).Updates(map[string]any{
+			"name":       term.Name,
+			"start_date": term.StartDate,
+			"end_date":   term.EndDate,
+		})
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return db.First(term, term.ID).Error
+	})
+}
+
+func (s *GormStore) DeleteTerm(id int) error {
+	return deleteRow(s.db, &Term{}, id)
+}
+
+func (s *GormStore) ListHolidays(termID int) ([]Holiday, error) {
+	var holidays []Holiday
+	err := s.db.Where("term_id = ?", termID).Order("date").Find(&holidays).Error
+	return holidays, err
+}
+
+func (s *GormStore) SetTermHolidays(termID int, holidays []Holiday) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Where("term_id = ?", termID).Delete(&Holiday{}).Error; err != nil {
+			return err
+		}
+		if len(holidays) == 0 {
+			return nil
+		}
+		for i := range holidays {
+			holidays[i].TermID = termID
+		}
+		return db.Create(&holidays).Error
+	})
+}
+
+/*
+Departments.
+*/
+
+func (s *GormStore) ListDepartments(page Page) ([]Department, int64, error) {
+	var total int64
+	if err := s.db.Model(&Department{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var departments []Department
+	err := applyPage(s.db.Model(&Department{}), "department", page).Find(&departments).Error
+	return departments, total, err
+}
+
+func (s *GormStore) GetDepartment(id int) (Department, error) {
+	var department Department
+	err := s.db.First(&department, id).Error
+	return department, err
+}
+
+func (s *GormStore) CreateDepartment(department *Department) error {
+	setChairType(department)
+	return s.db.Create(department).Error
+}
+
+func (s *GormStore) UpdateDepartment(department *Department) error {
+	setChairType(department)
+	return s.db.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&Department{}).Where("id = ?", department.ID).Updates(map[string]any{
+			"code":       department.Code,
+			"name":       department.Name,
+			"chair_id":   department.ChairID,
+			"chair_type": department.ChairType,
+		})
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return db.First(department, department.ID).Error
+	})
+}
+
+func (s *GormStore) DeleteDepartment(id int) error {
+	return deleteRow(s.db, &Department{}, id)
+}
+
+/*
+Programs.
+*/
+
+func (s *GormStore) ListPrograms(filter ProgramFilter, page Page) ([]Program, int64, error) {
+	query := s.db.Model(&Program{})
+	if filter.DepartmentID != 0 {
+		query = query.Where("program.department_id = ?", filter.DepartmentID)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var programs []Program
+	err := applyPage(query, "program", page).Find(&programs).Error
+	return programs, total, err
+}
+
+func (s *GormStore) GetProgram(id int) (Program, error) {
+	var program Program
+	err := s.db.First(&program, id).Error
+	return program, err
+}
+
+func (s *GormStore) CreateProgram(program *Program) error {
+	return s.db.Create(program).Error
+}
+
+func (s *GormStore) UpdateProgram(program *Program) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&Program{}).Where("id = ?", program.ID).Updates(map[string]any{
+			"code":          program.Code,
+			"name":          program.Name,
+			"degree":        program.Degree,
+			"department_id": program.DepartmentID,
+		})
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return db.First(program, program.ID).Error
+	})
+}
+
+func (s *GormStore) DeleteProgram(id int) error {
+	return deleteRow(s.db, &Program{}, id)
+}
+
+func (s *GormStore) ListRequirements(programID int) ([]Requirement, error) {
+	var requirements []Requirement
+	if err := s.db.Where("program_id = ?", programID).Order("id").Find(&requirements).Error; err != nil {
+		return nil, err
+	}
+	if len(requirements) == 0 {
+		return requirements, nil
+	}
+	ids := make([]int, len(requirements))
+	for i, requirement := range requirements {
+		ids[i] = requirement.ID
+	}
+	var courses []RequirementCourse
+	if err := s.db.Where("requirement_id IN ?", ids).Order("requirement_id, course_id").Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	for i := range requirements {
+		for _, course := range courses {
+			if course.RequirementID == requirements[i].ID {
+				requirements[i].CourseIDs = append(requirements[i].CourseIDs, course.CourseID)
+			}
+		}
+	}
+	return requirements, nil
+}
+
+func (s *GormStore) SetProgramRequirements(programID int, requirements []Requirement) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Where("program_id = ?", programID).Delete(&Requirement{}).Error; err != nil {
+			return err
+		}
+		for i := range requirements {
+			requirements[i].ID, requirements[i].ProgramID = 0, programID
+			if err := db.Create(&requirements[i]).Error; err != nil {
+				return err
+			}
+			if len(requirements[i].CourseIDs) == 0 {
+				continue
+			}
+			courses := make([]RequirementCourse, len(requirements[i].CourseIDs))
+			for j, courseID := range requirements[i].CourseIDs {
+				courses[j] = RequirementCourse{RequirementID: requirements[i].ID, CourseID: courseID}
+			}
+			if err := db.Create(&courses).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Advisors.
+*/
+
+func (s *GormStore) ListAdvisorAssignments(filter AdvisorFilter) ([]AdvisorAssignment, error) {
+	query := s.db.Model(&AdvisorAssignment{})
+	if filter.StudentID != 0 {
+		query = query.Where("student_id = ?", filter.StudentID)
+	}
+	if filter.AdvisorID != 0 {
+		query = query.Where("advisor_id = ?", filter.AdvisorID)
+	}
+	if filter.Current {
+		query = query.Where("ended_at IS NULL")
+	}
+	var assignments []AdvisorAssignment
+	err := query.Order("id").Find(&assignments).Error
+	return assignments, err
+}
+
+func (s *GormStore) AssignAdvisor(assignment *AdvisorAssignment) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		var current AdvisorAssignment
+		err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("student_id = ? AND ended_at IS NULL", assignment.StudentID).Take(&current).Error
+		if err == nil && current.AdvisorID == assignment.AdvisorID {
+			*assignment = current
+			return nil
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		now := time.Now()
+		if err == nil {
+			if err := endAdvisorAssignments(db.Where("id = ?", current.ID), now); err != nil {
+				return err
+			}
+		}
+		studentType, advisorType := "student", "professor"
+		assignment.ID, assignment.StartedAt, assignment.EndedAt = 0, now, nil
+		assignment.StudentType, assignment.AdvisorType = &studentType, &advisorType
+		return db.Create(assignment).Error
+	})
+}
+
+func (s *GormStore) EndAdvisorAssignment(studentID int) error {
+	return endAdvisorAssignments(s.db.Where("student_id = ?", studentID), time.Now())
+}
+
+/*
+Offerings.
+*/
+
+func (s *GormStore) ListOfferings(filter OfferingFilter, page Page) ([]CourseOffering, int64, error) {
+	query := s.offerings()
+	if filter.CourseID != 0 {
+		query = query.Where("course_offering.course_id = ?", filter.CourseID)
+	}
+	if filter.TermID != 0 {
+		query = query.Where("course_offering.term_id = ?", filter.TermID)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var offerings []CourseOffering
+	err := applyPage(query, "course_offering", page).Find(&offerings).Error
+	return offerings, total, err
+}
+
+func (s *GormStore) GetOffering(id int) (CourseOffering, error) {
+	var offering CourseOffering
+	err := s.offerings().First(&offering, id).Error
+	return offering, err
+}
+
+func (s *GormStore) CreateOffering(offering *CourseOffering) error {
+	return s.db.Create(offering).Error
+}
+
+func (s *GormStore) UpdateOffering(offering *CourseOffering) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&CourseOffering{}).Where("id = ?", offering.ID).Updates(map[string]any{
+			"course_id": offering.CourseID,
+			"term_id":   offering.TermID,
+			"section":   offering.Section,
+		})
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return db.First(offering, offering.ID).Error
+	})
+}
+
+func (s *GormStore) DeleteOffering(id int) error {
+	return deleteRow(s.db, &CourseOffering{}, id)
+}
+
+/*
+Meetings.
+*/
+
+func (s *GormStore) ListMeetings(filter MeetingFilter) ([]Meeting, error) {
+	query := s.db.Model(&Meeting{}).Joins("JOIN course_offering ON course_offering.id = meeting.offering_id")
+	if !s.db.Statement.Unscoped {
+		query = query.Where("course_offering.course_id NOT IN (SELECT id FROM course WHERE deleted_at IS NOT NULL)")
+	}
+	if filter.OfferingIDs != nil {
+		query = query.Where("meeting.offering_id IN ?", append([]int{0}, filter.OfferingIDs...))
+	}
+	if filter.TermID != 0 {
+		query = query.Where("course_offering.term_id = ?", filter.TermID)
+	}
+	if filter.Room != "" {
+		query = query.Where("meeting.room = ?", filter.Room)
+	}
+	var meetings []Meeting
+	if err := query.Select("meeting.*").Order("meeting.offering_id, meeting.id").Find(&meetings).Error; err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(meetings, func(a, b Meeting) int {
+		if a.OfferingID != b.OfferingID {
+			return a.OfferingID - b.OfferingID
+		}
+		return compareMeetings(a, b)
+	})
+	return meetings, nil
+}
+
+func (s *GormStore) SetOfferingMeetings(offeringID int, meetings []Meeting) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Where("offering_id = ?", offeringID).Delete(&Meeting{}).Error; err != nil {
+			return err
+		}
+		for i := range meetings {
+			meetings[i].ID, meetings[i].OfferingID = 0, offeringID
+		}
+		if len(meetings) == 0 {
+			return nil
+		}
+		return db.Create(&meetings).Error
+	})
+}
+
+// LockRooms takes a transaction advisory lock on each room of the term.
+// Rooms are locked in order, so transactions locking several do not
+// deadlock.
+func (s *GormStore) LockRooms(termID int, rooms []string) error {
+	rooms = slices.Clone(rooms)
+	slices.Sort(rooms)
+	for _, room := range slices.Compact(rooms) {
+		if err := s.db.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", termID, room).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Calendar tokens.
+*/
+
+func (s *GormStore) GetCalendarToken(personID int) (CalendarToken, error) {
+	var token CalendarToken
+	err := s.db.Where("person_id = ?", personID).Take(&token).Error
+	return token, err
+}
+
+func (s *GormStore) SetCalendarToken(token *CalendarToken) error {
+	token.CreatedAt = time.Now()
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "person_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+	}).Create(token).Error
+}
+
+/*
+Access tokens.
+*/
+
+func (s *GormStore) GetAccessToken(personID int) (AccessToken, error) {
+	var token AccessToken
+	err := s.db.Where("person_id = ?", personID).Take(&token).Error
+	return token, err
+}
+
+func (s *GormStore) FindAccessToken(tokenHash string) (AccessToken, error) {
+	var token AccessToken
+	err := s.db.Where("token_hash = ?", tokenHash).Take(&token).Error
+	return token, err
+}
+
+func (s *GormStore) SetAccessToken(token *AccessToken) error {
+	token.CreatedAt = time.Now()
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "person_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+	}).Create(token).Error
+}
+
+/*
+Audit log.
+*/
+
+func (s *GormStore) AppendAudit(entry *AuditEntry) error {
+	entry.OccurredAt = time.Now()
+	return s.db.Create(entry).Error
+}
+
+func (s *GormStore) ListAudit(filter AuditFilter, page Page) ([]AuditEntry, int64, error) {
+	query := s.db.Model(&AuditEntry{})
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("occurred_at >= ?", filter.Since)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []AuditEntry
+	err := applyPage(query, "audit_log", page).Find(&entries).Error
+	return entries, total, err
+}
+
+/*
+Helpers.
+*/
+
+func (s *GormStore) loadPersons(query *gorm.DB) ([]Person, error) {
+	var persons []Person
+	if err := query.Preload("Courses", orderByID).Find(&persons).Error; err != nil {
+		return nil, err
+	}
+	lists := make([][]Course, len(persons))
+	for i := range persons {
+		persons[i].Courses = distinctCourses(persons[i].Courses)
+		lists[i] = persons[i].Courses
+	}
+	return persons, fillCourseStats(s.db, lists...)
+}
+
+// fillCourseStats sets the code, instructors and student count of every
+// course in lists. Soft-deleted persons are left out unless db is unscoped.
+func fillCourseStats(db *gorm.DB, lists ...[]Course) error {
+	var ids, departmentIDs []int
+	for _, courses := range lists {
+		ids = append(ids, courseIDs(courses)...)
+		for _, course := range courses {
+			if course.DepartmentID != nil {
+				departmentIDs = append(departmentIDs, *course.DepartmentID)
+			}
+		}
+	}
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	codes := map[int]string{}
+	if departmentIDs = uniqueIDs(departmentIDs); len(departmentIDs) > 0 {
+		var departments []Department
+		if err := db.Where("id IN ?", departmentIDs).Find(&departments).Error; err != nil {
+			return err
+		}
+		for _, department := range departments {
+			codes[department.ID] = department.Code
+		}
+	}
+	enrolled := func(role string) *gorm.DB {
+		query := db.Table("person_course").Joins("JOIN person ON person.id = person_course.person_id").
+			Where("person_course.course_id IN ? AND person_course.role = ?", ids, role)
+		if !db.Statement.Unscoped {
+			query = query.Where("person.deleted_at IS NULL")
+		}
+		return query
+	}
+
+	var instructors []struct {
+		CourseID  int
+		ID        int
+		FirstName string
+		LastName  string
+	}
+	err := enrolled(RoleInstructor).Distinct("person_course.course_id", "person.id", "person.first_name", "person.last_name").
+		Order("person.id").Scan(&instructors).Error
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		CourseID int
+		Students int
+	}
+	err = enrolled(RoleStudent).Select("person_course.course_id, COUNT(DISTINCT person_course.person_id) AS students").
+		Group("person_course.course_id").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	for _, courses := range lists {
+		for i := range courses {
+			course := &courses[i]
+			if course.DepartmentID != nil {
+				course.Code = courseCode(codes[*course.DepartmentID], course.Number)
+			}
+			course.Instructors, course.StudentCount = []CourseInstructor{}, 0
+			for _, row := range instructors {
+				if row.CourseID == course.ID {
+					course.Instructors = append(course.Instructors, CourseInstructor{ID: row.ID, FirstName: row.FirstName, LastName: row.LastName})
+				}
+			}
+			for _, row := range counts {
+				if row.CourseID == course.ID {
+					course.StudentCount = row.Students
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// offerings selects the offerings visible to s: those of soft-deleted
+// courses are hidden unless s is a WithDeleted view.
+func (s *GormStore) offerings() *gorm.DB {
+	query := s.db.Model(&CourseOffering{})
+	if !s.db.Statement.Unscoped {
+		query = query.Where("course_offering.course_id NOT IN (SELECT id FROM course WHERE deleted_at IS NOT NULL)")
+	}
+	return query
+}
+
+// missingIDs returns the ids that have no row in the table of model.
+func (s *GormStore) missingIDs(model any, ids []int) ([]int, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var found []int
+	if err := s.db.Model(model).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	var missing []int
+	for _, id := range ids {
+		if !slices.Contains(found, id) {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// updateVersioned writes values to the row id of model and increments its
+// version. A non-zero version must match the stored one.
+func updateVersioned(db *gorm.DB, model any, id int, version int, values map[string]any) error {
+	values["version"] = gorm.Expr("version + 1")
+	values["updated_at"] = time.Now()
+	query := db.Model(model).Where("id = ?", id)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Updates(values)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return versionError(db, model, id)
+	}
+	return nil
+}
+
+// restore clears deleted_at on the soft-deleted row id of model.
+func restore(db *gorm.DB, model any, id int) error {
+	result := db.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(map[string]any{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// versionError tells why a versioned write matched no row.
+func versionError(db *gorm.DB, model any, id int) error {
+	var count int64
+	if err := db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	} else if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrVersionConflict
+}
+
+// touchPersons increments the version of the persons whose ids are given as
+// a slice or a subquery, after a change to their enrollments.
+func touchPersons(db *gorm.DB, ids any) error {
+	return db.Model(&Person{}).Where("id IN (?)", ids).Updates(map[string]any{
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// Conditions selecting the enrollments of one person or course that a
+// replacement rewrites: those in default offerings. Links to soft-deleted
+// rows are left alone, so they come back when the row is restored.
+const (
+	personEnrollments = "person_id = ? AND offering_id IN (" + defaultOfferingIDs + ") AND course_id NOT IN (SELECT id FROM course WHERE deleted_at IS NOT NULL)"
+	courseEnrollments = "course_id = ? AND offering_id IN (" + defaultOfferingIDs + ") AND person_id NOT IN (SELECT id FROM person WHERE deleted_at IS NOT NULL)"
+
+	defaultOfferingIDs = "SELECT MIN(id) FROM course_offering GROUP BY course_id"
+)
+
+// defaultOfferings maps each course id to the id of its default offering. It
+// returns ErrNoOffering when a course has none.
+func defaultOfferings(db *gorm.DB, courseIDs []int) (map[int]int, error) {
+	var rows []struct {
+		CourseID int
+		ID       int
+	}
+	courseIDs = uniqueIDs(courseIDs)
+	if len(courseIDs) == 0 {
+		return nil, nil
+	}
+	err := db.Model(&CourseOffering{}).Select("course_id, MIN(id) AS id").
+		Where("course_id IN ?", courseIDs).Group("course_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	offerings := make(map[int]int, len(rows))
+	for _, row := range rows {
+		offerings[row.CourseID] = row.ID
+	}
+	for _, id := range courseIDs {
+		if _, ok := offerings[id]; !ok {
+			return nil, ErrNoOffering
+		}
+	}
+	return offerings, nil
+}
+
+// setPersonEnrollments replaces the default-offering enrollments of a person
+// with the default offerings of courseIDs.
+func setPersonEnrollments(db *gorm.DB, personID int, courseIDs []int) error {
+	offerings, err := defaultOfferings(db, courseIDs)
+	if err != nil {
+		return err
+	}
+	return setEnrollments(db, personEnrollments, personID, personCourses(personID, courseIDs, offerings))
+}
+
+// enroll enrolls a person, or waitlists them when the offering is full, and
+// returns their waitlist entry. e is reloaded when the person enrolled.
+func enroll(db *gorm.DB, e *PersonCourse) (*WaitlistEntry, error) {
+	if err := lockOfferings(db, []int{e.OfferingID}); err != nil {
+		return nil, err
+	}
+	if exists, err := enrolled(db, *e); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, gorm.ErrDuplicatedKey
+	}
+	entry, err := admit(db, *e)
+	if err != nil || entry != nil {
+		return entry, err
+	}
+	if err := db.Where("person_id = ? AND offering_id = ?", e.PersonID, e.OfferingID).First(e).Error; err != nil {
+		return nil, err
+	}
+	return nil, touchPersons(db, []int{e.PersonID})
+}
+
+// release drops a person from an offering, or from its waitlist, and
+// promotes waitlisted students into the freed seat.
+func release(db *gorm.DB, offeringID int, personID int) error {
+	if err := lockOfferings(db, []int{offeringID}); err != nil {
+		return err
+	}
+	result := db.Where("person_id = ? AND offering_id = ?", personID, offeringID).Delete(&PersonCourse{})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		result = db.Where("person_id = ? AND offering_id = ?", personID, offeringID).Delete(&WaitlistEntry{})
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	}
+	if err := touchPersons(db, []int{personID}); err != nil {
+		return err
+	}
+	return promote(db, offeringID)
+}
+
+// lockOfferings locks the rows of offerings until the transaction ends.
+// Every change to the enrollments or waitlist of an offering holds its lock,
+// so concurrent requests count its seats one at a time. Rows are locked in id
+// order, so transactions locking several do not deadlock.
+func lockOfferings(db *gorm.DB, ids []int) error {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	var locked []int
+	return db.Model(&CourseOffering{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("id").Pluck("id", &locked).Error
+}
+
+func enrolled(db *gorm.DB, e PersonCourse) (bool, error) {
+	var count int64
+	err := db.Model(&PersonCourse{}).Where("person_id = ? AND offering_id = ?", e.PersonID, e.OfferingID).Count(&count).Error
+	return count > 0, err
+}
+
+// admit inserts the enrollment, or a waitlist entry when it is in the
+// student role and the offering is full, which it returns. It does not touch
+// the person. The offering must be locked.
+func admit(db *gorm.DB, e PersonCourse) (*WaitlistEntry, error) {
+	var waitlisted int64
+	if err := db.Model(&WaitlistEntry{}).Where("person_id = ? AND offering_id = ?", e.PersonID, e.OfferingID).Count(&waitlisted).Error; err != nil {
+		return nil, err
+	} else if waitlisted > 0 {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	personType, err := personType(db, e.PersonID)
+	if err != nil {
+		return nil, err
+	}
+	if e.Role == "" {
+		e.Role = defaultRole(personType)
+	}
+	seat := e.Role != RoleStudent
+	if !seat {
+		if seat, err = hasSeat(db, e.OfferingID); err != nil {
+			return nil, err
+		}
+	}
+	if seat {
+		e.PersonType, e.EnrolledAt = personType, time.Now()
+		return nil, db.Create(&e).Error
+	}
+
+	entry := WaitlistEntry{PersonID: e.PersonID, CourseID: e.CourseID, OfferingID: e.OfferingID, CreatedAt: time.Now()}
+	if err := db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	entry.Position, err = waitlistPosition(db, entry)
+	return &entry, err
+}
+
+// promote enrolls the first waitlisted students of an offering while it has
+// seats. Soft-deleted students, and students whose schedule the offering
+// would overlap, keep their place in line but are passed over; the latter
+// are held with the reason. The offering must be locked.
+func promote(db *gorm.DB, offeringID int) error {
+	var entries []WaitlistEntry
+	err := db.Where("offering_id = ? AND person_id NOT IN (SELECT id FROM person WHERE deleted_at IS NOT NULL)", offeringID).
+		Order("id").Find(&entries).Error
+	if err != nil {
+		return err
+	}
+	for _, next := range entries {
+		if seat, err := hasSeat(db, offeringID); err != nil || !seat {
+			return err
+		}
+		if reason, held, err := scheduleHoldOf(db, next); err != nil {
+			return err
+		} else if held {
+			if err := db.Model(&next).Update("hold_reason", reason).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := db.Delete(&next).Error; err != nil {
+			return err
+		}
+		personType, err := personType(db, next.PersonID)
+		if err != nil {
+			return err
+		}
+		e := PersonCourse{PersonID: next.PersonID, CourseID: next.CourseID, OfferingID: offeringID, Role: RoleStudent, PersonType: personType, EnrolledAt: time.Now()}
+		if err := db.Create(&e).Error; err != nil {
+			return err
+		}
+		if err := touchPersons(db, []int{next.PersonID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleHoldOf returns the hold reason of a waitlist entry whose offering
+// meets at the same time as one its person is enrolled in.
+func scheduleHoldOf(db *gorm.DB, entry WaitlistEntry) (string, bool, error) {
+	var meetings []Meeting
+	if err := db.Where("offering_id = ?", entry.OfferingID).Find(&meetings).Error; err != nil || len(meetings) == 0 {
+		return "", false, err
+	}
+	var booked []Meeting
+	err := db.Select("meeting.*").Joins("JOIN course_offering ON course_offering.id = meeting.offering_id").
+		Joins("JOIN person_course ON person_course.offering_id = meeting.offering_id").
+		Where("person_course.person_id = ? AND meeting.offering_id <> ?", entry.PersonID, entry.OfferingID).
+		Where("course_offering.term_id = (SELECT term_id FROM course_offering WHERE id = ?)", entry.OfferingID).
+		Where("course_offering.course_id NOT IN (SELECT id FROM course WHERE deleted_at IS NOT NULL)").
+		Order("meeting.id").Find(&booked).Error
+	if err != nil {
+		return "", false, err
+	}
+	reason, held := scheduleHold(meetings, booked)
+	return reason, held, nil
+}
+
+// hasSeat reports whether an offering admits another student: its course has
+// no capacity or fewer enrollments of persons in the student role than it.
+// Soft-deleted persons do not hold seats.
+func hasSeat(db *gorm.DB, offeringID int) (bool, error) {
+	var capacity *int
+	err := db.Raw("SELECT course.capacity FROM course_offering JOIN course ON course.id = course_offering.course_id WHERE course_offering.id = ?", offeringID).
+		Row().Scan(&capacity)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && capacity == nil) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	var students int64
+	err = db.Model(&PersonCourse{}).Where("offering_id = ? AND role = ?", offeringID, RoleStudent).
+		Where("person_id NOT IN (SELECT id FROM person WHERE deleted_at IS NOT NULL)").Count(&students).Error
+	return students < int64(*capacity), err
+}
+
+// studentOfferingIDs returns the ids of the offerings a person is enrolled in
+// as a student, in order.
+func studentOfferingIDs(db *gorm.DB, personID int) ([]int, error) {
+	var ids []int
+	err := db.Model(&PersonCourse{}).Where("person_id = ? AND role = ?", personID, RoleStudent).Order("offering_id").Pluck("offering_id", &ids).Error
+	return ids, err
+}
+
+// personType returns the type of a person, deleted or not, for the
+// person_course row enrolling them. A missing person breaks its foreign key.
+func personType(db *gorm.DB, personID int) (string, error) {
+	var person Person
+	err := db.Unscoped().Select("id", "type").First(&person, personID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", gorm.ErrForeignKeyViolated
+	}
+	return person.Type, err
+}
+
+// waitlistPosition ranks entry among the entries of its offering.
+func waitlistPosition(db *gorm.DB, entry WaitlistEntry) (int, error) {
+	var position int64
+	err := db.Model(&WaitlistEntry{}).Where("offering_id = ? AND id <= ?", entry.OfferingID, entry.ID).Count(&position).Error
+	return int(position), err
+}
+
+// setChairType sets the chair_type column the chair foreign key
+// pairs with chair_id. A chair that is not a professor violates the key.
+func setChairType(department *Department) {
+	department.ChairType = nil
+	if department.ChairID != nil {
+		chairType := "professor"
+		department.ChairType = &chairType
+	}
+}
+
+// endAdvisorAssignments ends the current advisor assignments matching query,
+// clearing the type columns that tie their persons to their types. It returns
+// gorm.ErrRecordNotFound when there is none.
+func endAdvisorAssignments(query *gorm.DB, at time.Time) error {
+	result := query.Model(&AdvisorAssignment{}).Where("ended_at IS NULL").Updates(map[string]any{
+		"ended_at":     at,
+		"student_type": nil,
+		"advisor_type": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// deleteRow deletes the row id of model, returning gorm.ErrRecordNotFound
+// when there is none.
+func deleteRow(db *gorm.DB, model any, id int) error {
+	result := db.Delete(model, id)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// setEnrollments deletes the person_course rows matching the condition that
+// are not among rows and admits the rows that are new, then fills the seats
+// the deletions freed.
+func setEnrollments(db *gorm.DB, condition string, id int, rows []PersonCourse) error {
+	var offeringIDs []int
+	if err := db.Model(&PersonCourse{}).Where(condition, id).Pluck("offering_id", &offeringIDs).Error; err != nil {
+		return err
+	}
+	for _, e := range rows {
+		offeringIDs = append(offeringIDs, e.OfferingID)
+	}
+	if err := lockOfferings(db, offeringIDs); err != nil {
+		return err
+	}
+
+	var current []PersonCourse
+	if err := db.Where(condition, id).Find(&current).Error; err != nil {
+		return err
+	}
+	var stale [][]any
+	var freed []int
+	for _, e := range current {
+		if !slices.ContainsFunc(rows, func(row PersonCourse) bool { return row.PersonID == e.PersonID && row.OfferingID == e.OfferingID }) {
+			stale = append(stale, []any{e.PersonID, e.OfferingID})
+			freed = append(freed, e.OfferingID)
+		}
+	}
+	if len(stale) > 0 {
+		if err := db.Where("(person_id, offering_id) IN ?", stale).Delete(&PersonCourse{}).Error; err != nil {
+			return err
+		}
+	}
+	freed = uniqueIDs(freed)
+	slices.Sort(freed)
+	for _, e := range rows {
+		if exists, err := enrolled(db, e); err != nil {
+			return err
+		} else if exists {
+			continue
+		}
+		if _, err := admit(db, e); err != nil && !errors.Is(err, ErrAlreadyWaitlisted) {
+			return err
+		}
+	}
+	for _, offeringID := range freed {
+		if err := promote(db, offeringID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPage orders query as described by page, then by id, and selects the
+// page window. Sort columns come from a whitelist, so they are safe to
+// interpolate.
+func applyPage(query *gorm.DB, table string, page Page) *gorm.DB {
+	for _, field := range page.Sort {
+		direction := "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		query = query.Order(fmt.Sprintf("%v.%v %v", table, field.Column, direction))
+	}
+	query = query.Order(table + ".id ASC")
+
+	if page.After != nil {
+		// Keyset condition for a mixed-direction sort:
+		// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?)
+		columns := make([]string, 0, len(page.Sort)+1)
+		operators := make([]string, 0, len(page.Sort)+1)
+		for _, field := range page.Sort {
+			columns = append(columns, table+"."+field.Column)
+			if field.Desc {
+				operators = append(operators, "<")
+			} else {
+				operators = append(operators, ">")
+			}
+		}
+		columns = append(columns, table+".id")
+		operators = append(operators, ">")
+
+		var clauses []string
+		var args []any
+		for i := range columns {
+			var terms []string
+			for j := 0; j < i; j++ {
+				terms = append(terms, columns[j]+" = ?")
+				args = append(args, page.After[j])
+			}
+			terms = append(terms, columns[i]+" "+operators[i]+" ?")
+			args = append(args, page.After[i])
+			clauses = append(clauses, "("+strings.Join(terms, " AND ")+")")
+		}
+		query = query.Where(strings.Join(clauses, " OR "), args...)
+	} else if page.Offset > 0 {
+		query = query.Offset(page.Offset)
+	}
+
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit)
+	}
+	return query
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied value.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
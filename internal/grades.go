@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Grades: /api/offering/{id}/persons/{personId}/grade and
+/api/person/{id}/transcript.
+
+Instructors of an offering, authenticated by their access token, or admins
+grade the students enrolled in it. The audit log records grade changes as
+made by the authenticated person or admin, whatever the X-Actor header says.
+A grade can be amended at any time, but amending one after the term has
+ended requires a reason, which the audit log keeps with the change.
+
+Transcripts group the graded and ungraded courses of a student by term. GPAs
+weigh the grade points of each course by its credit hours and leave out
+grades without points; they are null until such a grade exists.
+*/
+
+var (
+	errForbidden     = errors.New("not allowed to grade the offering")
+	errMissingReason = errors.New("grade change after the term requires a reason")
+)
+
+// SetGrade posts or amends the grade of a student in an offering. It answers
+// 201 for a first grade and 200 for an amendment.
+func (s *Server) SetGrade(w http.ResponseWriter, r *http.Request) {
+	admin := s.isAdmin(r)
+	actor, instructorID := AdminActor, 0
+	if !admin {
+		instructor, ok := s.authenticatedPerson(w, r)
+		if !ok {
+			return
+		}
+		actor, instructorID = personActor(instructor.ID), instructor.ID
+	}
+	personID, err := ParseIntParam(w, r, "personId")
+	if err != nil {
+		return
+	}
+	var req GradeRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+	if !writeValidationProblem(w, Validate(req)) {
+		return
+	}
+	term, err := s.store.GetTerm(offering.TermID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+
+	var e PersonCourse
+	var amended bool
+	err = Audited(s.store, actor).Transaction(func(tx Store) error {
+		if !admin {
+			instructors, err := tx.ListEnrollments(EnrollmentFilter{PersonID: instructorID, OfferingID: offering.ID, Role: RoleInstructor})
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
+				return err
+			}
+			if len(instructors) == 0 {
+				WriteProblem(w, http.StatusForbidden, CodeForbidden, "Only an instructor of offering '%v' or an admin can grade it.", offering.ID)
+				return errForbidden
+			}
+		}
+		current, err := tx.ListEnrollments(EnrollmentFilter{PersonID: personID, OfferingID: offering.ID, Role: RoleStudent})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		if len(current) == 0 {
+			WriteProblem(w, http.StatusNotFound, CodeNotEnrolled, "Person with id '%v' is not enrolled as a student in offering '%v'.", personID, offering.ID)
+			return gorm.ErrRecordNotFound
+		}
+		amended = current[0].Grade != nil
+		if amended && termEnded(term) && req.Reason == "" {
+			writeValidationProblem(w, []FieldError{{Field: "reason", Code: "required", Message: "Is required to change a grade after the term has ended."}})
+			return errMissingReason
+		}
+		e, err = tx.SetGrade(GradeChange{PersonID: personID, OfferingID: offering.ID, Grade: req.Grade, Reason: req.Reason})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+	if !amended {
+		render.Status(r, http.StatusCreated)
+	}
+	render.JSON(w, r, e)
+}
+
+// GetPersonTranscript lists the courses a student took, by term, with term
+// and cumulative GPAs. Only students have transcripts.
+func (s *Server) GetPersonTranscript(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	if person.Type != "student" {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' is not a student, so they have no transcript.", person.ID)
+		return
+	}
+
+	transcript, err := buildTranscript(s.store, person.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, transcript)
+}
+
+// buildTranscript groups the student enrollments of a person by term, in
+// term order, and computes the GPAs.
+func buildTranscript(store Store, personID int) (Transcript, error) {
+	enrollments, err := store.ListEnrollments(EnrollmentFilter{PersonID: personID, Role: RoleStudent})
+	if err != nil {
+		return Transcript{}, err
+	}
+	offerings, err := store.ListPersonOfferings(personID)
+	if err != nil {
+		return Transcript{}, err
+	}
+	byID := make(map[int]CourseOffering, len(offerings))
+	for _, offering := range offerings {
+		byID[offering.ID] = offering
+	}
+
+	terms := map[int]*TranscriptTerm{}
+	courses := map[int]Course{}
+	for _, e := range enrollments {
+		offering := byID[e.OfferingID]
+		term, ok := terms[offering.TermID]
+		if !ok {
+			t, err := store.GetTerm(offering.TermID)
+			if err != nil {
+				return Transcript{}, err
+			}
+			term = &TranscriptTerm{TermID: t.ID, Name: t.Name, StartDate: t.StartDate, EndDate: t.EndDate, Courses: []TranscriptCourse{}}
+			terms[t.ID] = term
+		}
+		course, ok := courses[e.CourseID]
+		if !ok {
+			if course, err = store.GetCourse(e.CourseID); err != nil {
+				return Transcript{}, err
+			}
+			courses[course.ID] = course
+		}
+		term.Courses = append(term.Courses, TranscriptCourse{
+			CourseID:    course.ID,
+			Name:        course.Name,
+			OfferingID:  offering.ID,
+			Section:     offering.Section,
+			CreditHours: course.CreditHours,
+			Grade:       e.Grade,
+			GradePoints: e.GradePoints,
+		})
+	}
+
+	transcript := Transcript{PersonID: personID, Terms: []TranscriptTerm{}}
+	ordered := make([]*TranscriptTerm, 0, len(terms))
+	for _, term := range terms {
+		ordered = append(ordered, term)
+	}
+	slices.SortFunc(ordered, func(a, b *TranscriptTerm) int {
+		if c := a.StartDate.Compare(b.StartDate.Time); c != 0 {
+			return c
+		}
+		return a.TermID - b.TermID
+	})
+	var total gpa
+	for _, term := range ordered {
+		var termGPA gpa
+		for _, course := range term.Courses {
+			term.CreditHours += course.CreditHours
+			termGPA.add(course)
+			total.add(course)
+		}
+		term.GPA, term.CumulativeGPA = termGPA.value(), total.value()
+		transcript.CreditHours += term.CreditHours
+		transcript.Terms = append(transcript.Terms, *term)
+	}
+	transcript.GPA = total.value()
+	return transcript, nil
+}
+
+// gpa accumulates credit-weighted grade points.
+type gpa struct {
+	points  float64
+	credits int
+}
+
+func (g *gpa) add(course TranscriptCourse) {
+	if course.GradePoints == nil {
+		return
+	}
+	g.points += *course.GradePoints * float64(course.CreditHours)
+	g.credits += course.CreditHours
+}
+
+// value is the GPA rounded to two decimals, or nil when no credit hours
+// carry grade points.
+func (g gpa) value() *float64 {
+	if g.credits == 0 {
+		return nil
+	}
+	value := math.Round(g.points/float64(g.credits)*100) / 100
+	return &value
+}
+
+// termEnded reports whether the last day of term is over.
+func termEnded(term Term) bool {
+	return time.Now().After(term.EndDate.AddDate(0, 0, 1))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -31,50 +32,49 @@ func ParseIntQuery(w http.ResponseWriter, r *http.Request, key string) (int, err
 func ParseInt(w http.ResponseWriter, r *http.Request, val string, errMessage string) (int, error) {
 	num, err := strconv.ParseInt(val, 10, 0)
 	if err != nil {
-		http.Error(w, errMessage, http.StatusBadRequest)
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "%v", errMessage)
 		return -1, err
 	} else {
 		return int(num), nil
 	}
 }
 
-func QueryName(w http.ResponseWriter, db *gorm.DB, name string) (query *gorm.DB, err error) {
-	name = strings.ToLower(name)
-	names := strings.Split(name, " ")
-	if len(names) != 2 {
-		http.Error(w, "Name must be of format 'First Last'.", http.StatusBadRequest)
-		return query, errors.New("name must be of format 'First Last'")
+// ParseName normalizes a "First Last" person name for FindPersonsByName:
+// lower case, with runs of whitespace collapsed, so multi-word names such as
+// "Mary Ann Smith" or "Juan de la Cruz" can be addressed.
+func ParseName(w http.ResponseWriter, name string) (string, error) {
+	names := strings.Fields(strings.ToLower(name))
+	if len(names) < 2 {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Name must be of format 'First Last'.")
+		return "", errors.New("name must be of format 'First Last'")
 	}
-	first, last := names[0], names[1]
-	query = db.Where("LOWER(first_name) = ? AND LOWER(last_name) = ?", first, last)
-	return query, nil
+	return strings.Join(names, " "), nil
 }
 
 func CheckJSON(w http.ResponseWriter, r *http.Request, v any) error {
-	ct := r.Header.Get("Content-Type")
-	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
-	switch mediaType {
+	switch mediaType(r) {
 	case "application/json":
 		dec := json.NewDecoder(r.Body)
 		dec.DisallowUnknownFields()
 		err := dec.Decode(&v)
 		if err != nil {
-			Out(err)
-			http.Error(w, "Request body is not valid JSON", http.StatusBadRequest)
+			writeInvalidJSON(w, err)
 		}
 		return err
 	default:
 		msg := "Content-Type header is not application/json"
-		http.Error(w, msg, http.StatusUnsupportedMediaType)
+		WriteProblem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "%v.", msg)
 		return errors.New(msg)
 	}
 }
 
 func HandleDBError(w http.ResponseWriter, err error) error {
 	if err != nil {
-		switch err {
-		case gorm.ErrDuplicatedKey:
-			http.Error(w, "JSON body conflicts with existing course data", http.StatusBadRequest)
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			WriteProblem(w, http.StatusConflict, CodeConflict, "JSON body conflicts with existing course data.")
+		default:
+			HandleDBErrorGeneric(w, err)
 		}
 	}
 	return err
@@ -83,7 +83,49 @@ func HandleDBError(w http.ResponseWriter, err error) error {
 func HandleDBErrorGeneric(w http.ResponseWriter, err error) error {
 	if err != nil {
 		Out(err)
-		http.Error(w, "Internal SQL Exception", http.StatusInternalServerError)
+		WriteProblem(w, http.StatusInternalServerError, CodeInternal, "Internal SQL Exception")
 	}
 	return err
 }
+
+// mediaType returns the lower-cased media type of the request Content-Type,
+// without parameters.
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	return strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+}
+
+// writeInvalidJSON writes the 400 for a body that could not be decoded,
+// naming the offending field when the error points at one.
+func writeInvalidJSON(w http.ResponseWriter, err error) {
+	Out(err)
+	problem := NewProblem(http.StatusBadRequest, CodeInvalidBody, "Request body is not valid JSON.")
+	if fieldErr, ok := jsonFieldError(err); ok {
+		problem.Errors = []FieldError{fieldErr}
+	}
+	problem.Write(w)
+}
+
+// jsonFieldError describes the body field a JSON decoding error points at,
+// when there is one.
+func jsonFieldError(err error) (FieldError, bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldError{Field: typeErr.Field, Code: "type", Message: fmt.Sprintf("Must be of type %v.", typeErr.Type)}, true
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(field, `"`), Code: "unknown", Message: "Unknown field."}, true
+	}
+	return FieldError{}, false
+}
+
+// uniqueIDs returns ids without duplicates, keeping the first occurrence.
+func uniqueIDs(ids []int) []int {
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !slices.Contains(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
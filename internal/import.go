@@ -0,0 +1,483 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+)
+
+/*
+Bulk import: POST /api/import and the import command.
+
+An import reads CSV files of courses, persons and enrollments, in that order,
+so enrollments can name the courses and persons imported with them. Each file
+starts with a header row naming its columns, in any order:
+
+	courses      name, and optionally department, number, credit_hours and
+	             capacity
+	persons      first_name, last_name, type and age, and optionally
+	             department and major
+	enrollments  person and course, and optionally role
+
+Departments and majors are given by code, persons by their "First Last" name
+and courses by code ("CS 101") or name, ignoring case. The columns only CSV
+exports have, such as id, are ignored, so an export of courses or persons
+imports as it is.
+
+Every row goes through the checks the API makes when creating the same
+course, person or enrollment, against the rows imported before it. The
+import runs in one transaction and is all-or-nothing: a row that fails is
+reported with its line and the problem the API would have answered, and
+nothing is written. A dry run reports the same, then rolls back.
+*/
+
+// Import files, named like the multipart parts and command flags that carry
+// them.
+const (
+	ImportCourses     = "courses"
+	ImportPersons     = "persons"
+	ImportEnrollments = "enrollments"
+)
+
+var ImportFileNames = []string{ImportCourses, ImportPersons, ImportEnrollments}
+
+// maxImportSize bounds the body of POST /api/import.
+const maxImportSize = 32 << 20
+
+var (
+	// errImportRolledBack rolls back the transaction of a dry run or of an
+	// import with failed rows.
+	errImportRolledBack = errors.New("import rolled back")
+	// errInvalidRow rolls back a row that failed validation.
+	errInvalidRow = errors.New("row failed validation")
+)
+
+// ImportFiles holds the CSV files of an import, keyed by ImportFileNames. Any
+// may be missing.
+type ImportFiles map[string]io.Reader
+
+type ImportOptions struct {
+	DryRun bool
+	// OverridePrerequisites imports enrollments of students who lack
+	// prerequisites, like override_prerequisites does for admins.
+	OverridePrerequisites bool
+}
+
+// Import reads files into store in one transaction. It commits only when
+// every row succeeds and the import is not a dry run; otherwise it rolls back
+// and the report lists the failed rows. The returned error is a failure of
+// the store, not of a row.
+func Import(store Store, files ImportFiles, options ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: options.DryRun, Errors: []ImportError{}}
+	err := store.Transaction(func(tx Store) error {
+		im := importer{tx: tx, options: options, report: &report}
+		steps := []struct {
+			name    string
+			columns []string
+			row     func(row Store, w http.ResponseWriter, values map[string]string) error
+		}{
+			{ImportCourses, []string{"name", "department", "number", "credit_hours", "capacity"}, im.course},
+			{ImportPersons, []string{"first_name", "last_name", "type", "age", "department", "major"}, im.person},
+			{ImportEnrollments, []string{"person", "course", "role"}, im.enrollment},
+		}
+		if err := im.loadReferences(); err != nil {
+			return err
+		}
+		for _, step := range steps {
+			if files[step.name] == nil {
+				continue
+			}
+			if err := im.file(step.name, files[step.name], step.columns, step.row); err != nil {
+				return err
+			}
+		}
+		if options.DryRun || len(report.Errors) > 0 {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if errors.Is(err, errImportRolledBack) {
+		err = nil
+	}
+	return report, err
+}
+
+// importRequired lists the columns each file must have.
+var importRequired = map[string][]string{
+	ImportCourses:     {"name"},
+	ImportPersons:     {"first_name", "last_name", "type", "age"},
+	ImportEnrollments: {"person", "course"},
+}
+
+// importIgnored lists the columns of CSV exports that each file accepts
+// and ignores: ids, and what the store derives or enrollments set.
+var importIgnored = map[string][]string{
+	ImportCourses: {"id", "code", "instructors", "student_count"},
+	ImportPersons: {"id", "courses"},
+}
+
+type importer struct {
+	tx      Store
+	options ImportOptions
+	report  *ImportReport
+	// departments and programs map codes to ids, and courses holds every
+	// course once the courses file is imported.
+	departments map[string]int
+	programs    map[string]int
+	courses     []Course
+}
+
+func (im *importer) loadReferences() error {
+	departments, _, err := im.tx.ListDepartments(Page{})
+	if err != nil {
+		return err
+	}
+	programs, _, err := im.tx.ListPrograms(ProgramFilter{}, Page{})
+	if err != nil {
+		return err
+	}
+	im.departments, im.programs = map[string]int{}, map[string]int{}
+	for _, department := range departments {
+		im.departments[strings.ToUpper(department.Code)] = department.ID
+	}
+	for _, program := range programs {
+		im.programs[strings.ToUpper(program.Code)] = program.ID
+	}
+	return nil
+}
+
+// file imports the rows of one CSV file, each in its own nested transaction
+// so a failed row leaves the others in place. It only returns errors of the
+// store; the problems of rows go to the report.
+func (im *importer) file(name string, r io.Reader, columns []string, row func(row Store, w http.ResponseWriter, values map[string]string) error) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		im.fail(name, csvLine(err, 1), NewProblem(http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Invalid CSV: %v.", err)))
+		return nil
+	}
+	// Spreadsheets often start their exports with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	if !im.checkHeader(name, header, columns) {
+		return nil
+	}
+
+	if name == ImportEnrollments {
+		if im.courses, _, err = im.tx.ListCourses(CourseFilter{}, Page{}); err != nil {
+			return err
+		}
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			// The rest of the file cannot be read reliably.
+			im.fail(name, csvLine(err, 0), NewProblem(http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("Invalid CSV: %v.", err)))
+			return nil
+		}
+		line, _ := reader.FieldPos(0)
+		values := map[string]string{}
+		for i, column := range header {
+			values[strings.ToLower(strings.TrimSpace(column))] = strings.TrimSpace(record[i])
+		}
+
+		rec := &problemRecorder{}
+		err = im.tx.Transaction(func(tx Store) error {
+			return row(tx, rec, values)
+		})
+		problem := rec.problem()
+		if problem == nil && err != nil || problem != nil && problem.Status >= http.StatusInternalServerError {
+			return err
+		} else if problem != nil {
+			im.fail(name, line, problem)
+		}
+	}
+}
+
+// checkHeader reports unknown and missing columns of a header on line 1.
+// Ignored columns are neither.
+func (im *importer) checkHeader(name string, header []string, columns []string) bool {
+	var errs []FieldError
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(columns, column) && !slices.Contains(importIgnored[name], column) {
+			errs = append(errs, FieldError{Field: column, Code: "unknown", Message: fmt.Sprintf("Unknown column. Must be one of '%v'.", strings.Join(columns, "', '"))})
+		} else if slices.ContainsFunc(header[:i], func(other string) bool { return strings.EqualFold(strings.TrimSpace(other), column) }) {
+			errs = append(errs, FieldError{Field: column, Code: "unique", Message: "Column appears more than once."})
+		}
+	}
+	for _, column := range importRequired[name] {
+		if !slices.ContainsFunc(header, func(other string) bool { return strings.EqualFold(strings.TrimSpace(other), column) }) {
+			errs = append(errs, FieldError{Field: column, Code: "required", Message: "Column is required."})
+		}
+	}
+	if len(errs) == 0 {
+		return true
+	}
+	problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, "Header row failed validation.")
+	problem.Errors = errs
+	im.fail(name, 1, problem)
+	return false
+}
+
+func (im *importer) fail(name string, line int, problem *Problem) {
+	im.report.Errors = append(im.report.Errors, ImportError{
+		File:   name,
+		Line:   line,
+		Code:   problem.Code,
+		Detail: problem.Detail,
+		Errors: problem.Errors,
+	})
+}
+
+// course creates the course of a row of the courses file, checked like
+// POST /api/course.
+func (im *importer) course(row Store, w http.ResponseWriter, values map[string]string) error {
+	course := Course{Name: values["name"], Number: values["number"]}
+	var errs []FieldError
+	course.DepartmentID = im.code(values, "department", im.departments, "Department", &errs)
+	course.CreditHours = importInt(values, "credit_hours", &errs)
+	if values["capacity"] != "" {
+		capacity := importInt(values, "capacity", &errs)
+		course.Capacity = &capacity
+	}
+	if !writeValidationProblem(w, errs) || !(&Server{store: row}).validateCourse(w, course) {
+		return errInvalidRow
+	}
+	if err := row.CreateCourse(&course); err != nil {
+		return HandleDBErrorGeneric(w, err)
+	}
+	im.report.Imported.Courses++
+	return nil
+}
+
+// person creates the person of a row of the persons file, checked like
+// POST /api/person.
+func (im *importer) person(row Store, w http.ResponseWriter, values map[string]string) error {
+	person := Person{FirstName: values["first_name"], LastName: values["last_name"], Type: values["type"]}
+	var errs []FieldError
+	if values["age"] != "" {
+		age := importInt(values, "age", &errs)
+		person.Age = &age
+	}
+	person.DepartmentID = im.code(values, "department", im.departments, "Department", &errs)
+	person.MajorID = im.code(values, "major", im.programs, "Program", &errs)
+	if !writeValidationProblem(w, errs) || !(&Server{store: row}).validatePerson(w, person) || !writeValidationProblem(w, affiliationErrors(person)) {
+		return errInvalidRow
+	}
+	if err := row.CreatePerson(&person); err != nil {
+		handlePersonWriteError(w, person, err)
+		return err
+	}
+	im.report.Imported.Persons++
+	return nil
+}
+
+// enrollment enrolls the person of a row of the enrollments file in the
+// course, checked like POST /api/person/{id}/courses.
+func (im *importer) enrollment(row Store, w http.ResponseWriter, values map[string]string) error {
+	e := PersonCourse{Role: values["role"]}
+	errs := validateRole(e.Role)
+	if name := strings.Join(strings.Fields(strings.ToLower(values["person"])), " "); strings.Count(name, " ") == 0 {
+		errs = append(errs, FieldError{Field: "person", Code: "format", Message: "Must be of format 'First Last'."})
+	} else if persons, err := row.FindPersonsByName(name); err != nil {
+		return HandleDBErrorGeneric(w, err)
+	} else if len(persons) != 1 {
+		errs = append(errs, importMatchError("person", "Person", values["person"], len(persons)))
+	} else {
+		e.PersonID = persons[0].ID
+	}
+	matches := slices.DeleteFunc(slices.Clone(im.courses), func(course Course) bool {
+		return !strings.EqualFold(course.Code, values["course"]) && !strings.EqualFold(course.Name, values["course"])
+	})
+	if len(matches) != 1 {
+		errs = append(errs, importMatchError("course", "Course", values["course"], len(matches)))
+	} else {
+		e.CourseID = matches[0].ID
+	}
+	if !writeValidationProblem(w, errs) {
+		return errInvalidRow
+	}
+
+	if err := checkEnrollment(w, row, &e, !im.options.OverridePrerequisites); err != nil {
+		return err
+	}
+	entry, err := row.Enroll(&e)
+	if err != nil {
+		handleEnrollError(w, e, err)
+		return err
+	}
+	if entry != nil {
+		im.report.Waitlisted++
+	}
+	im.report.Imported.Enrollments++
+	return nil
+}
+
+// code resolves the code in column to an id, adding an error when it names
+// nothing. It returns nil when the column is empty.
+func (im *importer) code(values map[string]string, column string, ids map[string]int, kind string, errs *[]FieldError) *int {
+	code := strings.ToUpper(values[column])
+	if code == "" {
+		return nil
+	}
+	id, ok := ids[code]
+	if !ok {
+		*errs = append(*errs, FieldError{Field: column, Code: "exists", Message: fmt.Sprintf("%v '%v' does not exist.", kind, code)})
+		return nil
+	}
+	return &id
+}
+
+// importInt parses the integer in column, adding an error when it is not
+// one. An empty column is zero.
+func importInt(values map[string]string, column string, errs *[]FieldError) int {
+	if values[column] == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(values[column])
+	if err != nil {
+		*errs = append(*errs, FieldError{Field: column, Code: "type", Message: "Must be of type int."})
+	}
+	return n
+}
+
+func importMatchError(column string, kind string, value string, matches int) FieldError {
+	if matches == 0 {
+		return FieldError{Field: column, Code: "exists", Message: fmt.Sprintf("%v '%v' does not exist.", kind, value)}
+	}
+	return FieldError{Field: column, Code: "ambiguous", Message: fmt.Sprintf("%v '%v' matches %d rows.", kind, value, matches)}
+}
+
+// csvLine returns the line a CSV error occurred on, or line when it has none.
+func csvLine(err error, line int) int {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Line
+	}
+	return line
+}
+
+// problemRecorder is a ResponseWriter that keeps the problem the API checks
+// write, so the import can report it against a row instead.
+type problemRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *problemRecorder) Header() http.Header {
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	return r.header
+}
+
+func (r *problemRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *problemRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+// problem returns the recorded problem, or nil when nothing was written.
+func (r *problemRecorder) problem() *Problem {
+	if r.status == 0 {
+		return nil
+	}
+	problem := NewProblem(r.status, CodeInternal, "")
+	if err := json.Unmarshal(r.body.Bytes(), problem); err != nil {
+		problem.Detail = r.body.String()
+	}
+	return problem
+}
+
+// ImportCSV imports the CSV files sent as the courses, persons and
+// enrollments parts of a multipart/form-data body. Admins only. It answers
+// 200 with the report of a dry run, 201 with the one of a committed import
+// and 400 listing the failed rows otherwise.
+func (s *Server) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	for key := range r.URL.Query() {
+		if key != "dry_run" && key != "override_prerequisites" {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return
+		}
+	}
+	var options ImportOptions
+	if val := r.URL.Query().Get("dry_run"); val != "" {
+		var err error
+		if options.DryRun, err = strconv.ParseBool(val); err != nil {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid dry_run '%v' on query parameter. Must be true or false.", val)
+			return
+		}
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
+	options.OverridePrerequisites = !enforced
+
+	if mediaType(r) != "multipart/form-data" {
+		WriteProblem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type header is not multipart/form-data.")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidBody, "Request body is not a valid multipart form of at most %d bytes.", maxImportSize)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := ImportFiles{}
+	for name, headers := range r.MultipartForm.File {
+		if !slices.Contains(ImportFileNames, name) || len(headers) > 1 {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidBody, "Invalid part '%v'. Parts must be one file each of '%v'.", name, strings.Join(ImportFileNames, "', '"))
+			return
+		}
+		file, err := headers[0].Open()
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return
+		}
+		defer file.Close()
+		files[name] = file
+	}
+	if len(files) == 0 {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidBody, "Request body has no file. Send at least one of '%v'.", strings.Join(ImportFileNames, "', '"))
+		return
+	}
+
+	report, err := Import(s.audited(r), files, options)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	switch {
+	case options.DryRun:
+		render.JSON(w, r, report)
+	case len(report.Errors) > 0:
+		problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, fmt.Sprintf("%d rows failed to import, so nothing was imported.", len(report.Errors)))
+		problem.Rows = report.Errors
+		problem.Write(w)
+	default:
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, report)
+	}
+}
@@ -0,0 +1,325 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+)
+
+/*
+Meetings: /api/offering/{id}/meetings and /api/person/{id}/schedule.
+
+Offerings meet weekly on a set of days and times, optionally in a room. A room
+holds one meeting at a time within a term, and a person is never enrolled in
+two offerings of a term whose meetings overlap: both are rejected with a 409
+naming the course already there. Schedules are checked whenever a person is
+enrolled, by any endpoint, and whenever the meetings or term of an offering
+with enrollments change. Promotions from a waitlist pass over the students
+whose schedule would overlap, which the store checks itself.
+*/
+
+var (
+	errRoomConflict     = errors.New("room is already booked")
+	errScheduleConflict = errors.New("meetings overlap the schedule of the person")
+)
+
+func (s *Server) GetOfferingMeetings(w http.ResponseWriter, r *http.Request) {
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+
+	meetings, err := s.store.ListMeetings(MeetingFilter{OfferingIDs: []int{offering.ID}})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if meetings == nil {
+		meetings = []Meeting{}
+	}
+	render.JSON(w, r, meetings)
+}
+
+// ReplaceOfferingMeetings replaces the weekly meetings of an offering.
+func (s *Server) ReplaceOfferingMeetings(w http.ResponseWriter, r *http.Request) {
+	var req MeetingsRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+	if !writeValidationProblem(w, validateMeetings(req.Meetings)) {
+		return
+	}
+
+	meetings := slices.Clone(req.Meetings)
+	if meetings == nil {
+		meetings = []Meeting{}
+	}
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if err := checkRooms(w, tx, offering, meetings); err != nil {
+			return err
+		}
+		if err := tx.SetOfferingMeetings(offering.ID, meetings); err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		return checkOfferingSchedules(w, tx, offering.ID)
+	})
+	if err != nil {
+		return
+	}
+	slices.SortFunc(meetings, compareMeetings)
+	render.JSON(w, r, meetings)
+}
+
+// GetPersonSchedule lists the meetings of the offerings a person is enrolled
+// in as a weekly timetable, optionally for one term.
+func (s *Server) GetPersonSchedule(w http.ResponseWriter, r *http.Request) {
+	termID, ok := parseOptionalInt(w, r, "term_id")
+	if !ok {
+		return
+	}
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	filter := MeetingFilter{}
+	if termID != nil {
+		filter.TermID = *termID
+	}
+	schedule, err := buildSchedule(s.store, person.ID, filter)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, schedule)
+}
+
+// buildSchedule returns the meetings matching filter of the offerings a
+// person is enrolled in, in timetable order.
+func buildSchedule(store Store, personID int, filter MeetingFilter) ([]ScheduleEntry, error) {
+	enrollments, err := store.ListEnrollments(EnrollmentFilter{PersonID: personID})
+	if err != nil {
+		return nil, err
+	}
+	filter.OfferingIDs = make([]int, len(enrollments))
+	roles := make(map[int]string, len(enrollments))
+	for i, e := range enrollments {
+		filter.OfferingIDs[i], roles[e.OfferingID] = e.OfferingID, e.Role
+	}
+	meetings, err := store.ListMeetings(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := []ScheduleEntry{}
+	for _, m := range meetings {
+		offering, err := store.GetOffering(m.OfferingID)
+		if err != nil {
+			return nil, err
+		}
+		course, err := store.GetCourse(offering.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, ScheduleEntry{
+			Meeting:    m,
+			CourseID:   course.ID,
+			CourseName: course.Name,
+			Section:    offering.Section,
+			TermID:     offering.TermID,
+			Role:       roles[m.OfferingID],
+		})
+	}
+	slices.SortStableFunc(schedule, func(a, b ScheduleEntry) int { return compareMeetings(a.Meeting, b.Meeting) })
+	return schedule, nil
+}
+
+// validateMeetings checks the validate rules of each meeting and that it ends
+// after it starts, naming fields after their index in the request.
+func validateMeetings(meetings []Meeting) []FieldError {
+	var errs []FieldError
+	for i, m := range meetings {
+		prefix := fmt.Sprintf("meetings[%d].", i)
+		for _, err := range Validate(m) {
+			err.Field = prefix + err.Field
+			errs = append(errs, err)
+		}
+		if m.EndTime <= m.StartTime {
+			errs = append(errs, FieldError{Field: prefix + "end_time", Code: "after", Message: "Must be after start_time."})
+		}
+	}
+	return errs
+}
+
+// checkRooms writes a 409 when a meeting would double-book its room: when
+// it overlaps another meeting in the room during the term, or one of the
+// other new meetings of the offering. It locks the rooms until tx ends, so
+// the bookings it reads stay valid until the meetings are written.
+func checkRooms(w http.ResponseWriter, tx Store, offering CourseOffering, meetings []Meeting) error {
+	var rooms []string
+	for _, m := range meetings {
+		if m.Room != "" {
+			rooms = append(rooms, m.Room)
+		}
+	}
+	if err := tx.LockRooms(offering.TermID, rooms); err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	for i, m := range meetings {
+		if m.Room == "" {
+			continue
+		}
+		booked, err := tx.ListMeetings(MeetingFilter{TermID: offering.TermID, Room: m.Room})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		booked = slices.DeleteFunc(booked, func(b Meeting) bool { return b.OfferingID == offering.ID })
+		for _, other := range meetings[:i] {
+			if other.Room == m.Room {
+				other.OfferingID = offering.ID
+				booked = append(booked, other)
+			}
+		}
+		for _, b := range booked {
+			if !m.Overlaps(b) {
+				continue
+			}
+			conflict, err := meetingConflict(tx, b)
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
+				return err
+			}
+			problem := NewProblem(http.StatusConflict, CodeRoomConflict, fmt.Sprintf("Room '%v' is already booked on %v by course '%v' (offering '%v').", m.Room, b, conflict.CourseName, b.OfferingID))
+			problem.Conflict = &conflict
+			problem.Write(w)
+			return errRoomConflict
+		}
+	}
+	return nil
+}
+
+// checkSchedule writes a 409 when the offering e enrolls in meets at the
+// same time as another offering of its term that the person is enrolled in.
+// Course-level enrollments, which have no offering yet, check the default
+// offering of the course.
+func checkSchedule(w http.ResponseWriter, tx Store, e PersonCourse) error {
+	offeringID := e.OfferingID
+	if offeringID == 0 {
+		offerings, _, err := tx.ListOfferings(OfferingFilter{CourseID: e.CourseID}, Page{})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		if len(offerings) == 0 {
+			// The enrollment fails with ErrNoOffering.
+			return nil
+		}
+		offeringID = offerings[0].ID
+	}
+	meetings, err := tx.ListMeetings(MeetingFilter{OfferingIDs: []int{offeringID}})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	if len(meetings) == 0 {
+		return nil
+	}
+	enrollments, err := tx.ListEnrollments(EnrollmentFilter{PersonID: e.PersonID})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	offeringIDs := []int{}
+	for _, enrollment := range enrollments {
+		if enrollment.OfferingID != offeringID {
+			offeringIDs = append(offeringIDs, enrollment.OfferingID)
+		}
+	}
+	offering, err := tx.GetOffering(offeringID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	booked, err := tx.ListMeetings(MeetingFilter{OfferingIDs: offeringIDs, TermID: offering.TermID})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	for _, m := range meetings {
+		for _, b := range booked {
+			if !m.Overlaps(b) {
+				continue
+			}
+			conflict, err := meetingConflict(tx, b)
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
+				return err
+			}
+			problem := NewProblem(http.StatusConflict, CodeScheduleConflict, fmt.Sprintf("Offering '%v' meets on %v, overlapping course '%v' (offering '%v') that person with id '%v' is enrolled in.", offeringID, m, conflict.CourseName, b.OfferingID, e.PersonID))
+			problem.Conflict = &conflict
+			problem.Write(w)
+			return errScheduleConflict
+		}
+	}
+	return nil
+}
+
+// checkOfferingSchedules checks the schedule of every person enrolled in an
+// offering, like checkSchedule, once its meetings or term have changed.
+func checkOfferingSchedules(w http.ResponseWriter, tx Store, offeringID int) error {
+	enrollments, err := tx.ListEnrollments(EnrollmentFilter{OfferingID: offeringID})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	for _, e := range enrollments {
+		if err := checkSchedule(w, tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAddedSchedules checks the schedule of each enrollment matching filter
+// that is not among before, like checkSchedule. Callers list before, write
+// the enrollments, then call it in the same transaction, so courses added
+// together that overlap each other conflict too.
+func checkAddedSchedules(w http.ResponseWriter, tx Store, before []PersonCourse, filter EnrollmentFilter) error {
+	after, err := tx.ListEnrollments(filter)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return err
+	}
+	for _, e := range after {
+		if slices.ContainsFunc(before, func(b PersonCourse) bool { return b.PersonID == e.PersonID && b.OfferingID == e.OfferingID }) {
+			continue
+		}
+		if err := checkSchedule(w, tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// meetingConflict describes m with the course of its offering.
+func meetingConflict(store Store, m Meeting) (MeetingConflict, error) {
+	offering, err := store.GetOffering(m.OfferingID)
+	if err != nil {
+		return MeetingConflict{}, err
+	}
+	course, err := store.GetCourse(offering.CourseID)
+	if err != nil {
+		return MeetingConflict{}, err
+	}
+	return MeetingConflict{CourseID: course.ID, CourseName: course.Name, OfferingID: offering.ID, Meeting: m}, nil
+}
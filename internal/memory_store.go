@@ -0,0 +1,1993 @@
+package internal
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore implements Store in memory. It mirrors the Postgres schema
+// closely enough to run the HTTP suite without a database: ids come from
+// per-table sequences that explicit ids do not advance and failed writes do
+// not rewind (like SERIAL), and the primary key, type check and person_course
+// foreign keys are enforced with the same gorm errors the Postgres driver is
+// translated to.
+type MemoryStore struct {
+	state       *memoryState
+	inTx        bool
+	withDeleted bool
+}
+
+type memoryState struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+// memoryData is copied on write, so a saved pointer is a consistent snapshot
+// that a failed transaction can be rolled back to.
+type memoryData struct {
+	courses     map[int]Course
+	persons     map[int]Person
+	terms       map[int]Term
+	departments map[int]Department
+	programs    map[int]Program
+	offerings   map[int]CourseOffering
+	enrollments map[enrollmentKey]PersonCourse
+	meetings    map[int]Meeting
+	// holidays and requirements are keyed by term and program, and
+	// calendarTokens and accessTokens by person.
+	holidays       map[int][]Holiday
+	requirements   map[int][]Requirement
+	calendarTokens map[int]CalendarToken
+	accessTokens   map[int]AccessToken
+	// prerequisites holds the edges of the prerequisite graph.
+	prerequisites map[CoursePrerequisite]struct{}
+	// waitlist is ordered by id, so the entries of an offering are in line.
+	waitlist []WaitlistEntry
+	// advisors is ordered by id, so it is the history of assignments.
+	advisors []AdvisorAssignment
+	audit    []AuditEntry
+	// seq is shared by every copy, so like a Postgres sequence it is not
+	// rolled back with a failed write.
+	seq *memorySequences
+}
+
+// memorySequences holds the last id handed out for each table.
+type memorySequences struct {
+	course   int
+	person   int
+	term     int
+	dept     int
+	program  int
+	req      int
+	advisor  int
+	offering int
+	waitlist int
+	meeting  int
+	audit    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: &memoryState{data: &memoryData{
+		courses:        map[int]Course{},
+		persons:        map[int]Person{},
+		terms:          map[int]Term{},
+		departments:    map[int]Department{},
+		programs:       map[int]Program{},
+		offerings:      map[int]CourseOffering{},
+		enrollments:    map[enrollmentKey]PersonCourse{},
+		meetings:       map[int]Meeting{},
+		holidays:       map[int][]Holiday{},
+		requirements:   map[int][]Requirement{},
+		calendarTokens: map[int]CalendarToken{},
+		accessTokens:   map[int]AccessToken{},
+		prerequisites:  map[CoursePrerequisite]struct{}{},
+		seq:            &memorySequences{},
+	}}}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.courses = maps.Clone(d.courses)
+	c.persons = maps.Clone(d.persons)
+	c.terms = maps.Clone(d.terms)
+	c.departments = maps.Clone(d.departments)
+	c.programs = maps.Clone(d.programs)
+	c.offerings = maps.Clone(d.offerings)
+	c.enrollments = maps.Clone(d.enrollments)
+	c.meetings = maps.Clone(d.meetings)
+	c.holidays = maps.Clone(d.holidays)
+	c.requirements = maps.Clone(d.requirements)
+	c.calendarTokens = maps.Clone(d.calendarTokens)
+	c.accessTokens = maps.Clone(d.accessTokens)
+	c.prerequisites = maps.Clone(d.prerequisites)
+	c.waitlist = slices.Clone(d.waitlist)
+	c.advisors = slices.Clone(d.advisors)
+	// Appends to the copy must not write into the array of the original.
+	c.audit = slices.Clip(d.audit)
+	return &c
+}
+
+// read runs fn against the current data under a read lock.
+func (s *MemoryStore) read(fn func(d *memoryData) error) error {
+	if !s.inTx {
+		s.state.mu.RLock()
+		defer s.state.mu.RUnlock()
+	}
+	return fn(s.state.data)
+}
+
+// write runs fn against a copy of the data and publishes the copy only when
+// fn succeeds, so every write is atomic.
+func (s *MemoryStore) write(fn func(d *memoryData) error) error {
+	if !s.inTx {
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+	}
+	next := s.state.data.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	s.state.data = next
+	return nil
+}
+
+func (s *MemoryStore) Transaction(fn func(tx Store) error) error {
+	if !s.inTx {
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+	}
+	saved := s.state.data
+	if err := fn(&MemoryStore{state: s.state, inTx: true, withDeleted: s.withDeleted}); err != nil {
+		s.state.data = saved
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) WithDeleted() Store {
+	return &MemoryStore{state: s.state, inTx: s.inTx, withDeleted: true}
+}
+
+/*
+Courses.
+*/
+
+func (s *MemoryStore) ListCourses(filter CourseFilter, page Page) ([]Course, int64, error) {
+	var courses []Course
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		var matches []Course
+		for _, course := range sortedValues(s.courses(d)) {
+			if filter.Department != "" && d.departmentCode(course.DepartmentID) != filter.Department {
+				continue
+			}
+			matches = append(matches, course)
+		}
+		courses, total = pageRows(matches, page)
+		for i := range courses {
+			courses[i] = s.withStats(d, courses[i])
+		}
+		return nil
+	})
+	return courses, total, err
+}
+
+func (s *MemoryStore) GetCourse(id int) (Course, error) {
+	var course Course
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if course, ok = s.courses(d)[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		course = s.withStats(d, course)
+		return nil
+	})
+	return course, err
+}
+
+func (s *MemoryStore) CreateCourse(course *Course) error {
+	return s.write(func(d *memoryData) error {
+		if course.ID == 0 {
+			d.seq.course++
+			course.ID = d.seq.course
+		}
+		if _, ok := d.courses[course.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		if err := d.checkCourseNumber(*course); err != nil {
+			return err
+		}
+		course.Version, course.UpdatedAt = 1, time.Now()
+		d.courses[course.ID] = courseRow(*course)
+
+		var latest *Term
+		for _, term := range sortedValues(d.terms) {
+			if latest == nil || !term.StartDate.Before(latest.StartDate.Time) {
+				latest = &term
+			}
+		}
+		if latest != nil {
+			d.seq.offering++
+			d.offerings[d.seq.offering] = CourseOffering{ID: d.seq.offering, CourseID: course.ID, TermID: latest.ID, Section: DefaultSection}
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) UpdateCourse(course *Course) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.courses[course.ID]
+		if !ok || current.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		if err := checkVersion(current.Version, course.Version); err != nil {
+			return err
+		}
+		if err := d.checkCourseNumber(*course); err != nil {
+			return err
+		}
+		course.Version, course.UpdatedAt = current.Version+1, time.Now()
+		d.courses[course.ID] = courseRow(*course)
+		for _, offering := range sortedValues(d.offerings) {
+			if offering.CourseID != course.ID {
+				continue
+			}
+			if err := d.promote(offering.ID); err != nil {
+				return err
+			}
+		}
+		*course = s.withStats(d, d.courses[course.ID])
+		return nil
+	})
+}
+
+func (s *MemoryStore) DeleteCourse(id int, version int) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.courses[id]
+		if !ok || current.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		current.Version, current.UpdatedAt = current.Version+1, time.Now()
+		current.DeletedAt = gorm.DeletedAt{Time: current.UpdatedAt, Valid: true}
+		d.courses[id] = current
+		d.touchPersons(uniqueIDs(d.coursePersonIDs(id))...)
+		return nil
+	})
+}
+
+func (s *MemoryStore) RestoreCourse(id int) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.courses[id]
+		if !ok || !current.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		current.Version, current.UpdatedAt = current.Version+1, time.Now()
+		current.DeletedAt = gorm.DeletedAt{}
+		d.courses[id] = current
+		d.touchPersons(uniqueIDs(d.coursePersonIDs(id))...)
+		return nil
+	})
+}
+
+func (s *MemoryStore) MissingCourseIDs(ids []int) ([]int, error) {
+	var missing []int
+	err := s.read(func(d *memoryData) error {
+		missing = missingKeys(s.courses(d), ids)
+		return nil
+	})
+	return missing, err
+}
+
+/*
+Prerequisites.
+*/
+
+func (s *MemoryStore) ListPrerequisites(courseID int) ([]Course, error) {
+	var courses []Course
+	err := s.read(func(d *memoryData) error {
+		var ids []int
+		for edge := range d.prerequisites {
+			if edge.CourseID == courseID {
+				ids = append(ids, edge.PrerequisiteID)
+			}
+		}
+		courses = s.coursesByID(d, ids)
+		return nil
+	})
+	return courses, err
+}
+
+func (s *MemoryStore) ListPrerequisiteClosure(courseID int) ([]Course, error) {
+	var courses []Course
+	err := s.read(func(d *memoryData) error {
+		courses = s.coursesByID(d, d.prerequisiteClosure(courseID))
+		return nil
+	})
+	return courses, err
+}
+
+func (s *MemoryStore) AddPrerequisite(courseID int, prerequisiteID int) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.courses[courseID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		if _, ok := d.courses[prerequisiteID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		if courseID == prerequisiteID || slices.Contains(d.prerequisiteClosure(prerequisiteID), courseID) {
+			return ErrPrerequisiteCycle
+		}
+		edge := CoursePrerequisite{CourseID: courseID, PrerequisiteID: prerequisiteID}
+		if _, ok := d.prerequisites[edge]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		d.prerequisites[edge] = struct{}{}
+		return nil
+	})
+}
+
+func (s *MemoryStore) RemovePrerequisite(courseID int, prerequisiteID int) error {
+	return s.write(func(d *memoryData) error {
+		edge := CoursePrerequisite{CourseID: courseID, PrerequisiteID: prerequisiteID}
+		if _, ok := d.prerequisites[edge]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		delete(d.prerequisites, edge)
+		return nil
+	})
+}
+
+/*
+Persons.
+*/
+
+func (s *MemoryStore) ListPersons(filter PersonFilter, page Page) ([]Person, int64, error) {
+	var persons []Person
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		var matches []Person
+		for _, person := range sortedValues(s.persons(d)) {
+			if d.matchesFilter(person, filter) {
+				matches = append(matches, person)
+			}
+		}
+		matches, total = pageRows(matches, page)
+		for _, person := range matches {
+			persons = append(persons, s.withCourses(d, person))
+		}
+		return nil
+	})
+	return persons, total, err
+}
+
+func (s *MemoryStore) GetPerson(id int) (Person, error) {
+	var person Person
+	err := s.read(func(d *memoryData) error {
+		current, ok := s.persons(d)[id]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		person = s.withCourses(d, current)
+		return nil
+	})
+	return person, err
+}
+
+func (s *MemoryStore) FindPersonsByName(name string) ([]Person, error) {
+	persons, _, err := s.ListPersons(PersonFilter{Name: name}, Page{})
+	return persons, err
+}
+
+func (s *MemoryStore) CreatePerson(person *Person) error {
+	return s.write(func(d *memoryData) error {
+		if !validPersonType(person.Type) {
+			return gorm.ErrCheckConstraintViolated
+		}
+		if person.ID == 0 {
+			d.seq.person++
+			person.ID = d.seq.person
+		}
+		if _, ok := d.persons[person.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		if err := d.checkAffiliation(*person); err != nil {
+			return err
+		}
+		person.Version, person.UpdatedAt = 1, time.Now()
+		d.persons[person.ID] = personRow(*person)
+		return d.setPersonEnrollments(person.ID, courseIDs(person.Courses))
+	})
+}
+
+func (s *MemoryStore) UpdatePerson(person *Person) error {
+	return s.write(func(d *memoryData) error {
+		stored, ok := d.persons[person.ID]
+		if !ok || stored.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		if err := checkVersion(stored.Version, person.Version); err != nil {
+			return err
+		}
+		if !validPersonType(person.Type) {
+			return gorm.ErrCheckConstraintViolated
+		}
+		if person.Type != "professor" && (d.instructs(person.ID) || d.chairs(person.ID) || d.advises(person.ID)) {
+			return gorm.ErrCheckConstraintViolated
+		}
+		if person.Type != "student" && d.currentAdvisor(person.ID) >= 0 {
+			return gorm.ErrCheckConstraintViolated
+		}
+		if err := d.checkAffiliation(*person); err != nil {
+			return err
+		}
+		current := personRow(*person)
+		current.Version, current.UpdatedAt = stored.Version+1, time.Now()
+		d.persons[person.ID] = current
+		// person_course.person_type follows the type like ON UPDATE CASCADE.
+		for key, e := range d.enrollments {
+			if e.PersonID == person.ID {
+				e.PersonType = person.Type
+				d.enrollments[key] = e
+			}
+		}
+		if person.Courses != nil {
+			if err := d.setPersonEnrollments(person.ID, courseIDs(person.Courses)); err != nil {
+				return err
+			}
+		}
+		*person = s.withCourses(d, current)
+		return nil
+	})
+}
+
+func (s *MemoryStore) DeletePerson(id int, version int) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.persons[id]
+		if !ok || current.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		if err := checkVersion(current.Version, version); err != nil {
+			return err
+		}
+		current.Version, current.UpdatedAt = current.Version+1, time.Now()
+		current.DeletedAt = gorm.DeletedAt{Time: current.UpdatedAt, Valid: true}
+		d.persons[id] = current
+		// The seats of a deleted student go to the waitlist.
+		for _, offeringID := range d.studentOfferingIDs(id) {
+			if err := d.promote(offeringID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) RestorePerson(id int) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.persons[id]
+		if !ok || !current.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		// A restored student whose seat was given away is waitlisted again.
+		for _, offeringID := range d.studentOfferingIDs(id) {
+			if d.hasSeat(offeringID) {
+				continue
+			}
+			e := d.enrollments[enrollmentKey{PersonID: id, OfferingID: offeringID}]
+			delete(d.enrollments, e.key())
+			d.seq.waitlist++
+			d.waitlist = append(d.waitlist, WaitlistEntry{ID: d.seq.waitlist, PersonID: id, CourseID: e.CourseID, OfferingID: offeringID, CreatedAt: time.Now()})
+		}
+		current.Version, current.UpdatedAt = current.Version+1, time.Now()
+		current.DeletedAt = gorm.DeletedAt{}
+		d.persons[id] = current
+		for _, entry := range slices.Clone(d.waitlist) {
+			if entry.PersonID != id {
+				continue
+			}
+			if err := d.promote(entry.OfferingID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) MissingPersonIDs(ids []int) ([]int, error) {
+	var missing []int
+	err := s.read(func(d *memoryData) error {
+		missing = missingKeys(s.persons(d), ids)
+		return nil
+	})
+	return missing, err
+}
+
+/*
+Enrollments.
+*/
+
+func (s *MemoryStore) ListCoursePersons(courseID int, personType string) ([]Person, error) {
+	var persons []Person
+	err := s.read(func(d *memoryData) error {
+		for _, person := range sortedValues(s.persons(d)) {
+			if !d.enrolled(person.ID, courseID) {
+				continue
+			}
+			if personType != "" && person.Type != personType {
+				continue
+			}
+			persons = append(persons, s.withCourses(d, person))
+		}
+		return nil
+	})
+	return persons, err
+}
+
+func (s *MemoryStore) ListEnrollments(filter EnrollmentFilter) ([]PersonCourse, error) {
+	var enrollments []PersonCourse
+	err := s.read(func(d *memoryData) error {
+		persons, courses := s.persons(d), s.courses(d)
+		for _, e := range d.enrollments {
+			if _, ok := persons[e.PersonID]; !ok {
+				continue
+			}
+			if _, ok := courses[e.CourseID]; !ok {
+				continue
+			}
+			if filter.PersonID != 0 && e.PersonID != filter.PersonID ||
+				filter.CourseID != 0 && e.CourseID != filter.CourseID ||
+				filter.OfferingID != 0 && e.OfferingID != filter.OfferingID ||
+				filter.Role != "" && e.Role != filter.Role {
+				continue
+			}
+			enrollments = append(enrollments, e)
+		}
+		return nil
+	})
+	slices.SortFunc(enrollments, func(a, b PersonCourse) int {
+		if a.OfferingID != b.OfferingID {
+			return a.OfferingID - b.OfferingID
+		}
+		return a.PersonID - b.PersonID
+	})
+	return enrollments, err
+}
+
+func (s *MemoryStore) Enroll(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := s.write(func(d *memoryData) error {
+		offerings, err := d.defaultOfferings([]int{e.CourseID})
+		if err != nil {
+			return err
+		}
+		e.OfferingID = offerings[e.CourseID]
+		entry, err = d.enroll(e)
+		return err
+	})
+	return entry, err
+}
+
+func (s *MemoryStore) Drop(courseID int, personID int) error {
+	return s.write(func(d *memoryData) error {
+		offerings, err := d.defaultOfferings([]int{courseID})
+		if err != nil {
+			return err
+		}
+		return d.release(PersonCourse{PersonID: personID, CourseID: courseID, OfferingID: offerings[courseID]})
+	})
+}
+
+func (s *MemoryStore) SetCoursePersons(courseID int, personIDs []int) error {
+	return s.write(func(d *memoryData) error {
+		offerings, err := d.defaultOfferings([]int{courseID})
+		if err != nil {
+			return err
+		}
+		offeringID := offerings[courseID]
+		rows := make([]PersonCourse, 0, len(personIDs))
+		for _, personID := range uniqueIDs(personIDs) {
+			rows = append(rows, PersonCourse{PersonID: personID, CourseID: courseID, OfferingID: offeringID})
+		}
+		touched := append(slices.Clone(personIDs), d.offeringPersonIDs(offeringID)...)
+		remove := func(e PersonCourse) bool {
+			return e.OfferingID == offeringID && !d.persons[e.PersonID].DeletedAt.Valid
+		}
+		if err := d.setEnrollments(rows, remove); err != nil {
+			return err
+		}
+		d.touchPersons(uniqueIDs(touched)...)
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetPersonCourses(personID int, courseIDs []int) error {
+	return s.write(func(d *memoryData) error {
+		if err := d.setPersonEnrollments(personID, courseIDs); err != nil {
+			return err
+		}
+		d.touchPersons(personID)
+		return nil
+	})
+}
+
+func (s *MemoryStore) ListOfferingPersons(offeringID int) ([]Person, error) {
+	var persons []Person
+	err := s.read(func(d *memoryData) error {
+		enrolled := d.offeringPersonIDs(offeringID)
+		for _, person := range sortedValues(s.persons(d)) {
+			if slices.Contains(enrolled, person.ID) {
+				persons = append(persons, s.withCourses(d, person))
+			}
+		}
+		return nil
+	})
+	return persons, err
+}
+
+func (s *MemoryStore) ListPersonOfferings(personID int) ([]CourseOffering, error) {
+	var offerings []CourseOffering
+	err := s.read(func(d *memoryData) error {
+		for _, offering := range sortedValues(s.offerings(d)) {
+			if _, ok := d.enrollments[enrollmentKey{PersonID: personID, OfferingID: offering.ID}]; ok {
+				offerings = append(offerings, offering)
+			}
+		}
+		return nil
+	})
+	return offerings, err
+}
+
+func (s *MemoryStore) EnrollOffering(e *PersonCourse) (*WaitlistEntry, error) {
+	var entry *WaitlistEntry
+	err := s.write(func(d *memoryData) error {
+		offering, ok := d.offerings[e.OfferingID]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		e.CourseID = offering.CourseID
+		var err error
+		entry, err = d.enroll(e)
+		return err
+	})
+	return entry, err
+}
+
+func (s *MemoryStore) DropOffering(offeringID int, personID int) error {
+	return s.write(func(d *memoryData) error {
+		offering, ok := d.offerings[offeringID]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return d.release(PersonCourse{PersonID: personID, CourseID: offering.CourseID, OfferingID: offeringID})
+	})
+}
+
+func (s *MemoryStore) ListWaitlist(offeringID int) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	err := s.read(func(d *memoryData) error {
+		for _, entry := range d.waitlist {
+			if entry.OfferingID == offeringID {
+				entry.Position = len(entries) + 1
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (s *MemoryStore) ListPersonWaitlist(personID int) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	err := s.read(func(d *memoryData) error {
+		for _, entry := range d.waitlist {
+			if entry.PersonID == personID {
+				entry.Position = d.waitlistPosition(entry)
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(entries, func(a, b WaitlistEntry) int { return a.OfferingID - b.OfferingID })
+	return entries, err
+}
+
+func (s *MemoryStore) SetGrade(change GradeChange) (PersonCourse, error) {
+	var e PersonCourse
+	err := s.write(func(d *memoryData) error {
+		var ok bool
+		e, ok = d.enrollments[enrollmentKey{PersonID: change.PersonID, OfferingID: change.OfferingID}]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		if e.Role != RoleStudent {
+			return gorm.ErrCheckConstraintViolated
+		}
+		now := time.Now()
+		e.Grade, e.GradePoints, e.GradedAt = &change.Grade, GradePoints(change.Grade), &now
+		d.enrollments[e.key()] = e
+		return nil
+	})
+	return e, err
+}
+
+/*
+Terms.
+*/
+
+func (s *MemoryStore) ListTerms(page Page) ([]Term, int64, error) {
+	var terms []Term
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		terms, total = pageRows(sortedValues(d.terms), page)
+		return nil
+	})
+	return terms, total, err
+}
+
+func (s *MemoryStore) GetTerm(id int) (Term, error) {
+	var term Term
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if term, ok = d.terms[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return term, err
+}
+
+func (s *MemoryStore) CreateTerm(term *Term) error {
+	return s.write(func(d *memoryData) error {
+		if term.ID == 0 {
+			d.seq.term++
+			term.ID = d.seq.term
+		}
+		if _, ok := d.terms[term.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		return d.putTerm(*term)
+	})
+}
+
+func (s *MemoryStore) UpdateTerm(term *Term) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.terms[term.ID]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return d.putTerm(*term)
+	})
+}
+
+func (s *MemoryStore) DeleteTerm(id int) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.terms[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		for _, offering := range d.offerings {
+			if offering.TermID == id {
+				return gorm.ErrForeignKeyViolated
+			}
+		}
+		delete(d.terms, id)
+		delete(d.holidays, id)
+		return nil
+	})
+}
+
+func (s *MemoryStore) ListHolidays(termID int) ([]Holiday, error) {
+	var holidays []Holiday
+	err := s.read(func(d *memoryData) error {
+		holidays = slices.Clone(d.holidays[termID])
+		return nil
+	})
+	return holidays, err
+}
+
+func (s *MemoryStore) SetTermHolidays(termID int, holidays []Holiday) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.terms[termID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		rows := make([]Holiday, len(holidays))
+		for i := range holidays {
+			holidays[i].TermID = termID
+			rows[i] = holidays[i]
+		}
+		slices.SortFunc(rows, func(a, b Holiday) int { return a.Date.Compare(b.Date.Time) })
+		for i := 1; i < len(rows); i++ {
+			if rows[i].Date.Equal(rows[i-1].Date.Time) {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		d.holidays[termID] = rows
+		return nil
+	})
+}
+
+/*
+Departments.
+*/
+
+func (s *MemoryStore) ListDepartments(page Page) ([]Department, int64, error) {
+	var departments []Department
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		departments, total = pageRows(sortedValues(d.departments), page)
+		return nil
+	})
+	return departments, total, err
+}
+
+func (s *MemoryStore) GetDepartment(id int) (Department, error) {
+	var department Department
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if department, ok = d.departments[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return department, err
+}
+
+func (s *MemoryStore) CreateDepartment(department *Department) error {
+	return s.write(func(d *memoryData) error {
+		if department.ID == 0 {
+			d.seq.dept++
+			department.ID = d.seq.dept
+		}
+		if _, ok := d.departments[department.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		return d.putDepartment(department)
+	})
+}
+
+func (s *MemoryStore) UpdateDepartment(department *Department) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.departments[department.ID]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return d.putDepartment(department)
+	})
+}
+
+func (s *MemoryStore) DeleteDepartment(id int) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.departments[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		for _, program := range d.programs {
+			if program.DepartmentID == id {
+				return gorm.ErrForeignKeyViolated
+			}
+		}
+		for _, course := range d.courses {
+			if course.DepartmentID != nil && *course.DepartmentID == id {
+				return gorm.ErrForeignKeyViolated
+			}
+		}
+		for _, person := range d.persons {
+			if person.DepartmentID != nil && *person.DepartmentID == id {
+				return gorm.ErrForeignKeyViolated
+			}
+		}
+		delete(d.departments, id)
+		return nil
+	})
+}
+
+/*
+Programs.
+*/
+
+func (s *MemoryStore) ListPrograms(filter ProgramFilter, page Page) ([]Program, int64, error) {
+	var programs []Program
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		var matches []Program
+		for _, program := range sortedValues(d.programs) {
+			if filter.DepartmentID != 0 && program.DepartmentID != filter.DepartmentID {
+				continue
+			}
+			matches = append(matches, program)
+		}
+		programs, total = pageRows(matches, page)
+		return nil
+	})
+	return programs, total, err
+}
+
+func (s *MemoryStore) GetProgram(id int) (Program, error) {
+	var program Program
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if program, ok = d.programs[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return program, err
+}
+
+func (s *MemoryStore) CreateProgram(program *Program) error {
+	return s.write(func(d *memoryData) error {
+		if program.ID == 0 {
+			d.seq.program++
+			program.ID = d.seq.program
+		}
+		if _, ok := d.programs[program.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		return d.putProgram(*program)
+	})
+}
+
+func (s *MemoryStore) UpdateProgram(program *Program) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.programs[program.ID]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return d.putProgram(*program)
+	})
+}
+
+func (s *MemoryStore) DeleteProgram(id int) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.programs[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		for _, person := range d.persons {
+			if person.MajorID != nil && *person.MajorID == id {
+				return gorm.ErrForeignKeyViolated
+			}
+		}
+		delete(d.programs, id)
+		delete(d.requirements, id)
+		return nil
+	})
+}
+
+func (s *MemoryStore) ListRequirements(programID int) ([]Requirement, error) {
+	var requirements []Requirement
+	err := s.read(func(d *memoryData) error {
+		for _, requirement := range d.requirements[programID] {
+			requirement.CourseIDs = slices.Clone(requirement.CourseIDs)
+			requirements = append(requirements, requirement)
+		}
+		return nil
+	})
+	return requirements, err
+}
+
+func (s *MemoryStore) SetProgramRequirements(programID int, requirements []Requirement) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.programs[programID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		rows := make([]Requirement, len(requirements))
+		for i := range requirements {
+			if !slices.Contains(RequirementKinds, requirements[i].Kind) {
+				return gorm.ErrCheckConstraintViolated
+			}
+			if len(missingKeys(d.courses, requirements[i].CourseIDs)) > 0 {
+				return gorm.ErrForeignKeyViolated
+			}
+			if len(uniqueIDs(requirements[i].CourseIDs)) < len(requirements[i].CourseIDs) {
+				return gorm.ErrDuplicatedKey
+			}
+			d.seq.req++
+			requirements[i].ID, requirements[i].ProgramID = d.seq.req, programID
+			rows[i] = requirements[i]
+			rows[i].CourseIDs = slices.Clone(requirements[i].CourseIDs)
+			slices.Sort(rows[i].CourseIDs)
+		}
+		d.requirements[programID] = rows
+		return nil
+	})
+}
+
+/*
+Advisors.
+*/
+
+func (s *MemoryStore) ListAdvisorAssignments(filter AdvisorFilter) ([]AdvisorAssignment, error) {
+	var assignments []AdvisorAssignment
+	err := s.read(func(d *memoryData) error {
+		for _, assignment := range d.advisors {
+			if filter.StudentID != 0 && assignment.StudentID != filter.StudentID ||
+				filter.AdvisorID != 0 && assignment.AdvisorID != filter.AdvisorID ||
+				filter.Current && assignment.EndedAt != nil {
+				continue
+			}
+			assignments = append(assignments, assignment)
+		}
+		return nil
+	})
+	return assignments, err
+}
+
+func (s *MemoryStore) AssignAdvisor(assignment *AdvisorAssignment) error {
+	return s.write(func(d *memoryData) error {
+		student, ok := d.persons[assignment.StudentID]
+		if !ok || student.Type != "student" {
+			return gorm.ErrForeignKeyViolated
+		}
+		advisor, ok := d.persons[assignment.AdvisorID]
+		if !ok || advisor.Type != "professor" {
+			return gorm.ErrForeignKeyViolated
+		}
+		now := time.Now()
+		if i := d.currentAdvisor(assignment.StudentID); i >= 0 && d.advisors[i].AdvisorID == assignment.AdvisorID {
+			*assignment = d.advisors[i]
+			return nil
+		} else if i >= 0 {
+			d.endAdvisorAssignment(i, now)
+		}
+		d.seq.advisor++
+		assignment.ID, assignment.StartedAt, assignment.EndedAt = d.seq.advisor, now, nil
+		assignment.StudentType, assignment.AdvisorType = &student.Type, &advisor.Type
+		d.advisors = append(d.advisors, *assignment)
+		return nil
+	})
+}
+
+func (s *MemoryStore) EndAdvisorAssignment(studentID int) error {
+	return s.write(func(d *memoryData) error {
+		i := d.currentAdvisor(studentID)
+		if i < 0 {
+			return gorm.ErrRecordNotFound
+		}
+		d.endAdvisorAssignment(i, time.Now())
+		return nil
+	})
+}
+
+/*
+Offerings.
+*/
+
+func (s *MemoryStore) ListOfferings(filter OfferingFilter, page Page) ([]CourseOffering, int64, error) {
+	var offerings []CourseOffering
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		var matches []CourseOffering
+		for _, offering := range sortedValues(s.offerings(d)) {
+			if filter.CourseID != 0 && offering.CourseID != filter.CourseID ||
+				filter.TermID != 0 && offering.TermID != filter.TermID {
+				continue
+			}
+			matches = append(matches, offering)
+		}
+		offerings, total = pageRows(matches, page)
+		return nil
+	})
+	return offerings, total, err
+}
+
+func (s *MemoryStore) GetOffering(id int) (CourseOffering, error) {
+	var offering CourseOffering
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if offering, ok = s.offerings(d)[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return offering, err
+}
+
+func (s *MemoryStore) CreateOffering(offering *CourseOffering) error {
+	return s.write(func(d *memoryData) error {
+		if offering.ID == 0 {
+			d.seq.offering++
+			offering.ID = d.seq.offering
+		}
+		if _, ok := d.offerings[offering.ID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		return d.putOffering(*offering)
+	})
+}
+
+func (s *MemoryStore) UpdateOffering(offering *CourseOffering) error {
+	return s.write(func(d *memoryData) error {
+		current, ok := d.offerings[offering.ID]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		if offering.CourseID != current.CourseID && d.offeringInUse(offering.ID) {
+			return gorm.ErrForeignKeyViolated
+		}
+		return d.putOffering(*offering)
+	})
+}
+
+func (s *MemoryStore) DeleteOffering(id int) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.offerings[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		if d.offeringInUse(id) {
+			return gorm.ErrForeignKeyViolated
+		}
+		delete(d.offerings, id)
+		maps.DeleteFunc(d.meetings, func(_ int, m Meeting) bool { return m.OfferingID == id })
+		return nil
+	})
+}
+
+/*
+Meetings.
+*/
+
+func (s *MemoryStore) ListMeetings(filter MeetingFilter) ([]Meeting, error) {
+	var meetings []Meeting
+	err := s.read(func(d *memoryData) error {
+		offerings := s.offerings(d)
+		for _, m := range d.meetings {
+			offering, ok := offerings[m.OfferingID]
+			if !ok {
+				continue
+			}
+			if filter.OfferingIDs != nil && !slices.Contains(filter.OfferingIDs, m.OfferingID) ||
+				filter.TermID != 0 && offering.TermID != filter.TermID ||
+				filter.Room != "" && m.Room != filter.Room {
+				continue
+			}
+			meetings = append(meetings, m)
+		}
+		return nil
+	})
+	slices.SortFunc(meetings, func(a, b Meeting) int {
+		if a.OfferingID != b.OfferingID {
+			return a.OfferingID - b.OfferingID
+		}
+		return compareMeetings(a, b)
+	})
+	return meetings, err
+}
+
+func (s *MemoryStore) SetOfferingMeetings(offeringID int, meetings []Meeting) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.offerings[offeringID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		maps.DeleteFunc(d.meetings, func(_ int, m Meeting) bool { return m.OfferingID == offeringID })
+		for i := range meetings {
+			if !slices.Contains(Weekdays, meetings[i].Day) || meetings[i].EndTime <= meetings[i].StartTime {
+				return gorm.ErrCheckConstraintViolated
+			}
+			d.seq.meeting++
+			meetings[i].ID, meetings[i].OfferingID = d.seq.meeting, offeringID
+			d.meetings[d.seq.meeting] = meetings[i]
+		}
+		return nil
+	})
+}
+
+// LockRooms has nothing to do: transactions of the memory store run one at a
+// time.
+func (s *MemoryStore) LockRooms(termID int, rooms []string) error {
+	return nil
+}
+
+/*
+Calendar tokens.
+*/
+
+func (s *MemoryStore) GetCalendarToken(personID int) (CalendarToken, error) {
+	var token CalendarToken
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if token, ok = d.calendarTokens[personID]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return token, err
+}
+
+func (s *MemoryStore) SetCalendarToken(token *CalendarToken) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.persons[token.PersonID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		for _, other := range d.calendarTokens {
+			if other.TokenHash == token.TokenHash && other.PersonID != token.PersonID {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		token.CreatedAt = time.Now()
+		d.calendarTokens[token.PersonID] = *token
+		return nil
+	})
+}
+
+/*
+Access tokens.
+*/
+
+func (s *MemoryStore) GetAccessToken(personID int) (AccessToken, error) {
+	var token AccessToken
+	err := s.read(func(d *memoryData) error {
+		var ok bool
+		if token, ok = d.accessTokens[personID]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return token, err
+}
+
+func (s *MemoryStore) FindAccessToken(tokenHash string) (AccessToken, error) {
+	var token AccessToken
+	err := s.read(func(d *memoryData) error {
+		for _, other := range d.accessTokens {
+			if other.TokenHash == tokenHash {
+				token = other
+				return nil
+			}
+		}
+		return gorm.ErrRecordNotFound
+	})
+	return token, err
+}
+
+func (s *MemoryStore) SetAccessToken(token *AccessToken) error {
+	return s.write(func(d *memoryData) error {
+		if _, ok := d.persons[token.PersonID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		for _, other := range d.accessTokens {
+			if other.TokenHash == token.TokenHash && other.PersonID != token.PersonID {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		token.CreatedAt = time.Now()
+		d.accessTokens[token.PersonID] = *token
+		return nil
+	})
+}
+
+/*
+Audit log.
+*/
+
+func (s *MemoryStore) AppendAudit(entry *AuditEntry) error {
+	return s.write(func(d *memoryData) error {
+		d.seq.audit++
+		entry.ID, entry.OccurredAt = d.seq.audit, time.Now()
+		d.audit = append(d.audit, *entry)
+		return nil
+	})
+}
+
+func (s *MemoryStore) ListAudit(filter AuditFilter, page Page) ([]AuditEntry, int64, error) {
+	var entries []AuditEntry
+	var total int64
+	err := s.read(func(d *memoryData) error {
+		var matches []AuditEntry
+		for _, entry := range d.audit {
+			if filter.Entity != "" && entry.Entity != filter.Entity ||
+				filter.EntityID != 0 && entry.EntityID != filter.EntityID ||
+				filter.Actor != "" && entry.Actor != filter.Actor ||
+				entry.OccurredAt.Before(filter.Since) {
+				continue
+			}
+			matches = append(matches, entry)
+		}
+		entries, total = pageRows(matches, page)
+		return nil
+	})
+	return entries, total, err
+}
+
+/*
+Helpers.
+*/
+
+// courses returns the courses visible to s: soft-deleted ones are hidden
+// unless s is a WithDeleted view.
+func (s *MemoryStore) courses(d *memoryData) map[int]Course {
+	if s.withDeleted {
+		return d.courses
+	}
+	courses := make(map[int]Course, len(d.courses))
+	for id, course := range d.courses {
+		if !course.DeletedAt.Valid {
+			courses[id] = course
+		}
+	}
+	return courses
+}
+
+// persons returns the persons visible to s, like courses.
+func (s *MemoryStore) persons(d *memoryData) map[int]Person {
+	if s.withDeleted {
+		return d.persons
+	}
+	persons := make(map[int]Person, len(d.persons))
+	for id, person := range d.persons {
+		if !person.DeletedAt.Valid {
+			persons[id] = person
+		}
+	}
+	return persons
+}
+
+// offerings returns the offerings visible to s: those of soft-deleted
+// courses are hidden unless s is a WithDeleted view.
+func (s *MemoryStore) offerings(d *memoryData) map[int]CourseOffering {
+	courses := s.courses(d)
+	offerings := make(map[int]CourseOffering, len(d.offerings))
+	for id, offering := range d.offerings {
+		if _, ok := courses[offering.CourseID]; ok {
+			offerings[id] = offering
+		}
+	}
+	return offerings
+}
+
+// withCourses returns person with the courses visible to s that it is
+// enrolled in, ordered by id.
+func (s *MemoryStore) withCourses(d *memoryData, person Person) Person {
+	person.Courses = nil
+	for _, course := range sortedValues(s.courses(d)) {
+		if d.enrolled(person.ID, course.ID) {
+			person.Courses = append(person.Courses, s.withStats(d, course))
+		}
+	}
+	return person
+}
+
+// coursesByID returns the courses visible to s among ids, ordered by id.
+func (s *MemoryStore) coursesByID(d *memoryData, ids []int) []Course {
+	var courses []Course
+	for _, course := range sortedValues(s.courses(d)) {
+		if slices.Contains(ids, course.ID) {
+			courses = append(courses, s.withStats(d, course))
+		}
+	}
+	return courses
+}
+
+// prerequisiteClosure returns the ids of every course a course requires,
+// directly or not.
+func (d *memoryData) prerequisiteClosure(courseID int) []int {
+	var closure []int
+	queue := []int{courseID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for edge := range d.prerequisites {
+			if edge.CourseID == id && !slices.Contains(closure, edge.PrerequisiteID) {
+				closure = append(closure, edge.PrerequisiteID)
+				queue = append(queue, edge.PrerequisiteID)
+			}
+		}
+	}
+	return closure
+}
+
+// withStats returns course with its code, and the instructors and the number
+// of students visible to s among those enrolled in its offerings.
+func (s *MemoryStore) withStats(d *memoryData, course Course) Course {
+	course.Code = courseCode(d.departmentCode(course.DepartmentID), course.Number)
+	course.Instructors, course.StudentCount = []CourseInstructor{}, 0
+	for _, person := range sortedValues(s.persons(d)) {
+		if d.enrolledAs(person.ID, course.ID, RoleInstructor) {
+			course.Instructors = append(course.Instructors, CourseInstructor{ID: person.ID, FirstName: person.FirstName, LastName: person.LastName})
+		}
+		if d.enrolledAs(person.ID, course.ID, RoleStudent) {
+			course.StudentCount++
+		}
+	}
+	return course
+}
+
+// enrollmentKey is the primary key of person_course.
+type enrollmentKey struct {
+	PersonID   int
+	OfferingID int
+}
+
+func (e PersonCourse) key() enrollmentKey {
+	return enrollmentKey{PersonID: e.PersonID, OfferingID: e.OfferingID}
+}
+
+// enrolled reports whether a person is enrolled in any offering of a course.
+func (d *memoryData) enrolled(personID int, courseID int) bool {
+	return d.enrolledAs(personID, courseID, "")
+}
+
+// enrolledAs reports whether a person is enrolled in any offering of a course
+// with role, or with any role when it is empty.
+func (d *memoryData) enrolledAs(personID int, courseID int, role string) bool {
+	for _, e := range d.enrollments {
+		if e.PersonID == personID && e.CourseID == courseID && (role == "" || e.Role == role) {
+			return true
+		}
+	}
+	return false
+}
+
+// instructs reports whether a person instructs any offering.
+func (d *memoryData) instructs(personID int) bool {
+	for _, e := range d.enrollments {
+		if e.PersonID == personID && e.Role == RoleInstructor {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultOfferings maps each course id to the id of its default offering, its
+// first one. It returns ErrNoOffering when a course has none.
+func (d *memoryData) defaultOfferings(courseIDs []int) (map[int]int, error) {
+	offerings := map[int]int{}
+	for _, offering := range sortedValues(d.offerings) {
+		if _, ok := offerings[offering.CourseID]; !ok {
+			offerings[offering.CourseID] = offering.ID
+		}
+	}
+	for _, id := range courseIDs {
+		if _, ok := offerings[id]; !ok {
+			return nil, ErrNoOffering
+		}
+	}
+	return offerings, nil
+}
+
+// setPersonEnrollments replaces the default-offering enrollments of a person
+// with the default offerings of courseIDs. Links to soft-deleted courses are
+// left alone.
+func (d *memoryData) setPersonEnrollments(personID int, courseIDs []int) error {
+	offerings, err := d.defaultOfferings(courseIDs)
+	if err != nil {
+		return err
+	}
+	defaults, _ := d.defaultOfferings(nil)
+	remove := func(e PersonCourse) bool {
+		return e.PersonID == personID && defaults[e.CourseID] == e.OfferingID && !d.courses[e.CourseID].DeletedAt.Valid
+	}
+	return d.setEnrollments(personCourses(personID, courseIDs, offerings), remove)
+}
+
+// coursePersonIDs returns the ids of the persons enrolled in a course, once
+// per offering.
+func (d *memoryData) coursePersonIDs(courseID int) []int {
+	var ids []int
+	for _, e := range d.enrollments {
+		if e.CourseID == courseID {
+			ids = append(ids, e.PersonID)
+		}
+	}
+	return ids
+}
+
+// offeringPersonIDs returns the ids of the persons enrolled in an offering.
+func (d *memoryData) offeringPersonIDs(offeringID int) []int {
+	var ids []int
+	for _, e := range d.enrollments {
+		if e.OfferingID == offeringID {
+			ids = append(ids, e.PersonID)
+		}
+	}
+	return ids
+}
+
+// offeringInUse reports whether rows reference an offering, which its
+// foreign keys then protect.
+func (d *memoryData) offeringInUse(offeringID int) bool {
+	return len(d.offeringPersonIDs(offeringID)) > 0 ||
+		slices.ContainsFunc(d.waitlist, func(entry WaitlistEntry) bool { return entry.OfferingID == offeringID })
+}
+
+// enroll enrolls a person, or waitlists them when the offering is full, and
+// returns their waitlist entry. e is filled in when the person enrolled.
+func (d *memoryData) enroll(e *PersonCourse) (*WaitlistEntry, error) {
+	if _, ok := d.enrollments[e.key()]; ok {
+		return nil, gorm.ErrDuplicatedKey
+	}
+	entry, err := d.admit(*e)
+	if err != nil || entry != nil {
+		return entry, err
+	}
+	*e = d.enrollments[e.key()]
+	d.touchPersons(e.PersonID)
+	return nil, nil
+}
+
+// release drops a person from an offering, or from its waitlist, and
+// promotes waitlisted students into the freed seat.
+func (d *memoryData) release(e PersonCourse) error {
+	if _, ok := d.enrollments[e.key()]; ok {
+		delete(d.enrollments, e.key())
+		d.touchPersons(e.PersonID)
+		return d.promote(e.OfferingID)
+	}
+	i := d.waitlistIndex(e.PersonID, e.OfferingID)
+	if i < 0 {
+		return gorm.ErrRecordNotFound
+	}
+	d.waitlist = slices.Delete(d.waitlist, i, i+1)
+	return nil
+}
+
+// admit inserts the enrollment, or a waitlist entry when it is in the
+// student role and the offering is full, which it returns. It does not touch
+// the person.
+func (d *memoryData) admit(e PersonCourse) (*WaitlistEntry, error) {
+	if d.waitlistIndex(e.PersonID, e.OfferingID) >= 0 {
+		return nil, ErrAlreadyWaitlisted
+	}
+	if e.Role == "" {
+		e.Role = defaultRole(d.persons[e.PersonID].Type)
+	}
+	if e.Role != RoleStudent || d.hasSeat(e.OfferingID) {
+		return nil, d.insertEnrollment(e)
+	}
+	if _, ok := d.persons[e.PersonID]; !ok {
+		return nil, gorm.ErrForeignKeyViolated
+	}
+	if offering, ok := d.offerings[e.OfferingID]; !ok || offering.CourseID != e.CourseID {
+		return nil, gorm.ErrForeignKeyViolated
+	}
+	d.seq.waitlist++
+	entry := WaitlistEntry{ID: d.seq.waitlist, PersonID: e.PersonID, CourseID: e.CourseID, OfferingID: e.OfferingID, CreatedAt: time.Now()}
+	d.waitlist = append(d.waitlist, entry)
+	entry.Position = d.waitlistPosition(entry)
+	return &entry, nil
+}
+
+// promote enrolls the first waitlisted students of an offering while it has
+// seats. Soft-deleted students, and students whose schedule the offering
+// would overlap, keep their place in line but are passed over; the latter
+// are held with the reason.
+func (d *memoryData) promote(offeringID int) error {
+	for i := 0; i < len(d.waitlist) && d.hasSeat(offeringID); {
+		entry := d.waitlist[i]
+		if entry.OfferingID != offeringID || d.persons[entry.PersonID].DeletedAt.Valid {
+			i++
+			continue
+		}
+		if reason, held := d.scheduleHold(entry); held {
+			d.waitlist[i].HoldReason = &reason
+			i++
+			continue
+		}
+		d.waitlist = slices.Delete(d.waitlist, i, i+1)
+		e := PersonCourse{PersonID: entry.PersonID, CourseID: entry.CourseID, OfferingID: offeringID, Role: RoleStudent}
+		if err := d.insertEnrollment(e); err != nil {
+			return err
+		}
+		d.touchPersons(entry.PersonID)
+	}
+	return nil
+}
+
+// scheduleHold returns the hold reason of a waitlist entry whose offering
+// meets at the same time as one its person is enrolled in.
+func (d *memoryData) scheduleHold(entry WaitlistEntry) (string, bool) {
+	offering := d.offerings[entry.OfferingID]
+	var meetings, booked []Meeting
+	for _, m := range sortedValues(d.meetings) {
+		other := d.offerings[m.OfferingID]
+		switch {
+		case m.OfferingID == offering.ID:
+			meetings = append(meetings, m)
+		case other.TermID == offering.TermID && !d.courses[other.CourseID].DeletedAt.Valid:
+			if _, ok := d.enrollments[enrollmentKey{PersonID: entry.PersonID, OfferingID: m.OfferingID}]; ok {
+				booked = append(booked, m)
+			}
+		}
+	}
+	return scheduleHold(meetings, booked)
+}
+
+// hasSeat reports whether an offering admits another student: its course has
+// no capacity or fewer enrollments of persons in the student role than it.
+// Soft-deleted persons do not hold seats.
+func (d *memoryData) hasSeat(offeringID int) bool {
+	capacity := d.courses[d.offerings[offeringID].CourseID].Capacity
+	if capacity == nil {
+		return true
+	}
+	students := 0
+	for _, e := range d.enrollments {
+		if e.OfferingID == offeringID && e.Role == RoleStudent && !d.persons[e.PersonID].DeletedAt.Valid {
+			students++
+		}
+	}
+	return students < *capacity
+}
+
+// studentOfferingIDs returns the ids of the offerings a person is enrolled in
+// as a student, in order.
+func (d *memoryData) studentOfferingIDs(personID int) []int {
+	var ids []int
+	for _, e := range d.enrollments {
+		if e.PersonID == personID && e.Role == RoleStudent {
+			ids = append(ids, e.OfferingID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (d *memoryData) waitlistIndex(personID int, offeringID int) int {
+	return slices.IndexFunc(d.waitlist, func(entry WaitlistEntry) bool {
+		return entry.PersonID == personID && entry.OfferingID == offeringID
+	})
+}
+
+// waitlistPosition ranks entry among the entries of its offering.
+func (d *memoryData) waitlistPosition(entry WaitlistEntry) int {
+	position := 0
+	for _, other := range d.waitlist {
+		if other.OfferingID == entry.OfferingID && other.ID <= entry.ID {
+			position++
+		}
+	}
+	return position
+}
+
+// putTerm enforces the unique name and the date check of term.
+func (d *memoryData) putTerm(term Term) error {
+	for _, other := range d.terms {
+		if other.ID != term.ID && other.Name == term.Name {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if term.EndDate.Before(term.StartDate.Time) {
+		return gorm.ErrCheckConstraintViolated
+	}
+	d.terms[term.ID] = term
+	return nil
+}
+
+// putDepartment enforces the unique code, the code check and the chair
+// foreign key of department, and sets the type of its chair.
+func (d *memoryData) putDepartment(department *Department) error {
+	for _, other := range d.departments {
+		if other.ID != department.ID && other.Code == department.Code {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if !departmentCodePattern.MatchString(department.Code) {
+		return gorm.ErrCheckConstraintViolated
+	}
+	department.ChairType = nil
+	if department.ChairID != nil {
+		chair, ok := d.persons[*department.ChairID]
+		if !ok || chair.Type != "professor" {
+			return gorm.ErrForeignKeyViolated
+		}
+		department.ChairType = &chair.Type
+	}
+	d.departments[department.ID] = *department
+	return nil
+}
+
+// putProgram enforces the unique code and the department foreign key of
+// program.
+func (d *memoryData) putProgram(program Program) error {
+	for _, other := range d.programs {
+		if other.ID != program.ID && other.Code == program.Code {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	if _, ok := d.departments[program.DepartmentID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	d.programs[program.ID] = program
+	return nil
+}
+
+// checkCourseNumber enforces the department foreign key of course and the
+// number checks: only courses of a department are numbered, and no two of
+// them alike.
+func (d *memoryData) checkCourseNumber(course Course) error {
+	if course.DepartmentID == nil {
+		if course.Number != "" {
+			return gorm.ErrCheckConstraintViolated
+		}
+		return nil
+	}
+	if _, ok := d.departments[*course.DepartmentID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	for _, other := range d.courses {
+		if other.ID != course.ID && course.Number != "" && other.Number == course.Number &&
+			other.DepartmentID != nil && *other.DepartmentID == *course.DepartmentID {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	return nil
+}
+
+// checkAffiliation enforces the foreign keys of the department and major of
+// person and that each only belongs to its type.
+func (d *memoryData) checkAffiliation(person Person) error {
+	if person.DepartmentID != nil {
+		if _, ok := d.departments[*person.DepartmentID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		if person.Type != "professor" {
+			return gorm.ErrCheckConstraintViolated
+		}
+	}
+	if person.MajorID != nil {
+		if _, ok := d.programs[*person.MajorID]; !ok {
+			return gorm.ErrForeignKeyViolated
+		}
+		if person.Type != "student" {
+			return gorm.ErrCheckConstraintViolated
+		}
+	}
+	return nil
+}
+
+// chairs reports whether the person chairs a department.
+func (d *memoryData) chairs(personID int) bool {
+	for _, department := range d.departments {
+		if department.ChairID != nil && *department.ChairID == personID {
+			return true
+		}
+	}
+	return false
+}
+
+// currentAdvisor returns the index of the current advisor assignment of the
+// student, or -1 when there is none.
+func (d *memoryData) currentAdvisor(studentID int) int {
+	return slices.IndexFunc(d.advisors, func(a AdvisorAssignment) bool {
+		return a.StudentID == studentID && a.EndedAt == nil
+	})
+}
+
+// advises reports whether the person currently advises a student.
+func (d *memoryData) advises(personID int) bool {
+	return slices.ContainsFunc(d.advisors, func(a AdvisorAssignment) bool {
+		return a.AdvisorID == personID && a.EndedAt == nil
+	})
+}
+
+// endAdvisorAssignment ends the assignment at index i, releasing its persons
+// like the advisor_assignment type checks.
+func (d *memoryData) endAdvisorAssignment(i int, at time.Time) {
+	d.advisors[i].EndedAt = &at
+	d.advisors[i].StudentType, d.advisors[i].AdvisorType = nil, nil
+}
+
+// departmentCode returns the code of the department with the id, or "" when
+// id is nil.
+func (d *memoryData) departmentCode(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return d.departments[*id].Code
+}
+
+// putOffering enforces the foreign keys and the unique section of offering.
+func (d *memoryData) putOffering(offering CourseOffering) error {
+	if _, ok := d.courses[offering.CourseID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	if _, ok := d.terms[offering.TermID]; !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	for _, other := range d.offerings {
+		if other.ID != offering.ID && other.CourseID == offering.CourseID && other.TermID == offering.TermID && other.Section == offering.Section {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	d.offerings[offering.ID] = offering
+	return nil
+}
+
+// setEnrollments deletes the enrollments matched by remove that are not
+// among rows and admits the rows that are new, then fills the seats the
+// deletions freed.
+func (d *memoryData) setEnrollments(rows []PersonCourse, remove func(PersonCourse) bool) error {
+	keep := map[enrollmentKey]bool{}
+	for _, e := range rows {
+		keep[e.key()] = true
+	}
+	var freed []int
+	for key, e := range d.enrollments {
+		if remove(e) && !keep[key] {
+			delete(d.enrollments, key)
+			freed = append(freed, e.OfferingID)
+		}
+	}
+	for _, e := range rows {
+		if _, ok := d.enrollments[e.key()]; ok {
+			continue
+		}
+		if _, err := d.admit(e); err != nil && !errors.Is(err, ErrAlreadyWaitlisted) {
+			return err
+		}
+	}
+	freed = uniqueIDs(freed)
+	slices.Sort(freed)
+	for _, offeringID := range freed {
+		if err := d.promote(offeringID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertEnrollment checks the person_course foreign keys and role checks
+// before inserting.
+func (d *memoryData) insertEnrollment(e PersonCourse) error {
+	person, ok := d.persons[e.PersonID]
+	if !ok {
+		return gorm.ErrForeignKeyViolated
+	}
+	if offering, ok := d.offerings[e.OfferingID]; !ok || offering.CourseID != e.CourseID {
+		return gorm.ErrForeignKeyViolated
+	}
+	if !slices.Contains(EnrollmentRoles, e.Role) || e.Role == RoleInstructor && person.Type != "professor" {
+		return gorm.ErrCheckConstraintViolated
+	}
+	e.PersonType, e.EnrolledAt = person.Type, time.Now()
+	d.enrollments[e.key()] = e
+	return nil
+}
+
+// personRow strips the associations that live in other tables.
+func personRow(person Person) Person {
+	person.Courses = nil
+	return person
+}
+
+func courseRow(course Course) Course {
+	course.Persons, course.Instructors, course.StudentCount, course.Code = nil, nil, 0, ""
+	return course
+}
+
+// touchPersons increments the version of persons whose enrollments changed.
+func (d *memoryData) touchPersons(ids ...int) {
+	for _, id := range ids {
+		if person, ok := d.persons[id]; ok && !person.DeletedAt.Valid {
+			person.Version++
+			person.UpdatedAt = time.Now()
+			d.persons[id] = person
+		}
+	}
+}
+
+// checkVersion returns ErrVersionConflict unless expected is zero or the
+// current version.
+func checkVersion(current int, expected int) error {
+	if expected != 0 && expected != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func validPersonType(personType string) bool {
+	return slices.Contains(PersonTypes, personType)
+}
+
+func (d *memoryData) matchesFilter(person Person, filter PersonFilter) bool {
+	if filter.Age != nil && person.age() != *filter.Age {
+		return false
+	}
+	if filter.AgeGte != nil && person.age() < *filter.AgeGte {
+		return false
+	}
+	if filter.AgeLte != nil && person.age() > *filter.AgeLte {
+		return false
+	}
+	if filter.Type != "" && person.Type != filter.Type {
+		return false
+	}
+	if filter.Department != "" {
+		departmentID := person.DepartmentID
+		if person.MajorID != nil {
+			major := d.programs[*person.MajorID]
+			departmentID = &major.DepartmentID
+		}
+		if d.departmentCode(departmentID) != filter.Department {
+			return false
+		}
+	}
+	if filter.AdvisorID != 0 {
+		i := d.currentAdvisor(person.ID)
+		if i < 0 || d.advisors[i].AdvisorID != filter.AdvisorID {
+			return false
+		}
+	}
+	if filter.Name != "" && strings.ToLower(person.FirstName+" "+person.LastName) != filter.Name {
+		return false
+	}
+	for _, match := range filter.Names {
+		text := person.FirstName
+		if match.Column == "last_name" {
+			text = person.LastName
+		}
+		if !match.Matches(text) {
+			return false
+		}
+	}
+	if len(filter.EnrolledIn) > 0 {
+		enrolled := 0
+		for _, courseID := range uniqueIDs(filter.EnrolledIn) {
+			if d.enrolled(person.ID, courseID) {
+				enrolled++
+			}
+		}
+		if enrolled == 0 || (filter.EnrolledInAll && enrolled < len(filter.EnrolledIn)) {
+			return false
+		}
+	}
+	for _, term := range filter.Terms {
+		if !strings.Contains(strings.ToLower(person.FirstName), term) && !strings.Contains(strings.ToLower(person.LastName), term) {
+			return false
+		}
+	}
+	return true
+}
+
+// pageRows orders rows as described by page and selects the page window. It
+// also returns the number of rows before windowing.
+func pageRows[T sortable](rows []T, page Page) ([]T, int64) {
+	total := int64(len(rows))
+	rows = slices.Clone(rows)
+	slices.SortStableFunc(rows, func(a, b T) int { return comparePage(a, b, page) })
+
+	if page.After != nil {
+		start := len(rows)
+		for i, row := range rows {
+			if afterCursor(row, page) {
+				start = i
+				break
+			}
+		}
+		rows = rows[start:]
+	} else {
+		rows = rows[min(page.Offset, len(rows)):]
+	}
+	if page.Limit > 0 && len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+	}
+	return rows, total
+}
+
+// sortedValues returns the values of m ordered by key.
+func sortedValues[V any](m map[int]V) []V {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	values := make([]V, len(keys))
+	for i, key := range keys {
+		values[i] = m[key]
+	}
+	return values
+}
+
+// missingKeys returns the ids that are not keys of m.
+func missingKeys[V any](m map[int]V, ids []int) []int {
+	var missing []int
+	for _, id := range uniqueIDs(ids) {
+		if _, ok := m[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
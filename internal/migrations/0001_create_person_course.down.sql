@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS person_course;
+DROP TABLE IF EXISTS course;
+DROP TABLE IF EXISTS person;
@@ -0,0 +1,7 @@
+ALTER TABLE course
+    DROP COLUMN updated_at,
+    DROP COLUMN version;
+
+ALTER TABLE person
+    DROP COLUMN updated_at,
+    DROP COLUMN version;
@@ -0,0 +1,10 @@
+-- Row versions for optimistic concurrency. Every write to a person or course
+-- increments version; the API exposes it through the ETag header.
+
+ALTER TABLE person
+    ADD COLUMN version    INTEGER     NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE course
+    ADD COLUMN version    INTEGER     NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,12 @@
+-- Soft-deleted rows are purged, as the previous schema has no way to hide them.
+DELETE FROM person_course
+WHERE person_id IN (SELECT id FROM person WHERE deleted_at IS NOT NULL)
+   OR course_id IN (SELECT id FROM course WHERE deleted_at IS NOT NULL);
+DELETE FROM person WHERE deleted_at IS NOT NULL;
+DELETE FROM course WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_course_deleted_at;
+DROP INDEX idx_person_deleted_at;
+
+ALTER TABLE course DROP COLUMN deleted_at;
+ALTER TABLE person DROP COLUMN deleted_at;
@@ -0,0 +1,8 @@
+-- Soft deletes. A deleted person or course keeps its row and its
+-- person_course links, so it can be restored with its enrollments.
+
+ALTER TABLE person ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE course ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_person_deleted_at ON person (deleted_at);
+CREATE INDEX idx_course_deleted_at ON course (deleted_at);
@@ -0,0 +1,15 @@
+-- Audit log. Every mutation made through the API appends one row per entity
+-- it changes, in the same transaction as the change.
+
+CREATE TABLE audit_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor       TEXT        NOT NULL,
+    entity      TEXT        NOT NULL,
+    entity_id   INTEGER     NOT NULL,
+    operation   TEXT        NOT NULL,
+    diff        JSONB       NOT NULL
+);
+
+CREATE INDEX idx_audit_log_entity ON audit_log (entity, entity_id, occurred_at);
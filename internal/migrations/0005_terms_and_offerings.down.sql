@@ -0,0 +1,18 @@
+-- Enrollments fold back onto courses: a person enrolled in several offerings
+-- of a course keeps one enrollment in it.
+DELETE FROM person_course
+USING person_course AS earlier
+WHERE earlier.person_id = person_course.person_id
+  AND earlier.course_id = person_course.course_id
+  AND earlier.offering_id < person_course.offering_id;
+
+DROP INDEX idx_person_course_course_id;
+
+ALTER TABLE person_course
+    DROP CONSTRAINT person_course_offering_id_course_id_fkey,
+    DROP CONSTRAINT person_course_pkey,
+    ADD PRIMARY KEY (person_id, course_id),
+    DROP COLUMN offering_id;
+
+DROP TABLE course_offering;
+DROP TABLE term;
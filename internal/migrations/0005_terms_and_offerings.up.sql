@@ -0,0 +1,49 @@
+-- Terms and course offerings. Enrollments move from courses to offerings, so
+-- a person can take a course in several terms. Existing enrollments move to
+-- a "Legacy" term that holds one offering of every existing course; being the
+-- first offering of its course, it is the one the course-level enrollment
+-- endpoints keep using.
+
+CREATE TABLE term
+(
+    id         SERIAL PRIMARY KEY,
+    name       TEXT NOT NULL UNIQUE,
+    start_date DATE NOT NULL,
+    end_date   DATE NOT NULL,
+    CHECK (end_date >= start_date)
+);
+
+CREATE TABLE course_offering
+(
+    id        SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES course (id),
+    term_id   INTEGER NOT NULL REFERENCES term (id),
+    section   TEXT    NOT NULL,
+    UNIQUE (course_id, term_id, section),
+    -- Target of the person_course foreign key, which keeps course_id in step.
+    UNIQUE (id, course_id)
+);
+
+INSERT INTO term (name, start_date, end_date)
+VALUES ('Legacy', CURRENT_DATE, CURRENT_DATE);
+
+INSERT INTO course_offering (course_id, term_id, section)
+SELECT course.id, term.id, '001'
+FROM course, term
+WHERE term.name = 'Legacy'
+ORDER BY course.id;
+
+ALTER TABLE person_course ADD COLUMN offering_id INTEGER;
+
+UPDATE person_course
+SET offering_id = course_offering.id
+FROM course_offering
+WHERE course_offering.course_id = person_course.course_id;
+
+ALTER TABLE person_course
+    ALTER COLUMN offering_id SET NOT NULL,
+    DROP CONSTRAINT person_course_pkey,
+    ADD PRIMARY KEY (person_id, offering_id),
+    ADD FOREIGN KEY (offering_id, course_id) REFERENCES course_offering (id, course_id);
+
+CREATE INDEX idx_person_course_course_id ON person_course (course_id);
@@ -0,0 +1,3 @@
+DROP TABLE waitlist;
+
+ALTER TABLE course DROP COLUMN capacity;
@@ -0,0 +1,19 @@
+-- Course capacity and waitlists. A course with a capacity admits that many
+-- students into each of its offerings; further students queue on the
+-- offering's waitlist, in id order, until a seat frees up. Professors are not
+-- counted. A NULL capacity is unlimited.
+
+ALTER TABLE course ADD COLUMN capacity INTEGER CHECK (capacity > 0);
+
+CREATE TABLE waitlist
+(
+    id          BIGSERIAL PRIMARY KEY,
+    person_id   INTEGER     NOT NULL REFERENCES person (id),
+    course_id   INTEGER     NOT NULL,
+    offering_id INTEGER     NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (person_id, offering_id),
+    FOREIGN KEY (offering_id, course_id) REFERENCES course_offering (id, course_id)
+);
+
+CREATE INDEX idx_waitlist_offering_id ON waitlist (offering_id, id);
@@ -0,0 +1,13 @@
+-- Course prerequisites: a student must have taken every course a course
+-- requires, directly or through other prerequisites, before enrolling in it.
+-- The graph is kept acyclic by the API.
+
+CREATE TABLE course_prerequisite
+(
+    course_id       INTEGER NOT NULL REFERENCES course (id),
+    prerequisite_id INTEGER NOT NULL REFERENCES course (id),
+    PRIMARY KEY (course_id, prerequisite_id),
+    CHECK (course_id <> prerequisite_id)
+);
+
+CREATE INDEX idx_course_prerequisite_prerequisite_id ON course_prerequisite (prerequisite_id);
@@ -0,0 +1,9 @@
+DROP INDEX idx_person_course_course_id_role;
+
+ALTER TABLE person_course
+    DROP CONSTRAINT person_course_person_type_fkey,
+    DROP COLUMN enrolled_at,
+    DROP COLUMN person_type,
+    DROP COLUMN role;
+
+ALTER TABLE person DROP CONSTRAINT person_id_type_key;
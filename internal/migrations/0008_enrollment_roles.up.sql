@@ -0,0 +1,31 @@
+-- Enrollment roles. A person takes part in an offering as its instructor, a
+-- teaching assistant or a student, so a professor can also attend a course.
+-- Only students take seats and queue on waitlists. Existing links become
+-- instructor links for professors and student links for everyone else.
+--
+-- person_type repeats the type of the person, kept in step by the foreign
+-- key's ON UPDATE CASCADE, so a CHECK can require instructors to be
+-- professors: a person who instructs cannot stop being one.
+
+ALTER TABLE person ADD CONSTRAINT person_id_type_key UNIQUE (id, type);
+
+ALTER TABLE person_course
+    ADD COLUMN role        TEXT,
+    ADD COLUMN person_type TEXT,
+    ADD COLUMN enrolled_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE person_course
+SET person_type = person.type,
+    role        = CASE person.type WHEN 'professor' THEN 'instructor' ELSE 'student' END
+FROM person
+WHERE person.id = person_course.person_id;
+
+ALTER TABLE person_course
+    ALTER COLUMN role SET NOT NULL,
+    ALTER COLUMN person_type SET NOT NULL,
+    ADD CONSTRAINT person_course_role_check CHECK (role IN ('instructor', 'ta', 'student')),
+    ADD CONSTRAINT person_course_instructor_check CHECK (role <> 'instructor' OR person_type = 'professor'),
+    ADD CONSTRAINT person_course_person_type_fkey FOREIGN KEY (person_id, person_type)
+        REFERENCES person (id, type) ON UPDATE CASCADE;
+
+CREATE INDEX idx_person_course_course_id_role ON person_course (course_id, role);
@@ -0,0 +1,8 @@
+ALTER TABLE audit_log DROP COLUMN reason;
+
+ALTER TABLE person_course
+    DROP COLUMN graded_at,
+    DROP COLUMN grade_points,
+    DROP COLUMN grade;
+
+ALTER TABLE course DROP COLUMN credit_hours;
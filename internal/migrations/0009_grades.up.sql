@@ -0,0 +1,14 @@
+-- Grades. Courses carry credit hours, and enrollments in the student role a
+-- letter grade with the grade points it is worth. Grades without points (P,
+-- W and I) count towards no GPA. Grade changes are audited with the reason
+-- given for them.
+
+ALTER TABLE course ADD COLUMN credit_hours INTEGER NOT NULL DEFAULT 0 CHECK (credit_hours BETWEEN 0 AND 20);
+
+ALTER TABLE person_course
+    ADD COLUMN grade        TEXT CHECK (grade IN ('A', 'A-', 'B+', 'B', 'B-', 'C+', 'C', 'C-', 'D+', 'D', 'D-', 'F', 'P', 'W', 'I')),
+    ADD COLUMN grade_points NUMERIC(3, 2),
+    ADD COLUMN graded_at    TIMESTAMPTZ,
+    ADD CONSTRAINT person_course_grade_role_check CHECK (grade IS NULL OR role = 'student');
+
+ALTER TABLE audit_log ADD COLUMN reason TEXT;
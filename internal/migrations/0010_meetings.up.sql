@@ -0,0 +1,18 @@
+-- Weekly meetings of course offerings. Each row is one meeting a week, on a
+-- day, between two times, optionally in a room. Overlaps between the
+-- meetings of a person or of a room are rejected by the API, which names the
+-- conflicting course.
+
+CREATE TABLE meeting
+(
+    id          SERIAL PRIMARY KEY,
+    offering_id INTEGER NOT NULL REFERENCES course_offering (id) ON DELETE CASCADE,
+    day         TEXT    NOT NULL CHECK (day IN ('mon', 'tue', 'wed', 'thu', 'fri', 'sat', 'sun')),
+    start_time  TIME    NOT NULL,
+    end_time    TIME    NOT NULL,
+    room        TEXT    NOT NULL DEFAULT '',
+    CHECK (end_time > start_time)
+);
+
+CREATE INDEX idx_meeting_offering_id ON meeting (offering_id);
+CREATE INDEX idx_meeting_room_day ON meeting (room, day) WHERE room <> '';
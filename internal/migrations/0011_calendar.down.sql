@@ -0,0 +1,3 @@
+DROP TABLE calendar_token;
+
+DROP TABLE term_holiday;
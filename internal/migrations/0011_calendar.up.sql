@@ -0,0 +1,19 @@
+-- Calendar feeds. Terms list the holidays on which no meetings take place,
+-- and persons can hold one calendar token that lets calendar clients read
+-- their schedule feed without other credentials. Only the SHA-256 hash of
+-- the token is stored.
+
+CREATE TABLE term_holiday
+(
+    term_id INTEGER NOT NULL REFERENCES term (id) ON DELETE CASCADE,
+    date    DATE    NOT NULL,
+    name    TEXT    NOT NULL DEFAULT '',
+    PRIMARY KEY (term_id, date)
+);
+
+CREATE TABLE calendar_token
+(
+    person_id  INTEGER PRIMARY KEY REFERENCES person (id) ON DELETE CASCADE,
+    token_hash TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,13 @@
+ALTER TABLE person
+    DROP COLUMN major_id,
+    DROP COLUMN department_id;
+
+DROP INDEX course_department_number_key;
+
+ALTER TABLE course
+    DROP COLUMN number,
+    DROP COLUMN department_id;
+
+DROP TABLE program;
+
+DROP TABLE department;
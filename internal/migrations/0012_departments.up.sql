@@ -0,0 +1,45 @@
+-- Departments and academic programs. Courses belong to a department, which
+-- numbers them ("CS 101"), professors have a home department and students
+-- declare a program as their major. Departments are chaired by a professor.
+--
+-- chair_type repeats the type of the chair, kept in step by the foreign key's
+-- ON UPDATE CASCADE like person_course.person_type, so a chair cannot stop
+-- being a professor.
+
+CREATE TABLE department
+(
+    id         SERIAL PRIMARY KEY,
+    code       TEXT NOT NULL UNIQUE CHECK (code ~ '^[A-Z]{2,6}$'),
+    name       TEXT NOT NULL,
+    chair_id   INTEGER,
+    chair_type TEXT CHECK (chair_type = 'professor'),
+    CHECK ((chair_id IS NULL) = (chair_type IS NULL)),
+    FOREIGN KEY (chair_id, chair_type) REFERENCES person (id, type) ON UPDATE CASCADE
+);
+
+CREATE TABLE program
+(
+    id            SERIAL PRIMARY KEY,
+    code          TEXT    NOT NULL UNIQUE,
+    name          TEXT    NOT NULL,
+    degree        TEXT    NOT NULL DEFAULT '',
+    department_id INTEGER NOT NULL REFERENCES department (id)
+);
+
+CREATE INDEX idx_program_department_id ON program (department_id);
+
+ALTER TABLE course
+    ADD COLUMN department_id INTEGER REFERENCES department (id),
+    ADD COLUMN number        TEXT NOT NULL DEFAULT '',
+    ADD CONSTRAINT course_number_check CHECK (number = '' OR department_id IS NOT NULL);
+
+CREATE UNIQUE INDEX course_department_number_key ON course (department_id, number) WHERE number <> '';
+
+ALTER TABLE person
+    ADD COLUMN department_id INTEGER REFERENCES department (id),
+    ADD COLUMN major_id      INTEGER REFERENCES program (id),
+    ADD CONSTRAINT person_department_check CHECK (department_id IS NULL OR type = 'professor'),
+    ADD CONSTRAINT person_major_check CHECK (major_id IS NULL OR type = 'student');
+
+CREATE INDEX idx_person_department_id ON person (department_id);
+CREATE INDEX idx_person_major_id ON person (major_id);
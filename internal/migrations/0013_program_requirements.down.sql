@@ -0,0 +1,3 @@
+DROP TABLE program_requirement_course;
+
+DROP TABLE program_requirement;
@@ -0,0 +1,29 @@
+-- Requirements of degree programs, which degree audits check students
+-- against. A requirement is one of:
+--
+--   courses    every course listed in program_requirement_course
+--   electives  choose of the courses listed
+--   credits    min_credits credit hours of completed courses
+--   gpa        a cumulative GPA of at least min_gpa
+
+CREATE TABLE program_requirement
+(
+    id          SERIAL PRIMARY KEY,
+    program_id  INTEGER NOT NULL REFERENCES program (id) ON DELETE CASCADE,
+    kind        TEXT    NOT NULL CHECK (kind IN ('courses', 'electives', 'credits', 'gpa')),
+    name        TEXT    NOT NULL DEFAULT '',
+    choose      INTEGER NOT NULL DEFAULT 0 CHECK (choose >= 0),
+    min_credits INTEGER NOT NULL DEFAULT 0 CHECK (min_credits >= 0),
+    min_gpa     NUMERIC(3, 2) CHECK (min_gpa BETWEEN 0 AND 4)
+);
+
+CREATE INDEX idx_program_requirement_program_id ON program_requirement (program_id);
+
+CREATE TABLE program_requirement_course
+(
+    requirement_id INTEGER NOT NULL REFERENCES program_requirement (id) ON DELETE CASCADE,
+    course_id      INTEGER NOT NULL REFERENCES course (id),
+    PRIMARY KEY (requirement_id, course_id)
+);
+
+CREATE INDEX idx_program_requirement_course_course_id ON program_requirement_course (course_id);
@@ -0,0 +1 @@
+DROP TABLE advisor_assignment;
@@ -0,0 +1,27 @@
+-- Advisor assignments between professors and the students they advise. Rows
+-- are kept when a student changes advisor, so the table is the history of
+-- assignments; the current one of a student is the one without ended_at.
+--
+-- student_type and advisor_type repeat the types of the persons of a current
+-- assignment, kept in step by the foreign keys' ON UPDATE CASCADE like
+-- department.chair_type, so neither can change type while it lasts. Ended
+-- assignments clear them, which releases the persons.
+
+CREATE TABLE advisor_assignment
+(
+    id           SERIAL PRIMARY KEY,
+    student_id   INTEGER     NOT NULL REFERENCES person (id),
+    advisor_id   INTEGER     NOT NULL REFERENCES person (id),
+    started_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at     TIMESTAMPTZ,
+    student_type TEXT CHECK (student_type = 'student'),
+    advisor_type TEXT CHECK (advisor_type = 'professor'),
+    CHECK ((ended_at IS NULL) = (student_type IS NOT NULL)),
+    CHECK ((ended_at IS NULL) = (advisor_type IS NOT NULL)),
+    CHECK (ended_at >= started_at),
+    FOREIGN KEY (student_id, student_type) REFERENCES person (id, type) ON UPDATE CASCADE,
+    FOREIGN KEY (advisor_id, advisor_type) REFERENCES person (id, type) ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX advisor_assignment_current_key ON advisor_assignment (student_id) WHERE ended_at IS NULL;
+CREATE INDEX idx_advisor_assignment_advisor_id ON advisor_assignment (advisor_id);
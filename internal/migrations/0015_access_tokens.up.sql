@@ -0,0 +1,10 @@
+-- Access tokens. A person can hold one bearer token that authenticates them
+-- to the API, which instructors use to grade their offerings. Only the
+-- SHA-256 hash of the token is stored.
+
+CREATE TABLE access_token
+(
+    person_id  INTEGER PRIMARY KEY REFERENCES person (id) ON DELETE CASCADE,
+    token_hash TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
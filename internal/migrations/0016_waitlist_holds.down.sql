@@ -0,0 +1 @@
+ALTER TABLE waitlist DROP COLUMN hold_reason;
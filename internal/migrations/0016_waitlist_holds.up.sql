@@ -0,0 +1,5 @@
+-- Waitlist holds. A seat that frees up passes over the waitlisted students
+-- whose schedule its meetings would overlap; their entries keep their place
+-- in line and say why they were passed over.
+
+ALTER TABLE waitlist ADD COLUMN hold_reason TEXT;
@@ -2,9 +2,13 @@ package internal
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -12,13 +16,25 @@ import (
 /*
 Person definitions.
 */
+var PersonTypes = []string{"professor", "student"}
+
+// Person is validated against its validate tags before every write. The
+// courses it references are checked against the store by validatePerson.
 type Person struct {
-	ID        int      `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
-	FirstName string   `json:"first_name,omitempty" gorm:"column:first_name"`
-	LastName  string   `json:"last_name,omitempty" gorm:"column:last_name"`
-	Type      string   `json:"type,omitempty" gorm:"column:type;check:type IN ('professor', 'student')"`
-	Age       int      `json:"age,omitempty" gorm:"column:age"`
-	Courses   []Course `json:"courses,omitempty" gorm:"many2many:person_course"`
+	ID        int      `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	FirstName string   `json:"first_name" gorm:"column:first_name" validate:"required,max=100"`
+	LastName  string   `json:"last_name" gorm:"column:last_name" validate:"required,max=100"`
+	Type      string   `json:"type" gorm:"column:type;check:type IN ('professor', 'student')" validate:"required,oneof=professor student"`
+	Age       *int     `json:"age" gorm:"column:age" validate:"required,min=0,max=150"`
+	Courses   []Course `json:"courses" gorm:"many2many:person_course"`
+	// DepartmentID is the home department of a professor and MajorID the
+	// program a student declared. Each is only allowed for its type.
+	DepartmentID *int `json:"department_id" gorm:"column:department_id"`
+	MajorID      *int `json:"major_id" gorm:"column:major_id"`
+	// Version is incremented by every write to the person or its enrollments.
+	Version   int            `json:"-" gorm:"column:version"`
+	UpdatedAt time.Time      `json:"-" gorm:"column:updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deleted_at"`
 }
 
 func (p *Person) UnmarshalJSON(data []byte) error {
@@ -34,28 +50,93 @@ func (p *Person) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	courses := make([]Course, len(person.Courses))
+	// Courses stays nil when the key is absent, so updates can leave the
+	// enrollments untouched.
+	var courses []Course
+	if person.Courses != nil {
+		courses = make([]Course, len(person.Courses))
+	}
 	for i, id := range person.Courses {
 		courses[i] = Course{ID: id}
 	}
 	*p = Person{
-		ID:        person.ID,
-		FirstName: person.FirstName,
-		LastName:  person.LastName,
-		Type:      person.Type,
-		Age:       person.Age,
-		Courses:   courses,
+		ID:           person.ID,
+		FirstName:    person.FirstName,
+		LastName:     person.LastName,
+		Type:         person.Type,
+		Age:          person.Age,
+		Courses:      courses,
+		DepartmentID: person.DepartmentID,
+		MajorID:      person.MajorID,
 	}
 	return nil
 }
 
+// PersonJSON is the request representation of a Person, with courses given by
+// id.
 type PersonJSON struct {
-	ID        int    `json:"id,omitempty"`
-	FirstName string `json:"first_name,omitempty"`
-	LastName  string `json:"last_name,omitempty"`
-	Type      string `json:"type,omitempty"`
-	Age       int    `json:"age,omitempty"`
-	Courses   []int  `json:"courses,omitempty"`
+	ID           int    `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Type         string `json:"type"`
+	Age          *int   `json:"age"`
+	Courses      []int  `json:"courses"`
+	DepartmentID *int   `json:"department_id"`
+	MajorID      *int   `json:"major_id"`
+}
+
+// JSON returns the request representation of p, which PATCH bodies apply to.
+func (p Person) JSON() PersonJSON {
+	return PersonJSON{
+		ID:           p.ID,
+		FirstName:    p.FirstName,
+		LastName:     p.LastName,
+		Type:         p.Type,
+		Age:          p.Age,
+		Courses:      append([]int{}, courseIDs(p.Courses)...),
+		DepartmentID: p.DepartmentID,
+		MajorID:      p.MajorID,
+	}
+}
+
+// PersonResponse is the JSON representation of a Person returned by the API,
+// with courses expanded to full Course objects. Fields are present even when
+// zero or null, so clients can tell an empty value from a missing one.
+type PersonResponse struct {
+	ID        int      `json:"id"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Type      string   `json:"type"`
+	Age       int      `json:"age"`
+	Courses   []Course `json:"courses"`
+	// DepartmentID is only set on professors and MajorID on students.
+	DepartmentID *int `json:"department_id"`
+	MajorID      *int `json:"major_id"`
+	// DeletedAt is only set on soft-deleted persons, which are only listed
+	// to admins.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (p Person) Response() PersonResponse {
+	return PersonResponse{
+		ID:           p.ID,
+		FirstName:    p.FirstName,
+		LastName:     p.LastName,
+		Type:         p.Type,
+		Age:          p.age(),
+		Courses:      append([]Course{}, p.Courses...),
+		DepartmentID: p.DepartmentID,
+		MajorID:      p.MajorID,
+		DeletedAt:    deletedAt(p.DeletedAt),
+	}
+}
+
+func NewPersonResponses(persons []Person) []PersonResponse {
+	responses := make([]PersonResponse, len(persons))
+	for i, person := range persons {
+		responses[i] = person.Response()
+	}
+	return responses
 }
 
 func (s Person) String() string {
@@ -73,40 +154,83 @@ func (s Person) String() string {
   Courses: [
     %v
   ]
-}`, s.ID, s.FirstName, s.LastName, s.Type, s.Age, courses)
-}
-
-func (Person) TableName() string {
-	return "person"
+}`, s.ID, s.FirstName, s.LastName, s.Type, s.age(), courses)
 }
 
-func LoadAllPersons(db *gorm.DB) ([]Person, error) {
-	var person []Person
-	err := db.Model(&Person{}).Preload("Courses").Find(&person).Error
-	return person, err
+// age is the age of p, or 0 when it is not set, which validation rejects
+// before any write.
+func (p Person) age() int {
+	if p.Age == nil {
+		return 0
+	}
+	return *p.Age
 }
 
-func LoadPerson(db *gorm.DB, query any) (Person, error) {
-	var person Person
-	err := db.Model(&Person{}).Where(query).Preload("Courses").First(&person).Error
-	return person, err
+func (Person) TableName() string {
+	return "person"
 }
 
-func LoadAllPersonCourses(dbQuery *gorm.DB, persons *[]Person) error {
-	return dbQuery.Preload("Courses").Find(&persons).Error
+// ETag is the strong entity tag of the person representation. It covers the
+// embedded courses, so renaming one of them changes it too.
+func (p Person) ETag() string {
+	parts := []any{"person", p.ID, p.Version}
+	for _, course := range p.Courses {
+		parts = append(parts, course.tagParts()...)
+	}
+	return entityTag(parts...)
 }
 
-func LoadPersonCourses(dbQuery *gorm.DB, person *Person) error {
-	return dbQuery.Preload("Courses").First(&person).Error
+func (p Person) sortValue(column string) any {
+	switch column {
+	case "first_name":
+		return p.FirstName
+	case "last_name":
+		return p.LastName
+	case "type":
+		return p.Type
+	case "age":
+		return p.age()
+	default:
+		return p.ID
+	}
 }
 
 /*
 Course definitions.
 */
 type Course struct {
-	ID      int      `json:"id,omitempty"   gorm:"column:id;primaryKey;autoIncrement"`
-	Name    string   `json:"name,omitempty" gorm:"column:name"`
-	Persons []Person `json:"-"              gorm:"many2many:person_course"`
+	ID   int    `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	Name string `json:"name" gorm:"column:name" validate:"required,max=100"`
+	// Capacity is the number of students each offering of the course admits
+	// before further ones are waitlisted. Nil is unlimited.
+	Capacity *int `json:"capacity" gorm:"column:capacity" validate:"min=1"`
+	// CreditHours weighs the grades of the course in GPAs.
+	CreditHours int `json:"credit_hours" gorm:"column:credit_hours" validate:"min=0,max=20"`
+	// Number numbers the course within its department. Code joins the two,
+	// as in "CS 101"; the stores fill it on every read and writes ignore it.
+	DepartmentID *int     `json:"department_id" gorm:"column:department_id"`
+	Number       string   `json:"number" gorm:"column:number" validate:"max=10"`
+	Code         string   `json:"code" gorm:"-"`
+	Persons      []Person `json:"-" gorm:"many2many:person_course"`
+	// Instructors and StudentCount summarize the enrollments in the offerings
+	// of the course. The stores fill them on every read and writes ignore
+	// them.
+	Instructors  []CourseInstructor `json:"instructors"   gorm:"-"`
+	StudentCount int                `json:"student_count" gorm:"-"`
+	// Version is incremented by every write to the course.
+	Version   int            `json:"-" gorm:"column:version"`
+	UpdatedAt time.Time      `json:"-" gorm:"column:updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deleted_at"`
+}
+
+// MarshalJSON adds deleted_at to soft-deleted courses, which are only listed
+// to admins.
+func (c Course) MarshalJSON() ([]byte, error) {
+	type course Course
+	return json.Marshal(struct {
+		course
+		DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	}{course(c), deletedAt(c.DeletedAt)})
 }
 
 func (s Course) String() string {
@@ -128,8 +252,785 @@ func (Course) TableName() string {
 	return "course"
 }
 
-func LoadCourse(db *gorm.DB, query any) (Course, error) {
-	var course Course
-	err := db.Model(&Course{}).Where(query).Preload("Persons").First(&course).Error
-	return course, err
+// ETag is the strong entity tag of the course representation.
+func (c Course) ETag() string {
+	return entityTag(append([]any{"course"}, c.tagParts()...)...)
+}
+
+// courseCode joins the code of a department and a course number, as in
+// "CS 101". It is empty unless both are set.
+func courseCode(department string, number string) string {
+	if department == "" || number == "" {
+		return ""
+	}
+	return department + " " + number
+}
+
+// tagParts are the values the representation of c depends on: its version,
+// the code of its department and the enrollments it summarizes.
+func (c Course) tagParts() []any {
+	parts := []any{c.ID, c.Version, c.Code, c.StudentCount}
+	for _, instructor := range c.Instructors {
+		parts = append(parts, instructor.ID, instructor.FirstName, instructor.LastName)
+	}
+	return parts
+}
+
+func (c Course) sortValue(column string) any {
+	switch column {
+	case "name":
+		return c.Name
+	default:
+		return c.ID
+	}
+}
+
+// CourseInstructor is a professor who instructs an offering of a course.
+type CourseInstructor struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// CoursePrerequisite requires students to have taken PrerequisiteID before
+// they enroll in CourseID.
+type CoursePrerequisite struct {
+	CourseID       int `json:"course_id" gorm:"column:course_id;primaryKey;autoIncrement:false"`
+	PrerequisiteID int `json:"prerequisite_id" gorm:"column:prerequisite_id;primaryKey;autoIncrement:false"`
+}
+
+func (CoursePrerequisite) TableName() string {
+	return "course_prerequisite"
+}
+
+/*
+Department definitions.
+*/
+
+// departmentCodePattern is the format of department codes, which the
+// department_code_check constraint enforces too.
+var departmentCodePattern = regexp.MustCompile(`^[A-Z]{2,6}$`)
+
+// Department groups courses and professors. Its code prefixes the codes of
+// its courses.
+type Department struct {
+	ID   int    `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	Code string `json:"code,omitempty" gorm:"column:code" validate:"required,max=6"`
+	Name string `json:"name,omitempty" gorm:"column:name" validate:"required,max=100"`
+	// ChairID is the professor who chairs the department, if any. ChairType
+	// repeats the chair's type for the constraint that chairs are professors.
+	ChairID   *int    `json:"chair_id,omitempty" gorm:"column:chair_id"`
+	ChairType *string `json:"-" gorm:"column:chair_type"`
+}
+
+func (Department) TableName() string {
+	return "department"
+}
+
+func (d Department) sortValue(column string) any {
+	switch column {
+	case "code":
+		return d.Code
+	case "name":
+		return d.Name
+	default:
+		return d.ID
+	}
+}
+
+// Program is a degree program of a department that students declare as
+// their major.
+type Program struct {
+	ID           int    `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	Code         string `json:"code,omitempty" gorm:"column:code" validate:"required,max=20"`
+	Name         string `json:"name,omitempty" gorm:"column:name" validate:"required,max=100"`
+	Degree       string `json:"degree,omitempty" gorm:"column:degree" validate:"max=20"`
+	DepartmentID int    `json:"department_id,omitempty" gorm:"column:department_id" validate:"required"`
+}
+
+func (Program) TableName() string {
+	return "program"
+}
+
+func (p Program) sortValue(column string) any {
+	switch column {
+	case "code":
+		return p.Code
+	case "name":
+		return p.Name
+	default:
+		return p.ID
+	}
+}
+
+// Requirement kinds. A courses requirement takes every course it lists and
+// an electives one Choose of them; a credits requirement takes MinCredits
+// credit hours of any courses and a gpa one a cumulative GPA of MinGPA.
+const (
+	RequirementCourses   = "courses"
+	RequirementElectives = "electives"
+	RequirementCredits   = "credits"
+	RequirementGPA       = "gpa"
+)
+
+var RequirementKinds = []string{RequirementCourses, RequirementElectives, RequirementCredits, RequirementGPA}
+
+// Requirement is a rule of a program that students must satisfy to
+// graduate. Only the fields of its kind are set.
+type Requirement struct {
+	ID         int      `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	ProgramID  int      `json:"-" gorm:"column:program_id"`
+	Kind       string   `json:"kind" gorm:"column:kind" validate:"required,oneof=courses electives credits gpa"`
+	Name       string   `json:"name,omitempty" gorm:"column:name" validate:"max=100"`
+	CourseIDs  []int    `json:"course_ids,omitempty" gorm:"-"`
+	Choose     int      `json:"choose,omitempty" gorm:"column:choose" validate:"min=0"`
+	MinCredits int      `json:"min_credits,omitempty" gorm:"column:min_credits" validate:"min=0"`
+	MinGPA     *float64 `json:"min_gpa,omitempty" gorm:"column:min_gpa"`
+}
+
+func (Requirement) TableName() string {
+	return "program_requirement"
+}
+
+// RequirementCourse lists a course in a requirement.
+type RequirementCourse struct {
+	RequirementID int `gorm:"column:requirement_id;primaryKey"`
+	CourseID      int `gorm:"column:course_id;primaryKey"`
+}
+
+func (RequirementCourse) TableName() string {
+	return "program_requirement_course"
+}
+
+/*
+Term definitions.
+*/
+
+// Term is a semester in which courses are offered, such as "Fall 2026".
+type Term struct {
+	ID        int    `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	Name      string `json:"name,omitempty" gorm:"column:name" validate:"required,max=100"`
+	StartDate Date   `json:"start_date" gorm:"column:start_date" validate:"required"`
+	EndDate   Date   `json:"end_date" gorm:"column:end_date" validate:"required"`
+}
+
+func (Term) TableName() string {
+	return "term"
+}
+
+func (t Term) sortValue(column string) any {
+	switch column {
+	case "name":
+		return t.Name
+	case "start_date":
+		return t.StartDate.String()
+	default:
+		return t.ID
+	}
+}
+
+// Holiday is a day of a term on which no meetings take place.
+type Holiday struct {
+	TermID int    `json:"-" gorm:"column:term_id;primaryKey"`
+	Date   Date   `json:"date" gorm:"column:date;primaryKey" validate:"required"`
+	Name   string `json:"name,omitempty" gorm:"column:name" validate:"max=100"`
+}
+
+func (Holiday) TableName() string {
+	return "term_holiday"
+}
+
+// Date is a calendar day, written as YYYY-MM-DD in JSON and stored in DATE
+// columns.
+type Date struct {
+	time.Time
+}
+
+const dateLayout = "2006-01-02"
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var str *string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == nil {
+		*d = Date{}
+		return nil
+	}
+	t, err := time.Parse(dateLayout, *str)
+	if err != nil {
+		return fmt.Errorf("date %q must be formatted as YYYY-MM-DD", *str)
+	}
+	*d = Date{t}
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+	*d = NewDate(t.Year(), t.Month(), t.Day())
+	return nil
+}
+
+/*
+Course offering definitions.
+*/
+
+// CourseOffering is one section of a course taught in a term. Persons enroll
+// in offerings, so they can take the same course in several terms.
+type CourseOffering struct {
+	ID       int    `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	CourseID int    `json:"course_id,omitempty" gorm:"column:course_id" validate:"required"`
+	TermID   int    `json:"term_id,omitempty" gorm:"column:term_id" validate:"required"`
+	Section  string `json:"section,omitempty" gorm:"column:section" validate:"required,max=10"`
+}
+
+func (CourseOffering) TableName() string {
+	return "course_offering"
+}
+
+func (o CourseOffering) sortValue(column string) any {
+	switch column {
+	case "section":
+		return o.Section
+	default:
+		return o.ID
+	}
+}
+
+// DefaultSection is the section of the offering created with a course.
+const DefaultSection = "001"
+
+/*
+Meeting definitions.
+*/
+
+// Weekdays are the days meetings fall on, in timetable order.
+var Weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// Meeting is one weekly meeting of an offering. Room is optional; meetings
+// without one never double-book.
+type Meeting struct {
+	ID         int       `json:"id,omitempty" gorm:"column:id;primaryKey;autoIncrement"`
+	OfferingID int       `json:"offering_id,omitempty" gorm:"column:offering_id"`
+	Day        string    `json:"day" gorm:"column:day" validate:"required,oneof=mon tue wed thu fri sat sun"`
+	StartTime  ClockTime `json:"start_time" gorm:"column:start_time"`
+	EndTime    ClockTime `json:"end_time" gorm:"column:end_time"`
+	Room       string    `json:"room,omitempty" gorm:"column:room" validate:"max=50"`
+}
+
+func (Meeting) TableName() string {
+	return "meeting"
+}
+
+// Overlaps reports whether m and other share a day and some time of it.
+// Meetings that merely touch, one ending when the other starts, do not
+// overlap.
+func (m Meeting) Overlaps(other Meeting) bool {
+	return m.Day == other.Day && m.StartTime < other.EndTime && other.StartTime < m.EndTime
+}
+
+// scheduleHold returns the hold reason of a waitlisted student when meetings
+// overlap booked, the meetings of the offerings they are enrolled in.
+func scheduleHold(meetings []Meeting, booked []Meeting) (string, bool) {
+	for _, m := range meetings {
+		for _, b := range booked {
+			if m.Overlaps(b) {
+				return fmt.Sprintf("Meets on %v, overlapping offering '%v' that the person is enrolled in.", m, b.OfferingID), true
+			}
+		}
+	}
+	return "", false
+}
+
+func (m Meeting) String() string {
+	return fmt.Sprintf("%v %v-%v", m.Day, m.StartTime, m.EndTime)
+}
+
+// compareMeetings orders meetings as a timetable: by day, then start time.
+func compareMeetings(a, b Meeting) int {
+	if a.Day != b.Day {
+		return slices.Index(Weekdays, a.Day) - slices.Index(Weekdays, b.Day)
+	}
+	if a.StartTime != b.StartTime {
+		return int(a.StartTime - b.StartTime)
+	}
+	return a.OfferingID - b.OfferingID
+}
+
+// ClockTime is a time of day in minutes after midnight, written as HH:MM in
+// JSON and stored in TIME columns.
+type ClockTime int
+
+const clockLayout = "15:04"
+
+func (c ClockTime) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+func (c ClockTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *ClockTime) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	t, err := time.Parse(clockLayout, str)
+	if err != nil {
+		return fmt.Errorf("time %q must be formatted as HH:MM", str)
+	}
+	*c = ClockTime(t.Hour()*60 + t.Minute())
+	return nil
+}
+
+func (c ClockTime) Value() (driver.Value, error) {
+	return c.String(), nil
+}
+
+func (c *ClockTime) Scan(src any) error {
+	switch src := src.(type) {
+	case time.Time:
+		*c = ClockTime(src.Hour()*60 + src.Minute())
+		return nil
+	case []byte:
+		return c.Scan(string(src))
+	case string:
+		t, err := time.Parse("15:04:05", src)
+		if err != nil {
+			return err
+		}
+		return c.Scan(t)
+	default:
+		return fmt.Errorf("cannot scan %T into ClockTime", src)
+	}
+}
+
+// ScheduleEntry is one meeting in the weekly timetable of a person.
+type ScheduleEntry struct {
+	Meeting
+	CourseID   int    `json:"course_id"`
+	CourseName string `json:"course_name"`
+	Section    string `json:"section"`
+	TermID     int    `json:"term_id"`
+	Role       string `json:"role"`
+}
+
+/*
+Enrollment definitions.
+*/
+
+// Enrollment roles. Only professors can be instructors, and only students
+// take seats.
+const (
+	RoleInstructor = "instructor"
+	RoleTA         = "ta"
+	RoleStudent    = "student"
+)
+
+var EnrollmentRoles = []string{RoleInstructor, RoleTA, RoleStudent}
+
+// PersonCourse enrolls a person in a course offering. CourseID repeats the
+// course of the offering, so the courses of a person are one join away.
+type PersonCourse struct {
+	PersonID   int `json:"person_id" gorm:"column:person_id;primaryKey"`
+	CourseID   int `json:"course_id" gorm:"column:course_id"`
+	OfferingID int `json:"offering_id,omitempty" gorm:"column:offering_id;primaryKey"`
+	// Role is empty until the enrollment is stored, which defaults it to the
+	// role of the person's type.
+	Role       string    `json:"role" gorm:"column:role"`
+	EnrolledAt time.Time `json:"enrolled_at" gorm:"column:enrolled_at"`
+	// Grade is only set on enrollments in the student role, once graded.
+	// GradePoints is nil for grades that count towards no GPA.
+	Grade       *string    `json:"grade,omitempty" gorm:"column:grade"`
+	GradePoints *float64   `json:"grade_points,omitempty" gorm:"column:grade_points"`
+	GradedAt    *time.Time `json:"graded_at,omitempty" gorm:"column:graded_at"`
+	// PersonType repeats the type of the person for the constraint that
+	// instructors are professors.
+	PersonType string `json:"-" gorm:"column:person_type"`
+}
+
+func (PersonCourse) TableName() string {
+	return "person_course"
+}
+
+// gradePoints maps the letter grades to their grade points. P (pass), W
+// (withdrawn) and I (incomplete) have none.
+var gradePoints = map[string]float64{
+	"A": 4.0, "A-": 3.7,
+	"B+": 3.3, "B": 3.0, "B-": 2.7,
+	"C+": 2.3, "C": 2.0, "C-": 1.7,
+	"D+": 1.3, "D": 1.0, "D-": 0.7,
+	"F": 0.0,
+}
+
+// GradePoints returns the grade points of grade, or nil when it has none.
+func GradePoints(grade string) *float64 {
+	points, ok := gradePoints[grade]
+	if !ok {
+		return nil
+	}
+	return &points
+}
+
+// defaultRole is the role a person of personType enrolls with when none is
+// given: professors instruct and students attend.
+func defaultRole(personType string) string {
+	if personType == "professor" {
+		return RoleInstructor
+	}
+	return RoleStudent
+}
+
+// WaitlistEntry queues a student for a seat in a full offering. Entries are
+// promoted to enrollments in id order as seats free up.
+type WaitlistEntry struct {
+	ID         int       `json:"-" gorm:"column:id;primaryKey;autoIncrement"`
+	PersonID   int       `json:"person_id" gorm:"column:person_id"`
+	CourseID   int       `json:"course_id" gorm:"column:course_id"`
+	OfferingID int       `json:"offering_id" gorm:"column:offering_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`
+	// HoldReason says why the student was passed over when a seat last freed
+	// up, because its meetings overlap their schedule. It is nil until then.
+	HoldReason *string `json:"hold_reason" gorm:"column:hold_reason"`
+	// Position is the 1-based rank of the entry in its offering's waitlist.
+	Position int `json:"position" gorm:"-"`
+}
+
+func (WaitlistEntry) TableName() string {
+	return "waitlist"
+}
+
+/*
+Audit definitions.
+*/
+
+// Audited entities.
+const (
+	AuditPerson     = "person"
+	AuditCourse     = "course"
+	AuditTerm       = "term"
+	AuditOffering   = "offering"
+	AuditDepartment = "department"
+	AuditProgram    = "program"
+)
+
+var AuditEntities = []string{AuditPerson, AuditCourse, AuditTerm, AuditOffering, AuditDepartment, AuditProgram}
+
+// Audited operations. AuditEnrollment records a change to the courses and
+// offerings of a person made through the enrollment endpoints,
+// AuditPrerequisites a change to the prerequisites of a course and AuditGrade
+// a change to the grade of a person in an offering.
+const (
+	AuditCreate        = "create"
+	AuditUpdate        = "update"
+	AuditDelete        = "delete"
+	AuditRestore       = "restore"
+	AuditEnrollment    = "enrollment"
+	AuditPrerequisites = "prerequisites"
+	AuditGrade         = "grade"
+)
+
+// AuditEntry records one change to one person or course.
+type AuditEntry struct {
+	ID         int       `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	OccurredAt time.Time `json:"occurred_at" gorm:"column:occurred_at"`
+	Actor      string    `json:"actor" gorm:"column:actor"`
+	Entity     string    `json:"entity" gorm:"column:entity"`
+	EntityID   int       `json:"entity_id" gorm:"column:entity_id"`
+	Operation  string    `json:"operation" gorm:"column:operation"`
+	Diff       AuditDiff `json:"diff" gorm:"column:diff;type:jsonb"`
+	// Reason is the explanation given for a grade change.
+	Reason string `json:"reason,omitempty" gorm:"column:reason"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+func (e AuditEntry) sortValue(column string) any {
+	return e.ID
+}
+
+// AuditDiff holds the fields a change modified, with their values before and
+// after it. Before is null for creations and restores, and After is null for
+// deletions.
+type AuditDiff struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+}
+
+// Value stores the diff in its jsonb column.
+func (d AuditDiff) Value() (driver.Value, error) {
+	data, err := json.Marshal(d)
+	return string(data), err
+}
+
+func (d *AuditDiff) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, d)
+	case string:
+		return json.Unmarshal([]byte(src), d)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditDiff", src)
+	}
+}
+
+func deletedAt(deleted gorm.DeletedAt) *time.Time {
+	if !deleted.Valid {
+		return nil
+	}
+	return &deleted.Time
+}
+
+// personCourses enrolls a person in the offerings of courses, given by
+// course id.
+func personCourses(personID int, courseIDs []int, offerings map[int]int) []PersonCourse {
+	rows := make([]PersonCourse, 0, len(courseIDs))
+	for _, courseID := range uniqueIDs(courseIDs) {
+		rows = append(rows, PersonCourse{PersonID: personID, CourseID: courseID, OfferingID: offerings[courseID]})
+	}
+	return rows
+}
+
+// distinctCourses drops the repeats of a course a person took in several
+// offerings, keeping the order.
+func distinctCourses(courses []Course) []Course {
+	var distinct []Course
+	for _, course := range courses {
+		if !slices.ContainsFunc(distinct, func(c Course) bool { return c.ID == course.ID }) {
+			distinct = append(distinct, course)
+		}
+	}
+	return distinct
+}
+
+func courseIDs(courses []Course) []int {
+	ids := make([]int, len(courses))
+	for i, course := range courses {
+		ids[i] = course.ID
+	}
+	return ids
+}
+
+// EnrollmentRequest is the body of POST /api/course/{id}/persons (person_id)
+// and POST /api/person/{id}/courses (course_id). Role defaults to the role of
+// the person's type.
+type EnrollmentRequest struct {
+	PersonID int    `json:"person_id,omitempty"`
+	CourseID int    `json:"course_id,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// RosterRequest is the body of PUT /api/course/{id}/persons.
+type RosterRequest struct {
+	PersonIDs []int `json:"person_ids"`
+}
+
+// HolidaysRequest is the body of PUT /api/term/{id}/holidays.
+type HolidaysRequest struct {
+	Holidays []Holiday `json:"holidays"`
+}
+
+// CalendarToken authorizes reads of the schedule feed of a person. Only the
+// hash of the token is kept; the token itself is shown once, when issued.
+type CalendarToken struct {
+	PersonID  int       `json:"person_id" gorm:"column:person_id;primaryKey"`
+	TokenHash string    `json:"-" gorm:"column:token_hash"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (CalendarToken) TableName() string {
+	return "calendar_token"
+}
+
+// AccessToken authenticates a person to the API as a bearer token. Only the
+// hash of the token is kept; the token itself is shown once, when issued.
+type AccessToken struct {
+	PersonID  int       `json:"person_id" gorm:"column:person_id;primaryKey"`
+	TokenHash string    `json:"-" gorm:"column:token_hash"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (AccessToken) TableName() string {
+	return "access_token"
+}
+
+// AdvisorAssignment makes a professor the advisor of a student from StartedAt
+// until EndedAt. A student has at most one current assignment, the one that
+// has not ended.
+type AdvisorAssignment struct {
+	ID        int        `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	StudentID int        `json:"student_id" gorm:"column:student_id"`
+	AdvisorID int        `json:"advisor_id" gorm:"column:advisor_id"`
+	StartedAt time.Time  `json:"started_at" gorm:"column:started_at"`
+	EndedAt   *time.Time `json:"ended_at" gorm:"column:ended_at"`
+	// StudentType and AdvisorType repeat the types of the persons of a
+	// current assignment for the keys that keep them a student and a
+	// professor. Ending the assignment clears them.
+	StudentType *string `json:"-" gorm:"column:student_type"`
+	AdvisorType *string `json:"-" gorm:"column:advisor_type"`
+}
+
+func (AdvisorAssignment) TableName() string {
+	return "advisor_assignment"
+}
+
+// AdvisorRequest is the body of PUT /api/person/{id}/advisor.
+type AdvisorRequest struct {
+	AdvisorID int `json:"advisor_id" validate:"required"`
+}
+
+// RequirementsRequest is the body of PUT /api/program/{id}/requirements.
+type RequirementsRequest struct {
+	Requirements []Requirement `json:"requirements"`
+}
+
+// MeetingsRequest is the body of PUT /api/offering/{id}/meetings.
+type MeetingsRequest struct {
+	Meetings []Meeting `json:"meetings"`
+}
+
+// PrerequisiteRequest is the body of POST /api/course/{id}/prerequisites.
+type PrerequisiteRequest struct {
+	CourseID int `json:"course_id" validate:"required"`
+}
+
+// GradeRequest is the body of PUT /api/offering/{id}/persons/{personId}/grade.
+// Reason is required to change a grade once the term has ended.
+type GradeRequest struct {
+	Grade  string `json:"grade" validate:"required,oneof=A A- B+ B B- C+ C C- D+ D D- F P W I"`
+	Reason string `json:"reason,omitempty" validate:"max=500"`
+}
+
+// Transcript lists the courses a student took by term. CreditHours sums
+// those of every course, graded or not, and GPA is the cumulative one.
+type Transcript struct {
+	PersonID    int              `json:"person_id"`
+	Terms       []TranscriptTerm `json:"terms"`
+	CreditHours int              `json:"credit_hours"`
+	GPA         *float64         `json:"gpa"`
+}
+
+// TranscriptTerm holds the courses of one term, with the GPA of the term and
+// the cumulative GPA up to and including it.
+type TranscriptTerm struct {
+	TermID        int                `json:"term_id"`
+	Name          string             `json:"name"`
+	StartDate     Date               `json:"start_date"`
+	EndDate       Date               `json:"end_date"`
+	Courses       []TranscriptCourse `json:"courses"`
+	CreditHours   int                `json:"credit_hours"`
+	GPA           *float64           `json:"gpa"`
+	CumulativeGPA *float64           `json:"cumulative_gpa"`
+}
+
+type TranscriptCourse struct {
+	CourseID    int      `json:"course_id"`
+	Name        string   `json:"name"`
+	OfferingID  int      `json:"offering_id"`
+	Section     string   `json:"section"`
+	CreditHours int      `json:"credit_hours"`
+	Grade       *string  `json:"grade"`
+	GradePoints *float64 `json:"grade_points"`
+}
+
+// ScheduleRequest is the body of PUT /api/person/{id}/courses.
+type ScheduleRequest struct {
+	CourseIDs []int `json:"course_ids"`
+}
+
+// Progress of a course or requirement in a degree audit.
+const (
+	ProgressCompleted  = "completed"
+	ProgressInProgress = "in_progress"
+	ProgressSatisfied  = "satisfied"
+	// ProgressPending is the status of a requirement that the courses in
+	// progress would satisfy once completed.
+	ProgressPending     = "pending"
+	ProgressUnsatisfied = "unsatisfied"
+)
+
+// DegreeAudit checks a student against the requirements of their major.
+// Complete is set when every requirement is satisfied; pending ones are
+// listed with the unsatisfied ones.
+type DegreeAudit struct {
+	PersonID          int                `json:"person_id"`
+	ProgramID         int                `json:"program_id"`
+	Complete          bool               `json:"complete"`
+	CompletedCredits  int                `json:"completed_credits"`
+	InProgressCredits int                `json:"in_progress_credits"`
+	GPA               *float64           `json:"gpa"`
+	Satisfied         []RequirementAudit `json:"satisfied"`
+	Unsatisfied       []RequirementAudit `json:"unsatisfied"`
+}
+
+// RequirementAudit is the status of one requirement with the courses that
+// count toward it. Remaining lists the courses of a courses or electives
+// requirement that the student has not taken yet, while it is unsatisfied.
+type RequirementAudit struct {
+	Requirement
+	Status    string              `json:"status"`
+	Courses   []DegreeAuditCourse `json:"courses"`
+	Remaining []int               `json:"remaining_course_ids,omitempty"`
+}
+
+// DegreeAuditCourse is a course a student completed or is taking.
+type DegreeAuditCourse struct {
+	CourseID    int     `json:"course_id"`
+	Name        string  `json:"name"`
+	Code        string  `json:"code,omitempty"`
+	CreditHours int     `json:"credit_hours"`
+	Grade       *string `json:"grade,omitempty"`
+	Status      string  `json:"status"`
+}
+
+// ImportReport is the outcome of an import. Imported counts the rows of each
+// file that were imported, or that a dry run would import, and Waitlisted the
+// enrollments among them that joined a waitlist. Errors lists the failed
+// rows; when there are any, nothing was imported.
+type ImportReport struct {
+	DryRun     bool          `json:"dry_run"`
+	Imported   ImportCounts  `json:"imported"`
+	Waitlisted int           `json:"waitlisted"`
+	Errors     []ImportError `json:"errors"`
+}
+
+type ImportCounts struct {
+	Courses     int `json:"courses"`
+	Persons     int `json:"persons"`
+	Enrollments int `json:"enrollments"`
+}
+
+// ImportError is the problem a row failed with. Line is the line of the row
+// in its file, counting the header as line 1.
+type ImportError struct {
+	File   string       `json:"file"`
+	Line   int          `json:"line"`
+	Code   ProblemCode  `json:"code"`
+	Detail string       `json:"detail"`
+	Errors []FieldError `json:"errors,omitempty"`
 }
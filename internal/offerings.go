@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var OfferingSortColumns = []string{"id", "section"}
+
+// offeringFilterParams are the query parameters accepted by GET
+// /api/offering, in addition to the pagination parameters.
+var offeringFilterParams = []string{"course_id", "term_id"}
+
+func (s *Server) GetOfferings(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, OfferingSortColumns)
+	if !ok {
+		return
+	}
+	for key := range r.URL.Query() {
+		if !slices.Contains(offeringFilterParams, key) && !slices.Contains(pageParams, key) {
+			WriteProblem(w, http.StatusBadRequest, CodeUnknownParameter, "Unknown query parameter '%v'.", key)
+			return
+		}
+	}
+	courseID, ok := parseOptionalInt(w, r, "course_id")
+	if !ok {
+		return
+	}
+	termID, ok := parseOptionalInt(w, r, "term_id")
+	if !ok {
+		return
+	}
+	var filter OfferingFilter
+	if courseID != nil {
+		filter.CourseID = *courseID
+	}
+	if termID != nil {
+		filter.TermID = *termID
+	}
+
+	offerings, total, err := s.store.ListOfferings(filter, page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	offerings = writePage(w, r, page, offerings, total)
+	if offerings == nil {
+		offerings = []CourseOffering{}
+	}
+	render.JSON(w, r, offerings)
+}
+
+func (s *Server) GetOffering(w http.ResponseWriter, r *http.Request) {
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, offering)
+}
+
+func (s *Server) CreateOffering(w http.ResponseWriter, r *http.Request) {
+	var newOffering CourseOffering
+	if err := CheckJSON(w, r, &newOffering); err != nil {
+		return
+	}
+	if !s.validateOffering(w, newOffering) {
+		return
+	}
+
+	if err := s.audited(r).CreateOffering(&newOffering); err != nil {
+		handleOfferingWriteError(w, newOffering, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]int{"id": newOffering.ID})
+}
+
+func (s *Server) UpdateOffering(w http.ResponseWriter, r *http.Request) {
+	var newOffering CourseOffering
+	if err := CheckJSON(w, r, &newOffering); err != nil {
+		return
+	}
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+	newOffering.ID = offering.ID
+	if !s.validateOffering(w, newOffering) {
+		return
+	}
+
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if err := tx.UpdateOffering(&newOffering); err != nil {
+			handleOfferingWriteError(w, newOffering, err)
+			return err
+		}
+		if newOffering.TermID == offering.TermID {
+			return nil
+		}
+		// The meetings and enrollments move to the new term with the
+		// offering.
+		meetings, err := tx.ListMeetings(MeetingFilter{OfferingIDs: []int{offering.ID}})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return err
+		}
+		if err := checkRooms(w, tx, newOffering, meetings); err != nil {
+			return err
+		}
+		return checkOfferingSchedules(w, tx, offering.ID)
+	})
+	if err != nil {
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, newOffering)
+}
+
+func (s *Server) DeleteOffering(w http.ResponseWriter, r *http.Request) {
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.audited(r).DeleteOffering(offering.ID)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Offering with id '%v' still has enrollments or a waitlist.", offering.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Deletion Successful."})
+}
+
+/*
+Offering roster: /api/offering/{id}/persons
+*/
+
+func (s *Server) GetOfferingPersons(w http.ResponseWriter, r *http.Request) {
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+
+	persons, err := s.store.ListOfferingPersons(offering.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, NewPersonResponses(persons))
+}
+
+func (s *Server) EnrollOfferingPerson(w http.ResponseWriter, r *http.Request) {
+	var req EnrollmentRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+	if !writeValidationProblem(w, validateRole(req.Role)) {
+		return
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
+
+	e := PersonCourse{PersonID: req.PersonID, CourseID: offering.CourseID, OfferingID: offering.ID, Role: req.Role}
+	var entry *WaitlistEntry
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if !personsExist(w, tx, []int{req.PersonID}) {
+			return errMissingReference
+		}
+		if err := checkEnrollment(w, tx, &e, enforced); err != nil {
+			return err
+		}
+		var err error
+		entry, err = tx.EnrollOffering(&e)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			WriteProblem(w, http.StatusConflict, CodeAlreadyEnrolled, "Person with id '%v' is already enrolled in offering '%v'.", req.PersonID, offering.ID)
+			return err
+		} else if errors.Is(err, ErrAlreadyWaitlisted) {
+			WriteProblem(w, http.StatusConflict, CodeAlreadyWaitlisted, "Person with id '%v' is already waitlisted for offering '%v'.", req.PersonID, offering.ID)
+			return err
+		} else if err != nil {
+			handleEnrollmentError(w, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	writeEnrollment(w, r, e, entry)
+}
+
+func (s *Server) DropOfferingPerson(w http.ResponseWriter, r *http.Request) {
+	personID, err := ParseIntParam(w, r, "personId")
+	if err != nil {
+		return
+	}
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+
+	err = s.audited(r).DropOffering(offering.ID, personID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotEnrolled, "Person with id '%v' is not enrolled in or waitlisted for offering '%v'.", personID, offering.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Enrollment removed."})
+}
+
+// GetPersonOfferings lists the offerings a person is enrolled in.
+func (s *Server) GetPersonOfferings(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	offerings, err := s.store.ListPersonOfferings(person.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if offerings == nil {
+		offerings = []CourseOffering{}
+	}
+	render.JSON(w, r, offerings)
+}
+
+// findOffering loads the offering identified by the {id} URL parameter,
+// writing a 404 when it does not exist.
+func (s *Server) findOffering(w http.ResponseWriter, r *http.Request) (CourseOffering, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return CourseOffering{}, false
+	}
+
+	offering, err := s.store.GetOffering(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Offering with id '%v' not found.", id)
+		return CourseOffering{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return CourseOffering{}, false
+	}
+	return offering, true
+}
+
+// validateOffering checks the validate rules of offering and that its course
+// and term exist, writing a 400 listing all violations.
+func (s *Server) validateOffering(w http.ResponseWriter, offering CourseOffering) bool {
+	errs := Validate(offering)
+	if offering.CourseID != 0 {
+		missing, err := s.store.MissingCourseIDs([]int{offering.CourseID})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+		if len(missing) > 0 {
+			errs = append(errs, FieldError{Field: "course_id", Code: "exists", Message: fmt.Sprintf("Course with id '%v' does not exist.", offering.CourseID)})
+		}
+	}
+	if offering.TermID != 0 {
+		_, err := s.store.GetTerm(offering.TermID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs = append(errs, FieldError{Field: "term_id", Code: "exists", Message: fmt.Sprintf("Term with id '%v' does not exist.", offering.TermID)})
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
+
+func handleOfferingWriteError(w http.ResponseWriter, offering CourseOffering, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Course '%v' already has section '%v' in term '%v'.", offering.CourseID, offering.Section, offering.TermID)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Offering with id '%v' has enrollments or a waitlist, so it cannot move to another course.", offering.ID)
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
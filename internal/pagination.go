@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+var (
+	PersonSortColumns = []string{"id", "first_name", "last_name", "type", "age"}
+	CourseSortColumns = []string{"id", "name"}
+)
+
+// SortField orders a list by one whitelisted column.
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Page selects a window of a sorted list. Rows are ordered by Sort and then
+// by id. When After is set the window starts after the row whose sort values
+// (followed by its id) it holds; otherwise it starts Offset rows in. A zero
+// Limit returns every remaining row.
+type Page struct {
+	Limit  int
+	Offset int
+	Sort   []SortField
+	After  []any
+}
+
+// sortable is implemented by the models that can be listed page by page.
+type sortable interface {
+	sortValue(column string) any
+}
+
+// pageRequest is a Page parsed from the limit, offset, cursor and sort query
+// parameters.
+type pageRequest struct {
+	Page
+	sortSpec string
+	// byOffset is set when the client asked for offset pagination. Otherwise
+	// the next page is addressed with a cursor, which stays stable when rows
+	// are inserted concurrently.
+	byOffset bool
+}
+
+// pageCursor is the opaque value of the cursor query parameter.
+type pageCursor struct {
+	Sort  string `json:"sort"`
+	After []any  `json:"after"`
+}
+
+// ParsePage reads the pagination and sort query parameters, validating sort
+// columns against columns. It writes a 400 and returns false when they are
+// invalid.
+func ParsePage(w http.ResponseWriter, r *http.Request, columns []string) (pageRequest, bool) {
+	req := pageRequest{Page: Page{Limit: DefaultPageLimit}}
+	query := r.URL.Query()
+
+	if val := query.Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid limit '%v' on query parameter. Must be an integer between 1 and %d.", val, MaxPageLimit)
+			return req, false
+		}
+		req.Limit = limit
+	}
+
+	if val := query.Get("offset"); val != "" {
+		offset, err := strconv.Atoi(val)
+		if err != nil || offset < 0 {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid offset '%v' on query parameter. Must be a non-negative integer.", val)
+			return req, false
+		}
+		req.Offset = offset
+		req.byOffset = true
+	}
+
+	if val := query.Get("sort"); val != "" {
+		for _, field := range strings.Split(val, ",") {
+			column, desc := strings.CutPrefix(strings.TrimSpace(field), "-")
+			if !slices.Contains(columns, column) {
+				WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid sort field '%v'. Must be one of %v, optionally prefixed with '-'.", column, strings.Join(columns, ", "))
+				return req, false
+			}
+			req.Sort = append(req.Sort, SortField{Column: column, Desc: desc})
+		}
+	}
+	req.sortSpec = sortSpec(req.Sort)
+
+	if val := query.Get("cursor"); val != "" {
+		if req.byOffset {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "The cursor and offset query parameters cannot be combined.")
+			return req, false
+		}
+		after, err := decodeCursor(val, req.sortSpec, len(req.Sort)+1)
+		if err != nil {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid cursor on query parameter: %v.", err)
+			return req, false
+		}
+		req.After = after
+	}
+	return req, true
+}
+
+// fetch is the Page to request from the store: one row more than the limit,
+// so the handler can tell whether a next page exists.
+func (req pageRequest) fetch() Page {
+	page := req.Page
+	page.Limit++
+	return page
+}
+
+// writePage trims the extra row requested by fetch, and sets the
+// X-Total-Count and RFC 8288 Link headers.
+func writePage[T sortable](w http.ResponseWriter, r *http.Request, req pageRequest, items []T, total int64) []T {
+	hasNext := len(items) > req.Limit
+	if hasNext {
+		items = items[:req.Limit]
+	}
+
+	var links []string
+	link := func(rel string, set map[string]string) {
+		query := r.URL.Query()
+		query.Del("cursor")
+		query.Del("offset")
+		for key, val := range set {
+			query.Set(key, val)
+		}
+		url := r.URL.Path
+		if encoded := query.Encode(); encoded != "" {
+			url += "?" + encoded
+		}
+		links = append(links, fmt.Sprintf(`<%v>; rel="%v"`, url, rel))
+	}
+
+	if req.byOffset {
+		link("first", map[string]string{"offset": "0"})
+		if req.Offset > 0 {
+			link("prev", map[string]string{"offset": strconv.Itoa(max(req.Offset-req.Limit, 0))})
+		}
+		if hasNext {
+			link("next", map[string]string{"offset": strconv.Itoa(req.Offset + req.Limit)})
+		}
+		if total > 0 {
+			last := (int(total) - 1) / req.Limit * req.Limit
+			link("last", map[string]string{"offset": strconv.Itoa(last)})
+		}
+	} else {
+		link("first", nil)
+		if hasNext {
+			cursor := encodeCursor(req.sortSpec, cursorValues(items[len(items)-1], req.Sort))
+			link("next", map[string]string{"cursor": cursor})
+		}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	w.Header().Set("Link", strings.Join(links, ", "))
+	return items
+}
+
+func sortSpec(sort []SortField) string {
+	fields := make([]string, len(sort))
+	for i, field := range sort {
+		fields[i] = field.Column
+		if field.Desc {
+			fields[i] = "-" + field.Column
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func cursorValues(item sortable, sort []SortField) []any {
+	values := make([]any, 0, len(sort)+1)
+	for _, field := range sort {
+		values = append(values, item.sortValue(field.Column))
+	}
+	return append(values, item.sortValue("id"))
+}
+
+func encodeCursor(spec string, after []any) string {
+	data, _ := json.Marshal(pageCursor{Sort: spec, After: after})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(val string, spec string, size int) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return nil, errors.New("not a cursor returned by this API")
+	}
+	var cursor pageCursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&cursor); err != nil || len(cursor.After) != size {
+		return nil, errors.New("not a cursor returned by this API")
+	}
+	if cursor.Sort != spec {
+		return nil, fmt.Errorf("cursor was issued for sort '%v'", cursor.Sort)
+	}
+	for i, val := range cursor.After {
+		switch v := val.(type) {
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return nil, errors.New("not a cursor returned by this API")
+			}
+			cursor.After[i] = int(n)
+		case string:
+		default:
+			return nil, errors.New("not a cursor returned by this API")
+		}
+	}
+	return cursor.After, nil
+}
+
+// compareSortValues orders two values of the same sort column.
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		b, _ := b.(int)
+		return a - b
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	}
+	return 0
+}
+
+// comparePage orders a and b as the store orders rows for page.
+func comparePage(a, b sortable, page Page) int {
+	for _, field := range page.Sort {
+		if c := compareSortValues(a.sortValue(field.Column), b.sortValue(field.Column)); c != 0 {
+			if field.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return compareSortValues(a.sortValue("id"), b.sortValue("id"))
+}
+
+// afterCursor reports whether item sorts after the cursor values of page.
+func afterCursor(item sortable, page Page) bool {
+	for i, field := range page.Sort {
+		c := compareSortValues(item.sortValue(field.Column), page.After[i])
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c > 0
+		}
+	}
+	return compareSortValues(item.sortValue("id"), page.After[len(page.Sort)]) > 0
+}
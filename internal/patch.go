@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+PATCH support.
+
+A PATCH body is applied to the JSON representation of the current resource,
+and the result is decoded and validated like a PUT body. Two formats are
+accepted, selected by Content-Type:
+
+	application/merge-patch+json  RFC 7396: members present in the patch
+	                              replace the current ones, null removes them
+	application/json-patch+json   RFC 6902: a list of add, remove, replace,
+	                              move, copy and test operations
+*/
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// ErrPatchTestFailed is returned by ApplyJSONPatch when a test operation does
+// not match the document.
+var ErrPatchTestFailed = errors.New("test operation failed")
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyMergePatch applies the RFC 7396 merge patch to the JSON document doc.
+func ApplyMergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target, changes any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, errors.New("patch is not valid JSON")
+	}
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target any, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(object, key)
+		} else {
+			object[key] = mergePatch(object[key], value)
+		}
+	}
+	return object
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON Patch to the JSON document doc.
+// Operations are applied in order and the patch fails as a whole.
+func ApplyJSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	var ops []PatchOperation
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, errors.New("patch must be a JSON array of operations")
+	}
+	var target any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		if target, err = applyOperation(target, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%v %v): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(target any, op PatchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if slices.Equal(path, from) {
+				// Moving a value onto itself, the whole document included,
+				// leaves it in place.
+				_, err := getValue(target, from)
+				return target, err
+			}
+			if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			target, value, err = removeValue(target, from)
+		} else {
+			value, err = getValue(target, from)
+			value = cloneValue(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addValue(target, path, value)
+	case "remove":
+		target, _, err = removeValue(target, path)
+		return target, err
+	case "replace":
+		if len(path) == 0 {
+			// Replacing the root replaces the whole document.
+			return value, nil
+		}
+		if target, _, err = removeValue(target, path); err != nil {
+			return nil, err
+		}
+		return addValue(target, path, value)
+	case "test":
+		current, err := getValue(target, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return target, nil
+	default:
+		return nil, fmt.Errorf("unknown op '%v'", op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer '%v'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array reference token that must be below limit.
+func arrayIndex(token string, limit int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= limit || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%v'", token)
+	}
+	return i, nil
+}
+
+func getValue(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path member '%v' does not exist", token)
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path member '%v' does not exist", token)
+		}
+	}
+	return node, nil
+}
+
+// addValue returns node with value added at path. The parent of path must
+// exist; "-" appends to an array.
+func addValue(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("path member '%v' does not exist", token)
+		}
+		child, err := addValue(child, rest, value)
+		n[token] = child
+		return n, err
+	case []any:
+		if len(rest) == 0 {
+			if token == "-" {
+				return append(n, value), nil
+			}
+			i, err := arrayIndex(token, len(n)+1)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(n, i, value), nil
+		}
+		i, err := arrayIndex(token, len(n))
+		if err != nil {
+			return nil, err
+		}
+		n[i], err = addValue(n[i], rest, value)
+		return n, err
+	default:
+		return nil, fmt.Errorf("path member '%v' does not exist", token)
+	}
+}
+
+// removeValue returns node without the value at path, and that value.
+func removeValue(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member '%v' does not exist", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := removeValue(child, rest)
+		n[token] = child
+		return n, removed, err
+	case []any:
+		i, err := arrayIndex(token, len(n))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[i]
+			return slices.Delete(n, i, i+1), removed, nil
+		}
+		child, removed, err := removeValue(n[i], rest)
+		n[i] = child
+		return n, removed, err
+	default:
+		return nil, nil, fmt.Errorf("path member '%v' does not exist", token)
+	}
+}
+
+func cloneValue(value any) any {
+	data, _ := json.Marshal(value)
+	var clone any
+	_ = json.Unmarshal(data, &clone)
+	return clone
+}
+
+// readPatch applies the PATCH request body to the JSON representation of
+// current and decodes the result into patched. It writes a 415 for an
+// unsupported Content-Type, a 409 when a JSON Patch test fails and a 400 when
+// the patch or its result is invalid, and returns false in those cases.
+func readPatch(w http.ResponseWriter, r *http.Request, current any, patched any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+
+	switch mediaType(r) {
+	case MergePatchContentType:
+		doc, err = ApplyMergePatch(doc, body)
+	case JSONPatchContentType:
+		doc, err = ApplyJSONPatch(doc, body)
+	default:
+		WriteProblem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type header must be %v or %v.", MergePatchContentType, JSONPatchContentType)
+		return false
+	}
+	if errors.Is(err, ErrPatchTestFailed) {
+		WriteProblem(w, http.StatusConflict, CodePatchTestFailed, "JSON Patch %v.", err)
+		return false
+	} else if err != nil {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidPatch, "Invalid patch: %v.", err)
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patched); err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	return true
+}
@@ -4,65 +4,112 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-func GetPersons(w http.ResponseWriter, r *http.Request) {
-	query := DB
+var errInvalidAffiliation = errors.New("department or major does not fit the person type")
 
-	age, err := ParseIntQuery(w, r, "age")
-	if (err != nil) && (err != ErrNoParameter) {
+func (s *Server) GetPersons(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, PersonSortColumns)
+	if !ok {
 		return
-	} else if !errors.Is(err, ErrNoParameter) {
-		query = query.Where("age = ?", age)
 	}
-	name := r.URL.Query().Get("name")
-	if name != "" {
-		query, err = QueryName(w, DB, name)
-		if err != nil {
-			return
-		}
+	filter, ok := ParsePersonFilter(w, r)
+	if !ok {
+		return
+	}
+	store, ok := s.readStore(w, r)
+	if !ok {
+		return
+	}
+	format, ok := listFormat(w, r)
+	if !ok {
+		return
+	}
+	if format == CSVMediaType {
+		exportPersons(w, r, store, filter, page)
+		return
 	}
 
-	var persons []Person
-	if err = LoadAllPersonCourses(query, &persons); err != nil {
+	persons, total, err := store.ListPersons(filter, page.fetch())
+	if err != nil {
 		HandleDBErrorGeneric(w, err)
+		return
 	}
-	render.JSON(w, r, persons)
+	persons = writePage(w, r, page, persons, total)
+	render.JSON(w, r, NewPersonResponses(persons))
 }
 
-func GetPerson(w http.ResponseWriter, r *http.Request) {
-	name := chi.URLParam(r, "name")
-	query, err := QueryName(w, DB, name)
+func (s *Server) GetPerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByName(w, r)
+	if !ok {
+		return
+	}
+	if notModified(w, r, person.ETag()) {
+		return
+	}
+	render.JSON(w, r, person.Response())
+}
+
+func (s *Server) GetPersonByID(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.readStore(w, r)
+	if !ok {
+		return
+	}
+	person, ok := s.findPersonByID(w, r, store)
+	if !ok {
+		return
+	}
+	if notModified(w, r, person.ETag()) {
+		return
+	}
+	render.JSON(w, r, person.Response())
+}
+
+// ResolvePersonName lists every person matching the "name" query parameter,
+// so clients can pick the ID to use with the /api/person/{id} routes.
+func (s *Server) ResolvePersonName(w http.ResponseWriter, r *http.Request) {
+	name, err := ParseName(w, r.URL.Query().Get("name"))
 	if err != nil {
 		return
 	}
-	var person Person
-	if err = LoadPersonCourses(query, &person); err != nil {
-		http.Error(w, fmt.Sprintf("Person with name '%v' not found.", name), http.StatusNotFound)
+
+	persons, err := s.store.FindPersonsByName(name)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
 		return
 	}
-	render.JSON(w, r, person)
+	render.JSON(w, r, NewPersonResponses(persons))
 }
 
-func CreatePerson(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreatePerson(w http.ResponseWriter, r *http.Request) {
 	var newPerson Person
-	if err = CheckJSON(w, r, &newPerson); err != nil {
+	if err := CheckJSON(w, r, &newPerson); err != nil {
 		return
 	}
-
-	if err = DB.Create(&newPerson).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
-		http.Error(w, fmt.Sprintf("JSON id '%v' conflicts with existing person data.", newPerson.ID), http.StatusConflict)
+	if !s.validatePerson(w, newPerson) || !writeValidationProblem(w, affiliationErrors(newPerson)) {
 		return
-	} else if errors.Is(err, gorm.ErrCheckConstraintViolated) {
-		http.Error(w, fmt.Sprintf("Invalid type '%v'. Type must be either 'student' or 'professor'.", newPerson.Type), http.StatusBadRequest)
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
 		return
-	} else if err != nil {
-		HandleDBErrorGeneric(w, err)
+	}
+
+	err := s.audited(r).Transaction(func(tx Store) error {
+		if enforced && !checkPrerequisites(w, tx, []Person{{Type: newPerson.Type}}, courseIDs(newPerson.Courses), "") {
+			return errMissingPrerequisites
+		}
+		if err := tx.CreatePerson(&newPerson); err != nil {
+			handlePersonWriteError(w, newPerson, err)
+			return err
+		}
+		return checkAddedSchedules(w, tx, nil, EnrollmentFilter{PersonID: newPerson.ID})
+	})
+	if err != nil {
 		return
 	}
 
@@ -73,97 +120,335 @@ func CreatePerson(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func UpdatePerson(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdatePerson(w http.ResponseWriter, r *http.Request) {
 	var newPerson Person
-	if err = CheckJSON(w, r, &newPerson); err != nil {
+	if err := CheckJSON(w, r, &newPerson); err != nil {
 		return
 	}
 
-	name := chi.URLParam(r, "name")
-	query, err := QueryName(w, DB, name)
-	if err != nil {
+	person, ok := s.findPersonByName(w, r)
+	if !ok {
 		return
 	}
+	s.updatePerson(w, r, person, newPerson)
+}
 
-	var person Person
-	if err = LoadPersonCourses(query, &person); errors.Is(err, logger.ErrRecordNotFound) {
-		http.Error(w, fmt.Sprintf("Course with name '%v' not found.", name), http.StatusNotFound)
+func (s *Server) UpdatePersonByID(w http.ResponseWriter, r *http.Request) {
+	var newPerson Person
+	if err := CheckJSON(w, r, &newPerson); err != nil {
 		return
-	} else if err != nil {
-		HandleDBErrorGeneric(w, err)
+	}
+
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
 		return
-	} else {
+	}
+	s.updatePerson(w, r, person, newPerson)
+}
 
-		err = DB.Transaction(func(db *gorm.DB) error {
-			if len(person.Courses) > 0 {
-				if err = db.Model(&person).Association("Courses").Delete(person.Courses); err != nil {
-					HandleDBErrorGeneric(w, err)
-					return err
-				}
-			}
+func (s *Server) PatchPerson(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByName(w, r)
+	if !ok {
+		return
+	}
+	s.patchPerson(w, r, person)
+}
+
+func (s *Server) PatchPersonByID(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+	s.patchPerson(w, r, person)
+}
+
+// patchPerson applies the PATCH body to person and writes the result like a
+// PUT. Courses are only rewritten when the patch changed them.
+func (s *Server) patchPerson(w http.ResponseWriter, r *http.Request, person Person) {
+	var newPerson Person
+	if !readPatch(w, r, person.JSON(), &newPerson) {
+		return
+	}
+	if slices.Equal(courseIDs(newPerson.Courses), courseIDs(person.Courses)) {
+		newPerson.Courses = nil
+	} else if newPerson.Courses == nil {
+		// The patch removed the courses member.
+		newPerson.Courses = []Course{}
+	}
+	s.updatePerson(w, r, person, newPerson)
+}
+
+func (s *Server) updatePerson(w http.ResponseWriter, r *http.Request, person Person, newPerson Person) {
+	if !checkIfMatch(w, r, person.ETag(), fmt.Sprintf("person '%v'", person.ID)) {
+		return
+	}
+	newPerson.ID = person.ID
+	newPerson.Version = expectedVersion(r, person.Version)
+	if !s.validatePerson(w, newPerson) {
+		return
+	}
+	enforced, ok := s.prerequisitesEnforced(w, r)
+	if !ok {
+		return
+	}
 
-			newPerson.ID = person.ID
-			if err := db.Updates(&newPerson).Error; errors.Is(err, gorm.ErrCheckConstraintViolated) {
-				http.Error(w, fmt.Sprintf("Invalid type '%v'. Type must be either 'student' or 'professor'.", newPerson.Type), http.StatusBadRequest)
+	err := s.audited(r).Transaction(func(tx Store) error {
+		// Only courses person is not enrolled in yet are checked, with the
+		// type it is changing to.
+		student := Person{ID: person.ID, Type: newPerson.Type, Courses: person.Courses}
+		if enforced && newPerson.Courses != nil && !checkPrerequisites(w, tx, []Person{student}, courseIDs(newPerson.Courses), "") {
+			return errMissingPrerequisites
+		}
+		// Instructors, chairs and advisors must stay professors, including
+		// instructors of deleted courses, and advisees students.
+		if person.Type == "professor" && newPerson.Type != "professor" {
+			teaching, err := tx.WithDeleted().ListEnrollments(EnrollmentFilter{PersonID: person.ID, Role: RoleInstructor})
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
 				return err
-			} else if err != nil {
+			} else if len(teaching) > 0 {
+				WriteProblem(w, http.StatusUnprocessableEntity, CodeNotProfessor, "Person with id '%v' instructs offering '%v', so they must stay a professor.", person.ID, teaching[0].OfferingID)
+				return errNotProfessor
+			}
+			departments, _, err := tx.ListDepartments(Page{})
+			if err != nil {
 				HandleDBErrorGeneric(w, err)
 				return err
 			}
-
-			newPerson, err = LoadPerson(db, newPerson)
+			for _, department := range departments {
+				if department.ChairID != nil && *department.ChairID == person.ID {
+					WriteProblem(w, http.StatusUnprocessableEntity, CodeNotProfessor, "Person with id '%v' chairs department '%v', so they must stay a professor.", person.ID, department.Code)
+					return errNotProfessor
+				}
+			}
+			advisees, err := tx.ListAdvisorAssignments(AdvisorFilter{AdvisorID: person.ID, Current: true})
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
+				return err
+			} else if len(advisees) > 0 {
+				WriteProblem(w, http.StatusUnprocessableEntity, CodeNotProfessor, "Person with id '%v' advises student '%v', so they must stay a professor.", person.ID, advisees[0].StudentID)
+				return errNotProfessor
+			}
+		}
+		if person.Type == "student" && newPerson.Type != "student" {
+			advisors, err := tx.ListAdvisorAssignments(AdvisorFilter{StudentID: person.ID, Current: true})
 			if err != nil {
 				HandleDBErrorGeneric(w, err)
 				return err
+			} else if len(advisors) > 0 {
+				WriteProblem(w, http.StatusUnprocessableEntity, CodeNotStudent, "Person with id '%v' is advised by professor '%v', so they must stay a student.", person.ID, advisors[0].AdvisorID)
+				return errNotStudent
 			}
-			return nil
-		})
+		}
+		if !writeValidationProblem(w, affiliationErrors(newPerson)) {
+			return errInvalidAffiliation
+		}
+		filter := EnrollmentFilter{PersonID: person.ID}
+		before, err := tx.ListEnrollments(filter)
 		if err != nil {
-			return
+			HandleDBErrorGeneric(w, err)
+			return err
 		}
-
+		if err := tx.UpdatePerson(&newPerson); err != nil {
+			handlePersonWriteError(w, newPerson, err)
+			return err
+		}
+		return checkAddedSchedules(w, tx, before, filter)
+	})
+	if err != nil {
+		return
 	}
 
+	w.Header().Set("ETag", newPerson.ETag())
 	render.Status(r, http.StatusAccepted)
-	render.JSON(w, r, newPerson)
+	render.JSON(w, r, newPerson.Response())
 }
 
-func DeletePerson(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeletePerson(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
-	query, err := QueryName(w, DB, name)
+	normalized, err := ParseName(w, name)
+	if err != nil {
+		return
+	}
+
+	persons, err := s.store.FindPersonsByName(normalized)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	switch len(persons) {
+	case 0:
+		output := map[string]string{"message": fmt.Sprintf("No person found with name '%v'", name)}
+		render.JSON(w, r, output)
+	case 1:
+		s.deletePerson(w, r, persons[0])
+	default:
+		writeAmbiguousName(w, name, persons)
+	}
+}
+
+func (s *Server) DeletePersonByID(w http.ResponseWriter, r *http.Request) {
+	id, err := ParseIntParam(w, r, "id")
 	if err != nil {
 		return
 	}
 
-	var person Person
+	person, err := s.store.GetPerson(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		output := map[string]string{"message": fmt.Sprintf("No person found with id '%v'", id)}
+		render.JSON(w, r, output)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	s.deletePerson(w, r, person)
+}
+
+func (s *Server) deletePerson(w http.ResponseWriter, r *http.Request, person Person) {
+	resource := fmt.Sprintf("person '%v'", person.ID)
+	if !checkIfMatch(w, r, person.ETag(), resource) {
+		return
+	}
+
 	var msg string
-	if err = LoadPersonCourses(query, &person); errors.Is(err, logger.ErrRecordNotFound) {
-		msg = fmt.Sprintf("No person found with name '%v'", name)
-		// render.Status(r, http.StatusNoContent)
+	if err := s.audited(r).DeletePerson(person.ID, expectedVersion(r, person.Version)); errors.Is(err, gorm.ErrRecordNotFound) {
+		msg = fmt.Sprintf("No person found with id '%v'", person.ID)
+	} else if errors.Is(err, ErrVersionConflict) {
+		writeVersionConflict(w, resource)
+		return
 	} else if err != nil {
 		HandleDBErrorGeneric(w, err)
 		return
 	} else {
-		err = DB.Transaction(func(db *gorm.DB) error {
-			if len(person.Courses) > 0 {
-				if err = db.Model(&person).Association("Courses").Delete(person.Courses); err != nil {
-					HandleDBErrorGeneric(w, err)
-					return err
-				}
-			}
-
-			if err := db.Delete(&person).Error; err != nil {
-				HandleDBErrorGeneric(w, err)
-				return err
-			}
-			return nil
-		})
-		if err != nil {
-			return
-		}
 		msg = "Deletion Successful."
 	}
 
 	output := map[string]string{"message": msg}
 	render.JSON(w, r, output)
 }
+
+// findPersonByName loads the single person matching the {name} URL parameter.
+// It writes a 404 when nobody matches and a 409 listing the candidate IDs when
+// the name is shared by several persons.
+func (s *Server) findPersonByName(w http.ResponseWriter, r *http.Request) (Person, bool) {
+	name := chi.URLParam(r, "name")
+	normalized, err := ParseName(w, name)
+	if err != nil {
+		return Person{}, false
+	}
+
+	persons, err := s.store.FindPersonsByName(normalized)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Person{}, false
+	}
+	switch len(persons) {
+	case 0:
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with name '%v' not found.", name)
+		return Person{}, false
+	case 1:
+		return persons[0], true
+	default:
+		writeAmbiguousName(w, name, persons)
+		return Person{}, false
+	}
+}
+
+// findPersonByID loads the person identified by the {id} URL parameter from
+// store, writing a 404 when it does not exist.
+func (s *Server) findPersonByID(w http.ResponseWriter, r *http.Request, store Store) (Person, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return Person{}, false
+	}
+
+	person, err := store.GetPerson(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Person with id '%v' not found.", id)
+		return Person{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Person{}, false
+	}
+	return person, true
+}
+
+func writeAmbiguousName(w http.ResponseWriter, name string, persons []Person) {
+	ids := make([]int, len(persons))
+	for i, person := range persons {
+		ids[i] = person.ID
+	}
+	problem := NewProblem(http.StatusConflict, CodeAmbiguousName, fmt.Sprintf("Name '%v' matches %d persons. Use /api/person/{id} with one of the candidate ids.", name, len(persons)))
+	problem.Candidates = ids
+	problem.Write(w)
+}
+
+// validatePerson checks the validate rules of person and that every course,
+// department and program it references exists, writing a 400 listing all
+// violations.
+func (s *Server) validatePerson(w http.ResponseWriter, person Person) bool {
+	errs := Validate(person)
+	missing, err := s.store.MissingCourseIDs(courseIDs(person.Courses))
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return false
+	}
+	for _, id := range missing {
+		errs = append(errs, FieldError{Field: "courses", Code: "exists", Message: fmt.Sprintf("Course with id '%v' does not exist.", id)})
+	}
+
+	if person.DepartmentID != nil {
+		_, err := s.store.GetDepartment(*person.DepartmentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs = append(errs, FieldError{Field: "department_id", Code: "exists", Message: fmt.Sprintf("Department with id '%v' does not exist.", *person.DepartmentID)})
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+	}
+	if person.MajorID != nil {
+		_, err := s.store.GetProgram(*person.MajorID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs = append(errs, FieldError{Field: "major_id", Code: "exists", Message: fmt.Sprintf("Program with id '%v' does not exist.", *person.MajorID)})
+		} else if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+	}
+	return writeValidationProblem(w, errs)
+}
+
+// affiliationErrors reports a department on a person who is not a professor
+// and a major on one who is not a student. Updates check it after the rules
+// that keep instructors and chairs professors, which take precedence.
+func affiliationErrors(person Person) []FieldError {
+	var errs []FieldError
+	if person.DepartmentID != nil && person.Type != "professor" {
+		errs = append(errs, FieldError{Field: "department_id", Code: "type", Message: "Only professors have a home department."})
+	}
+	if person.MajorID != nil && person.Type != "student" {
+		errs = append(errs, FieldError{Field: "major_id", Code: "type", Message: "Only students declare a major."})
+	}
+	return errs
+}
+
+func handlePersonWriteError(w http.ResponseWriter, person Person, err error) {
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		writeVersionConflict(w, fmt.Sprintf("person '%v'", person.ID))
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "JSON id '%v' conflicts with existing person data.", person.ID)
+	case errors.Is(err, gorm.ErrCheckConstraintViolated) && validPersonType(person.Type):
+		// The type is valid, so the person instructs an offering.
+		writeNotProfessor(w, person.ID)
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid type '%v'. Type must be either 'student' or 'professor'.", person.Type)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidReference, "JSON courses %v reference a course that does not exist.", courseIDs(person.Courses))
+	case errors.Is(err, ErrNoOffering):
+		WriteProblem(w, http.StatusConflict, CodeNoOffering, "JSON courses %v include a course that has no offering to enroll in.", courseIDs(person.Courses))
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
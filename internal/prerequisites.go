@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+/*
+Course prerequisites: /api/course/{id}/prerequisites, and their enforcement
+when students are enrolled.
+
+A student may enroll in a course once they have completed every course in
+its prerequisite closure, that is passed it as a student, as degree audits
+count it. Courses in progress, including those enrolled in by the same
+request, do not count. Only enrollments in the student role are checked,
+and admins skip the check with override_prerequisites=true.
+*/
+
+var errMissingPrerequisites = errors.New("student is missing prerequisites")
+
+// GetCoursePrerequisites lists every course a course requires, or only the
+// direct prerequisites with direct=true.
+func (s *Server) GetCoursePrerequisites(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+	direct := false
+	if val := r.URL.Query().Get("direct"); val != "" {
+		var err error
+		if direct, err = strconv.ParseBool(val); err != nil {
+			WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid direct '%v' on query parameter. Must be true or false.", val)
+			return
+		}
+	}
+
+	var courses []Course
+	var err error
+	if direct {
+		courses, err = s.store.ListPrerequisites(course.ID)
+	} else {
+		courses, err = s.store.ListPrerequisiteClosure(course.ID)
+	}
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if courses == nil {
+		courses = []Course{}
+	}
+	render.JSON(w, r, courses)
+}
+
+func (s *Server) AddCoursePrerequisite(w http.ResponseWriter, r *http.Request) {
+	var req PrerequisiteRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+	errs := Validate(req)
+	if req.CourseID != 0 {
+		missing, err := s.store.MissingCourseIDs([]int{req.CourseID})
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return
+		}
+		if len(missing) > 0 {
+			errs = append(errs, FieldError{Field: "course_id", Code: "exists", Message: fmt.Sprintf("Course with id '%v' does not exist.", req.CourseID)})
+		}
+	}
+	if !writeValidationProblem(w, errs) {
+		return
+	}
+
+	err := s.audited(r).AddPrerequisite(course.ID, req.CourseID)
+	if errors.Is(err, ErrPrerequisiteCycle) {
+		WriteProblem(w, http.StatusConflict, CodePrerequisiteCycle, "Course '%v' is required by course '%v', directly or not, so it cannot require it.", course.ID, req.CourseID)
+		return
+	} else if errors.Is(err, gorm.ErrDuplicatedKey) {
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Course '%v' already requires course '%v'.", course.ID, req.CourseID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, CoursePrerequisite{CourseID: course.ID, PrerequisiteID: req.CourseID})
+}
+
+func (s *Server) RemoveCoursePrerequisite(w http.ResponseWriter, r *http.Request) {
+	prerequisiteID, err := ParseIntParam(w, r, "prerequisiteId")
+	if err != nil {
+		return
+	}
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	err = s.audited(r).RemovePrerequisite(course.ID, prerequisiteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Course '%v' does not require course '%v'.", course.ID, prerequisiteID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Prerequisite removed."})
+}
+
+// prerequisitesEnforced reports whether the enrollments a request makes are
+// checked against prerequisites. It writes a problem and returns false as
+// its second value when override_prerequisites is invalid or the caller may
+// not use it.
+func (s *Server) prerequisitesEnforced(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	val := r.URL.Query().Get("override_prerequisites")
+	if val == "" {
+		return true, true
+	}
+	override, err := strconv.ParseBool(val)
+	if err != nil {
+		WriteProblem(w, http.StatusBadRequest, CodeInvalidParameter, "Invalid override_prerequisites '%v' on query parameter. Must be true or false.", val)
+		return false, false
+	}
+	if !override {
+		return true, true
+	}
+	if !s.requireAdmin(w, r) {
+		return false, false
+	}
+	return false, true
+}
+
+// checkPersonPrerequisites checks the prerequisites of enrolling each of the
+// persons personIDs in each of courseIDs with their default role, like
+// checkPrerequisites.
+func checkPersonPrerequisites(w http.ResponseWriter, tx Store, personIDs []int, courseIDs []int) bool {
+	persons := make([]Person, 0, len(personIDs))
+	for _, id := range uniqueIDs(personIDs) {
+		person, err := tx.GetPerson(id)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+		persons = append(persons, person)
+	}
+	return checkPrerequisites(w, tx, persons, courseIDs, "")
+}
+
+// checkPrerequisites writes a 422 listing what is missing and returns false
+// when a person among persons enrolling as a student has not completed the
+// prerequisites of the courses in ids it is not enrolled in yet. persons
+// carry their current courses and enroll with role, or with their default
+// role when it is empty.
+func checkPrerequisites(w http.ResponseWriter, tx Store, persons []Person, ids []int, role string) bool {
+	var missing []MissingPrerequisite
+	for _, person := range persons {
+		if cmp.Or(role, defaultRole(person.Type)) != RoleStudent {
+			continue
+		}
+		current := courseIDs(person.Courses)
+		taken, err := completedCourseIDs(tx, person.ID)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return false
+		}
+		for _, id := range uniqueIDs(ids) {
+			if slices.Contains(current, id) {
+				continue
+			}
+			closure, err := tx.ListPrerequisiteClosure(id)
+			if err != nil {
+				HandleDBErrorGeneric(w, err)
+				return false
+			}
+			var lacking []int
+			for _, course := range closure {
+				if !slices.Contains(taken, course.ID) {
+					lacking = append(lacking, course.ID)
+				}
+			}
+			if len(lacking) > 0 {
+				missing = append(missing, MissingPrerequisite{PersonID: person.ID, CourseID: id, PrerequisiteIDs: lacking})
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return true
+	}
+	problem := NewProblem(http.StatusUnprocessableEntity, CodeMissingPrerequisites, "The student has not taken every prerequisite of the course.")
+	if len(missing) > 1 {
+		problem.Detail = fmt.Sprintf("%d enrollments lack prerequisites.", len(missing))
+	}
+	problem.Missing = missing
+	problem.Write(w)
+	return false
+}
+
+// completedCourseIDs lists the courses a person passed as a student. A
+// person not created yet has completed none.
+func completedCourseIDs(tx Store, personID int) ([]int, error) {
+	if personID == 0 {
+		return nil, nil
+	}
+	enrollments, err := tx.ListEnrollments(EnrollmentFilter{PersonID: personID, Role: RoleStudent})
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range enrollments {
+		if courseProgress(e.Grade) == ProgressCompleted {
+			ids = append(ids, e.CourseID)
+		}
+	}
+	return ids, nil
+}
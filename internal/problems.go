@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+/*
+RFC 7807 problem details.
+
+Every error response is a Problem rendered as application/problem+json. Code
+is stable and meant for clients to switch on; Detail is for humans and may
+change wording at any time.
+*/
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemCode is the machine-readable identifier of a kind of problem.
+type ProblemCode string
+
+const (
+	CodeInvalidParameter     ProblemCode = "invalid_parameter"
+	CodeUnknownParameter     ProblemCode = "unknown_parameter"
+	CodeInvalidBody          ProblemCode = "invalid_body"
+	CodeInvalidPatch         ProblemCode = "invalid_patch"
+	CodePatchTestFailed      ProblemCode = "patch_test_failed"
+	CodeUnsupportedMediaType ProblemCode = "unsupported_media_type"
+	CodeValidationFailed     ProblemCode = "validation_failed"
+	CodeNotFound             ProblemCode = "not_found"
+	CodeMethodNotAllowed     ProblemCode = "method_not_allowed"
+	CodeNotAcceptable        ProblemCode = "not_acceptable"
+	CodeConflict             ProblemCode = "conflict"
+	CodePreconditionFailed   ProblemCode = "precondition_failed"
+	CodeAmbiguousName        ProblemCode = "ambiguous_name"
+	CodeAlreadyEnrolled      ProblemCode = "already_enrolled"
+	CodeNotEnrolled          ProblemCode = "not_enrolled"
+	CodeAlreadyWaitlisted    ProblemCode = "already_waitlisted"
+	CodeMissingPrerequisites ProblemCode = "missing_prerequisites"
+	CodePrerequisiteCycle    ProblemCode = "prerequisite_cycle"
+	CodeNotProfessor         ProblemCode = "not_professor"
+	CodeNotStudent           ProblemCode = "not_student"
+	CodeScheduleConflict     ProblemCode = "schedule_conflict"
+	CodeRoomConflict         ProblemCode = "room_conflict"
+	CodeInvalidReference     ProblemCode = "invalid_reference"
+	CodeNotDeleted           ProblemCode = "not_deleted"
+	CodeNoOffering           ProblemCode = "no_offering"
+	CodeUnauthorized         ProblemCode = "unauthorized"
+	CodeForbidden            ProblemCode = "forbidden"
+	CodeInternal             ProblemCode = "internal_error"
+)
+
+var problemTitles = map[ProblemCode]string{
+	CodeInvalidParameter:     "Invalid parameter",
+	CodeUnknownParameter:     "Unknown query parameter",
+	CodeInvalidBody:          "Invalid request body",
+	CodeInvalidPatch:         "Invalid patch",
+	CodePatchTestFailed:      "Patch test failed",
+	CodeUnsupportedMediaType: "Unsupported media type",
+	CodeValidationFailed:     "Validation failed",
+	CodeNotFound:             "Resource not found",
+	CodeMethodNotAllowed:     "Method not allowed",
+	CodeNotAcceptable:        "Not acceptable",
+	CodeConflict:             "Conflict with existing data",
+	CodePreconditionFailed:   "Precondition failed",
+	CodeAmbiguousName:        "Ambiguous name",
+	CodeAlreadyEnrolled:      "Already enrolled",
+	CodeNotEnrolled:          "Not enrolled",
+	CodeAlreadyWaitlisted:    "Already waitlisted",
+	CodeMissingPrerequisites: "Missing prerequisites",
+	CodePrerequisiteCycle:    "Prerequisite cycle",
+	CodeNotProfessor:         "Instructor is not a professor",
+	CodeNotStudent:           "Advisee is not a student",
+	CodeScheduleConflict:     "Schedule conflict",
+	CodeRoomConflict:         "Room already booked",
+	CodeInvalidReference:     "Invalid reference",
+	CodeNotDeleted:           "Not deleted",
+	CodeNoOffering:           "No offering",
+	CodeUnauthorized:         "Authentication required",
+	CodeForbidden:            "Forbidden",
+	CodeInternal:             "Internal server error",
+}
+
+// Problem is an RFC 7807 problem details object. Errors lists per-field
+// failures of a validation problem, Candidates the ids an ambiguous name
+// matches, Missing the prerequisites an enrollment lacks, Conflict the
+// meeting a schedule or room conflict is with and Rows the failed rows of an
+// import.
+type Problem struct {
+	Type       string                `json:"type"`
+	Title      string                `json:"title"`
+	Status     int                   `json:"status"`
+	Detail     string                `json:"detail,omitempty"`
+	Code       ProblemCode           `json:"code"`
+	Errors     []FieldError          `json:"errors,omitempty"`
+	Candidates []int                 `json:"candidates,omitempty"`
+	Missing    []MissingPrerequisite `json:"missing,omitempty"`
+	Conflict   *MeetingConflict      `json:"conflict,omitempty"`
+	Rows       []ImportError         `json:"rows,omitempty"`
+}
+
+// FieldError describes why one field of a request was rejected. Field is the
+// JSON name of a body field or the name of a query parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// MissingPrerequisite lists the prerequisites of a course that a student
+// being enrolled in it has not taken.
+type MissingPrerequisite struct {
+	PersonID        int   `json:"person_id,omitempty"`
+	CourseID        int   `json:"course_id"`
+	PrerequisiteIDs []int `json:"prerequisite_ids"`
+}
+
+// MeetingConflict names the course, offering and meeting that a new meeting
+// or enrollment overlaps.
+type MeetingConflict struct {
+	CourseID   int     `json:"course_id"`
+	CourseName string  `json:"course_name"`
+	OfferingID int     `json:"offering_id"`
+	Meeting    Meeting `json:"meeting"`
+}
+
+// NewProblem returns the Problem of the given status and code. The type URI
+// is derived from the code.
+func NewProblem(status int, code ProblemCode, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + string(code),
+		Title:  problemTitles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%v: %v", p.Code, p.Detail)
+}
+
+// Write renders the problem as the response.
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		Out("ERROR", err)
+	}
+}
+
+// WriteProblem renders a Problem whose detail is formatted from format and
+// args.
+func WriteProblem(w http.ResponseWriter, status int, code ProblemCode, format string, args ...any) {
+	NewProblem(status, code, fmt.Sprintf(format, args...)).Write(w)
+}
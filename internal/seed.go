@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Seed data for development and tests. Persons list their courses by name.
+// Courses are offered in the seed term, numbered in the seed department and
+// worth seedCreditHours each. Its professors belong to the department, the
+// first one chairs it, and its students major in the seed program.
+var (
+	seedTerm       = Term{Name: "Fall 2024", StartDate: NewDate(2024, time.August, 26), EndDate: NewDate(2024, time.December, 13)}
+	seedDepartment = Department{Code: "CS", Name: "Computer Science"}
+	seedProgram    = Program{Code: "CS-BS", Name: "Computer Science", Degree: "BS"}
+	seedCourses    = []Course{
+		{Name: "Programming", Number: "101"},
+		{Name: "Databases", Number: "220"},
+		{Name: "UI Design", Number: "230"},
+	}
+	seedCreditHours = 3
+	seedPersons     = []Person{
+		{FirstName: "Steve", LastName: "Jobs", Type: "professor", Age: seedAge(56), Courses: seedCourseRefs("Programming", "Databases", "UI Design")},
+		{FirstName: "Jeff", LastName: "Bezos", Type: "professor", Age: seedAge(60), Courses: seedCourseRefs("Programming", "Databases", "UI Design")},
+		{FirstName: "Larry", LastName: "Page", Type: "student", Age: seedAge(51), Courses: seedCourseRefs("Programming", "Databases", "UI Design")},
+		{FirstName: "Bill", LastName: "Gates", Type: "student", Age: seedAge(67), Courses: seedCourseRefs("Programming", "Databases", "UI Design")},
+		{FirstName: "Elon", LastName: "Musk", Type: "student", Age: seedAge(52), Courses: seedCourseRefs("Programming", "Databases", "UI Design")},
+	}
+)
+
+func seedAge(age int) *int {
+	return &age
+}
+
+func seedCourseRefs(names ...string) []Course {
+	courses := make([]Course, len(names))
+	for i, name := range names {
+		courses[i] = Course{Name: name}
+	}
+	return courses
+}
+
+// Seed inserts the seed term, department, program, courses and persons in one
+// transaction. It is idempotent: terms and courses are matched by name,
+// departments and programs by code and persons by full name, and rows that
+// already exist are left untouched.
+func Seed(store Store) error {
+	return store.Transaction(func(tx Store) error {
+		terms, _, err := tx.ListTerms(Page{})
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(terms, func(t Term) bool { return t.Name == seedTerm.Name }) {
+			term := seedTerm
+			if err := tx.CreateTerm(&term); err != nil {
+				return err
+			}
+		}
+
+		departments, _, err := tx.ListDepartments(Page{})
+		if err != nil {
+			return err
+		}
+		department := seedDepartment
+		if i := slices.IndexFunc(departments, func(d Department) bool { return d.Code == seedDepartment.Code }); i >= 0 {
+			department = departments[i]
+		} else if err := tx.CreateDepartment(&department); err != nil {
+			return err
+		}
+
+		programs, _, err := tx.ListPrograms(ProgramFilter{}, Page{})
+		if err != nil {
+			return err
+		}
+		program := seedProgram
+		if i := slices.IndexFunc(programs, func(p Program) bool { return p.Code == seedProgram.Code }); i >= 0 {
+			program = programs[i]
+		} else {
+			program.DepartmentID = department.ID
+			if err := tx.CreateProgram(&program); err != nil {
+				return err
+			}
+		}
+
+		courses, _, err := tx.ListCourses(CourseFilter{}, Page{})
+		if err != nil {
+			return err
+		}
+		courseIDs := map[string]int{}
+		for _, course := range courses {
+			courseIDs[course.Name] = course.ID
+		}
+		for _, seed := range seedCourses {
+			if _, ok := courseIDs[seed.Name]; ok {
+				continue
+			}
+			course := seed
+			course.DepartmentID, course.CreditHours = &department.ID, seedCreditHours
+			if err := tx.CreateCourse(&course); err != nil {
+				return err
+			}
+			courseIDs[seed.Name] = course.ID
+		}
+
+		for _, seed := range seedPersons {
+			existing, err := tx.FindPersonsByName(strings.ToLower(seed.FirstName + " " + seed.LastName))
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				continue
+			}
+			person := seed
+			person.Courses = make([]Course, len(seed.Courses))
+			for i, course := range seed.Courses {
+				person.Courses[i] = Course{ID: courseIDs[course.Name]}
+			}
+			if person.Type == "professor" {
+				person.DepartmentID = &department.ID
+			} else {
+				person.MajorID = &program.ID
+			}
+			if err := tx.CreatePerson(&person); err != nil {
+				return err
+			}
+			if department.ChairID == nil && person.Type == "professor" {
+				department.ChairID = &person.ID
+				if err := tx.UpdateDepartment(&department); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NewSeededMemoryStore returns a MemoryStore holding the seed data.
+func NewSeededMemoryStore() (*MemoryStore, error) {
+	store := NewMemoryStore()
+	return store, Seed(store)
+}
@@ -9,32 +9,129 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-var err error
+// Deps are the dependencies injected into the HTTP handlers.
+type Deps struct {
+	Store Store
+	// AdminToken is the bearer token of admin requests. Admin features are
+	// disabled when it is empty.
+	AdminToken string
+}
+
+// Server carries the handler dependencies. Every handler is a method on it,
+// so handlers share no mutable package state and can run concurrently.
+type Server struct {
+	store      Store
+	adminToken string
+}
 
-func RunServer() {
-	r := InitServer()
+func RunServer(deps Deps) {
+	r := InitServer(deps)
 	runServer(r)
 }
 
-func InitServer() *chi.Mux {
+func InitServer(deps Deps) *chi.Mux {
+	s := &Server{store: deps.Store, adminToken: deps.AdminToken}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(withActor)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "No route matches '%v'.", r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method %v is not allowed on '%v'.", r.Method, r.URL.Path)
+	})
 
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/course", func(r chi.Router) {
-			r.Get("/", GetCourses)
-			r.Get("/{id}", GetCourse)
-			r.Post("/", CreateCourse)
-			r.Put("/{id}", UpdateCourse)
-			r.Delete("/{id}", DeleteCourse)
+			r.Get("/", s.GetCourses)
+			r.Get("/{id}", s.GetCourse)
+			r.Post("/", s.CreateCourse)
+			r.Put("/{id}", s.UpdateCourse)
+			r.Patch("/{id}", s.PatchCourse)
+			r.Delete("/{id}", s.DeleteCourse)
+			r.Post("/{id}/restore", s.RestoreCourse)
+			r.Get("/{id}/persons", s.GetCoursePersons)
+			r.Post("/{id}/persons", s.EnrollCoursePerson)
+			r.Put("/{id}/persons", s.ReplaceCoursePersons)
+			r.Delete("/{id}/persons/{personId}", s.DropCoursePerson)
+			r.Get("/{id}/enrollments", s.GetCourseEnrollments)
+			r.Get("/{id}/waitlist", s.GetCourseWaitlist)
+			r.Get("/{id}/prerequisites", s.GetCoursePrerequisites)
+			r.Post("/{id}/prerequisites", s.AddCoursePrerequisite)
+			r.Delete("/{id}/prerequisites/{prerequisiteId}", s.RemoveCoursePrerequisite)
+		})
+		r.Get("/audit", s.GetAudit)
+		r.Post("/import", s.ImportCSV)
+		r.Route("/term", func(r chi.Router) {
+			r.Get("/", s.GetTerms)
+			r.Get("/{id}", s.GetTerm)
+			r.Post("/", s.CreateTerm)
+			r.Put("/{id}", s.UpdateTerm)
+			r.Delete("/{id}", s.DeleteTerm)
+			r.Get("/{id}/holidays", s.GetTermHolidays)
+			r.Put("/{id}/holidays", s.ReplaceTermHolidays)
+		})
+		r.Route("/department", func(r chi.Router) {
+			r.Get("/", s.GetDepartments)
+			r.Get("/{id}", s.GetDepartment)
+			r.Post("/", s.CreateDepartment)
+			r.Put("/{id}", s.UpdateDepartment)
+			r.Delete("/{id}", s.DeleteDepartment)
+		})
+		r.Route("/program", func(r chi.Router) {
+			r.Get("/", s.GetPrograms)
+			r.Get("/{id}", s.GetProgram)
+			r.Post("/", s.CreateProgram)
+			r.Put("/{id}", s.UpdateProgram)
+			r.Delete("/{id}", s.DeleteProgram)
+			r.Get("/{id}/requirements", s.GetProgramRequirements)
+			r.Put("/{id}/requirements", s.ReplaceProgramRequirements)
+		})
+		r.Route("/offering", func(r chi.Router) {
+			r.Get("/", s.GetOfferings)
+			r.Get("/{id}", s.GetOffering)
+			r.Post("/", s.CreateOffering)
+			r.Put("/{id}", s.UpdateOffering)
+			r.Delete("/{id}", s.DeleteOffering)
+			r.Get("/{id}/persons", s.GetOfferingPersons)
+			r.Post("/{id}/persons", s.EnrollOfferingPerson)
+			r.Delete("/{id}/persons/{personId}", s.DropOfferingPerson)
+			r.Put("/{id}/persons/{personId}/grade", s.SetGrade)
+			r.Get("/{id}/waitlist", s.GetOfferingWaitlist)
+			r.Get("/{id}/meetings", s.GetOfferingMeetings)
+			r.Put("/{id}/meetings", s.ReplaceOfferingMeetings)
 		})
 		r.Route("/person", func(r chi.Router) {
-			r.Get("/", GetPersons)
-			r.Get("/{name}", GetPerson)
-			r.Post("/", CreatePerson)
-			r.Put("/{name}", UpdatePerson)
-			r.Delete("/{name}", DeletePerson)
+			r.Get("/", s.GetPersons)
+			r.Get("/resolve", s.ResolvePersonName)
+			r.Get("/{id:[0-9]+}", s.GetPersonByID)
+			r.Get("/{name}", s.GetPerson)
+			r.Post("/", s.CreatePerson)
+			r.Put("/{id:[0-9]+}", s.UpdatePersonByID)
+			r.Put("/{name}", s.UpdatePerson)
+			r.Patch("/{id:[0-9]+}", s.PatchPersonByID)
+			r.Patch("/{name}", s.PatchPerson)
+			r.Delete("/{id:[0-9]+}", s.DeletePersonByID)
+			r.Delete("/{name}", s.DeletePerson)
+			r.Post("/{id:[0-9]+}/restore", s.RestorePerson)
+			r.Get("/{id:[0-9]+}/courses", s.GetPersonCourses)
+			r.Post("/{id:[0-9]+}/courses", s.EnrollPersonCourse)
+			r.Put("/{id:[0-9]+}/courses", s.ReplacePersonCourses)
+			r.Delete("/{id:[0-9]+}/courses/{courseId}", s.DropPersonCourse)
+			r.Get("/{id:[0-9]+}/offerings", s.GetPersonOfferings)
+			r.Get("/{id:[0-9]+}/enrollments", s.GetPersonEnrollments)
+			r.Get("/{id:[0-9]+}/waitlist", s.GetPersonWaitlist)
+			r.Get("/{id:[0-9]+}/transcript", s.GetPersonTranscript)
+			r.Get("/{id:[0-9]+}/degree-audit", s.GetPersonDegreeAudit)
+			r.Put("/{id:[0-9]+}/advisor", s.AssignAdvisor)
+			r.Delete("/{id:[0-9]+}/advisor", s.EndAdvisor)
+			r.Get("/{id:[0-9]+}/advisors", s.GetPersonAdvisors)
+			r.Get("/{id:[0-9]+}/advisees", s.GetPersonAdvisees)
+			r.Get("/{id:[0-9]+}/schedule", s.GetPersonSchedule)
+			r.Get("/{id:[0-9]+}/schedule.ics", s.GetPersonCalendar)
+			r.Post("/{id:[0-9]+}/calendar-token", s.IssueCalendarToken)
+			r.Post("/{id:[0-9]+}/access-token", s.IssueAccessToken)
 		})
 	})
 
@@ -45,7 +142,7 @@ func runServer(r *chi.Mux) {
 	HTTP_PORT := os.Getenv("HTTP_PORT")
 
 	Outf("Starting server on port %v", HTTP_PORT)
-	err = http.ListenAndServe(HTTP_PORT, r)
+	err := http.ListenAndServe(HTTP_PORT, r)
 	if err != nil {
 		log.Fatal("Error running server")
 	}
@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+Persistence interfaces used by the HTTP handlers.
+
+Implementations report missing rows with gorm.ErrRecordNotFound and constraint
+failures with the translated gorm errors (gorm.ErrDuplicatedKey,
+gorm.ErrCheckConstraintViolated, gorm.ErrForeignKeyViolated), whatever the
+backend, so handlers can map them to status codes in one way.
+
+Writes to persons and courses take the version the caller last read. Zero
+writes unconditionally; any other value must match the stored version or the
+write fails with ErrVersionConflict.
+
+Persons enroll in course offerings. The course-level enrollment operations
+act on the default offering of each course, its first one, and fail with
+ErrNoOffering when the course has none.
+
+A course with a capacity admits that many students into each of its
+offerings. Enrollments beyond it put the student on the offering's waitlist
+instead, and every change that frees a seat promotes the first waitlisted
+students into it, in the same transaction. Only enrollments in the student
+role are counted or waitlisted, and soft-deleted students neither hold seats
+nor are promoted into them. Neither are students whose schedule the offering
+would overlap; their entries are held with the reason instead.
+
+Persons enroll as instructors, teaching assistants or students. An
+enrollment without a role takes the one of the person's type, instructor for
+professors and student for students, and only professors can be
+instructors: breaking that fails with gorm.ErrCheckConstraintViolated, as
+does changing the type of a person who instructs.
+
+Professors belong to a home department and students declare a major
+program. Setting either on a person of the other type, or changing the type
+of a person who has one or chairs a department, fails with
+gorm.ErrCheckConstraintViolated. Courses numbered within a department must
+have distinct numbers there.
+
+Professors advise students. Assignments are kept as a history, and changing
+the type of a person in a current assignment fails with
+gorm.ErrCheckConstraintViolated too.
+
+Enrollments in the student role are graded. A grade replaces the previous
+one, if any, and does not change the version of the person.
+
+Mutations made through an Audited store also append AuditEntry rows, in the
+same transaction as the change.
+
+Persons and courses are soft-deleted: they keep their row and their
+person_course links but are hidden from every read, and from the courses of
+persons, unless the store is a WithDeleted view.
+*/
+
+var (
+	// ErrVersionConflict is returned by a write whose expected version is
+	// stale.
+	ErrVersionConflict = errors.New("row was modified concurrently")
+	// ErrNoOffering is returned by a course-level enrollment in a course that
+	// has no offering.
+	ErrNoOffering = errors.New("course has no offering")
+	// ErrAlreadyWaitlisted is returned by an enrollment of a person who is
+	// already on the waitlist of the offering.
+	ErrAlreadyWaitlisted = errors.New("person is already waitlisted")
+	// ErrPrerequisiteCycle is returned when a new prerequisite would make a
+	// course require itself.
+	ErrPrerequisiteCycle = errors.New("prerequisite would create a cycle")
+)
+
+// Store groups every repository the handlers depend on.
+type Store interface {
+	CourseStore
+	PrerequisiteStore
+	PersonStore
+	TermStore
+	DepartmentStore
+	ProgramStore
+	AdvisorStore
+	OfferingStore
+	MeetingStore
+	CalendarStore
+	AccessTokenStore
+	EnrollmentStore
+	AuditStore
+
+	// Transaction runs fn with a Store whose writes are committed together
+	// when fn returns nil and rolled back when it returns an error.
+	Transaction(fn func(tx Store) error) error
+	// WithDeleted returns a view of the store whose reads include
+	// soft-deleted persons and courses. It is meant for reads only.
+	WithDeleted() Store
+}
+
+// CourseFilter narrows ListCourses. Zero values are ignored.
+type CourseFilter struct {
+	// Department is the code of the department of the courses.
+	Department string
+}
+
+// CourseStore manages courses. Reads fill the code of each course from its
+// department and number.
+type CourseStore interface {
+	// ListCourses returns one page of the courses matching filter and the
+	// total number of matching courses.
+	ListCourses(filter CourseFilter, page Page) ([]Course, int64, error)
+	GetCourse(id int) (Course, error)
+	// CreateCourse inserts the course together with its default offering,
+	// section DefaultSection in the term that starts last, if there is a term.
+	CreateCourse(course *Course) error
+	// UpdateCourse writes every field of course, zero values included, if
+	// course.Version is current, and fills seats a raised capacity frees.
+	// course is reloaded afterwards.
+	UpdateCourse(course *Course) error
+	// DeleteCourse soft-deletes the course, keeping its person_course rows.
+	DeleteCourse(id int, version int) error
+	// RestoreCourse undeletes a soft-deleted course. It returns
+	// gorm.ErrRecordNotFound when no deleted course has the id.
+	RestoreCourse(id int) error
+	// MissingCourseIDs returns the ids that do not belong to any course.
+	MissingCourseIDs(ids []int) ([]int, error)
+}
+
+// PrerequisiteStore manages the prerequisite graph between courses. Reads
+// hide soft-deleted courses, but paths through them still count.
+type PrerequisiteStore interface {
+	// ListPrerequisites returns the courses a course requires directly,
+	// ordered by id.
+	ListPrerequisites(courseID int) ([]Course, error)
+	// ListPrerequisiteClosure returns every course a course requires,
+	// directly or through other prerequisites, ordered by id.
+	ListPrerequisiteClosure(courseID int) ([]Course, error)
+	// AddPrerequisite returns ErrPrerequisiteCycle when the prerequisite is
+	// the course or requires it, and gorm.ErrDuplicatedKey when the course
+	// already requires it directly.
+	AddPrerequisite(courseID int, prerequisiteID int) error
+	// RemovePrerequisite returns gorm.ErrRecordNotFound when the course does
+	// not require the prerequisite directly.
+	RemovePrerequisite(courseID int, prerequisiteID int) error
+}
+
+type PersonStore interface {
+	// ListPersons returns one page of the persons matching filter, with their
+	// courses, and the total number of matching persons.
+	ListPersons(filter PersonFilter, page Page) ([]Person, int64, error)
+	GetPerson(id int) (Person, error)
+	// FindPersonsByName returns every person whose "first_name last_name"
+	// equals name, ignoring case. name must already be normalized by ParseName.
+	FindPersonsByName(name string) ([]Person, error)
+	// CreatePerson inserts the person and enrolls it in person.Courses.
+	CreatePerson(person *Person) error
+	// UpdatePerson writes every field of person, zero values included, if
+	// person.Version is current, and replaces its courses with person.Courses
+	// unless that is nil. person is reloaded afterwards.
+	UpdatePerson(person *Person) error
+	// DeletePerson soft-deletes the person, keeping its person_course rows,
+	// and gives its seats to the waitlists.
+	DeletePerson(id int, version int) error
+	// RestorePerson undeletes a soft-deleted person, and with it its
+	// enrollments. Enrollments in offerings that filled up meanwhile go to
+	// the end of their waitlists. It returns gorm.ErrRecordNotFound when no
+	// deleted person has the id.
+	RestorePerson(id int) error
+	// MissingPersonIDs returns the ids that do not belong to any person.
+	MissingPersonIDs(ids []int) ([]int, error)
+}
+
+type TermStore interface {
+	// ListTerms returns one page of terms and the total number of terms.
+	ListTerms(page Page) ([]Term, int64, error)
+	GetTerm(id int) (Term, error)
+	CreateTerm(term *Term) error
+	UpdateTerm(term *Term) error
+	// DeleteTerm returns gorm.ErrForeignKeyViolated while the term has
+	// offerings. Its holidays are deleted with it.
+	DeleteTerm(id int) error
+
+	// ListHolidays returns the holidays of a term, ordered by date.
+	ListHolidays(termID int) ([]Holiday, error)
+	// SetTermHolidays replaces the holidays of a term, setting their term.
+	SetTermHolidays(termID int, holidays []Holiday) error
+}
+
+// DepartmentStore manages departments. Chairs must be professors: naming
+// another person fails with gorm.ErrForeignKeyViolated, like a missing one.
+type DepartmentStore interface {
+	// ListDepartments returns one page of departments and the total number of
+	// departments.
+	ListDepartments(page Page) ([]Department, int64, error)
+	GetDepartment(id int) (Department, error)
+	// CreateDepartment returns gorm.ErrDuplicatedKey when the code is taken.
+	CreateDepartment(department *Department) error
+	UpdateDepartment(department *Department) error
+	// DeleteDepartment returns gorm.ErrForeignKeyViolated while programs,
+	// courses or professors belong to the department.
+	DeleteDepartment(id int) error
+}
+
+// ProgramFilter narrows ListPrograms. Zero values are ignored.
+type ProgramFilter struct {
+	DepartmentID int
+}
+
+// ProgramStore manages the degree programs students declare as majors.
+type ProgramStore interface {
+	// ListPrograms returns one page of the programs matching filter and the
+	// total number of matching programs.
+	ListPrograms(filter ProgramFilter, page Page) ([]Program, int64, error)
+	GetProgram(id int) (Program, error)
+	// CreateProgram returns gorm.ErrDuplicatedKey when the code is taken.
+	CreateProgram(program *Program) error
+	UpdateProgram(program *Program) error
+	// DeleteProgram returns gorm.ErrForeignKeyViolated while students have
+	// declared the program as their major. Its requirements are deleted with
+	// it.
+	DeleteProgram(id int) error
+
+	// ListRequirements returns the requirements of a program in the order
+	// they were set, each with its courses ordered by id.
+	ListRequirements(programID int) ([]Requirement, error)
+	// SetProgramRequirements replaces the requirements of a program, setting
+	// their ids. It returns gorm.ErrForeignKeyViolated when a requirement
+	// lists a course that does not exist.
+	SetProgramRequirements(programID int, requirements []Requirement) error
+}
+
+// AdvisorFilter narrows ListAdvisorAssignments. Zero values are ignored.
+type AdvisorFilter struct {
+	StudentID int
+	AdvisorID int
+	// Current keeps the assignments that have not ended.
+	Current bool
+}
+
+// AdvisorStore keeps the history of the professors advising each student.
+// Advisors must be professors and advisees students: naming another person
+// fails with gorm.ErrForeignKeyViolated, like a missing one.
+type AdvisorStore interface {
+	// ListAdvisorAssignments returns the assignments matching filter in the
+	// order they were made.
+	ListAdvisorAssignments(filter AdvisorFilter) ([]AdvisorAssignment, error)
+	// AssignAdvisor ends the current assignment of assignment.StudentID, if
+	// any, and starts assignment, setting its id and start time. When the
+	// current advisor is already assignment.AdvisorID, it keeps that
+	// assignment and fills assignment with it instead.
+	AssignAdvisor(assignment *AdvisorAssignment) error
+	// EndAdvisorAssignment ends the current assignment of a student. It
+	// returns gorm.ErrRecordNotFound when the student has none.
+	EndAdvisorAssignment(studentID int) error
+}
+
+// OfferingFilter narrows ListOfferings. Zero values are ignored.
+type OfferingFilter struct {
+	CourseID int
+	TermID   int
+}
+
+// OfferingStore manages course offerings. Offerings of soft-deleted courses
+// are hidden like their course.
+type OfferingStore interface {
+	// ListOfferings returns one page of the offerings matching filter and the
+	// total number of matching offerings.
+	ListOfferings(filter OfferingFilter, page Page) ([]CourseOffering, int64, error)
+	GetOffering(id int) (CourseOffering, error)
+	// CreateOffering returns gorm.ErrDuplicatedKey when the course already
+	// has the section in the term.
+	CreateOffering(offering *CourseOffering) error
+	// UpdateOffering returns gorm.ErrForeignKeyViolated when it moves an
+	// offering with enrollments or a waitlist to another course.
+	UpdateOffering(offering *CourseOffering) error
+	// DeleteOffering returns gorm.ErrForeignKeyViolated while the offering
+	// has enrollments or a waitlist. Its meetings are deleted with it.
+	DeleteOffering(id int) error
+}
+
+// MeetingStore holds the weekly meetings of offerings. It does not check for
+// overlaps; handlers do, so they can name the conflicting course.
+type MeetingStore interface {
+	// ListMeetings returns the meetings matching filter, ordered by offering,
+	// day and start time. Those of offerings of soft-deleted courses are
+	// hidden like them.
+	ListMeetings(filter MeetingFilter) ([]Meeting, error)
+	// SetOfferingMeetings replaces the meetings of an offering, setting the
+	// ids and offering of meetings.
+	SetOfferingMeetings(offeringID int, meetings []Meeting) error
+	// LockRooms holds rooms of a term until the transaction ends, so that
+	// checks of their bookings stay valid until meetings are written.
+	LockRooms(termID int, rooms []string) error
+}
+
+// CalendarStore holds the calendar tokens of persons.
+type CalendarStore interface {
+	// GetCalendarToken returns gorm.ErrRecordNotFound when the person has no
+	// token.
+	GetCalendarToken(personID int) (CalendarToken, error)
+	// SetCalendarToken replaces the token of token.PersonID, setting its
+	// creation time.
+	SetCalendarToken(token *CalendarToken) error
+}
+
+// AccessTokenStore holds the access tokens of persons.
+type AccessTokenStore interface {
+	// GetAccessToken returns gorm.ErrRecordNotFound when the person has no
+	// token.
+	GetAccessToken(personID int) (AccessToken, error)
+	// FindAccessToken returns the token with tokenHash, or
+	// gorm.ErrRecordNotFound when there is none.
+	FindAccessToken(tokenHash string) (AccessToken, error)
+	// SetAccessToken replaces the token of token.PersonID, setting its
+	// creation time.
+	SetAccessToken(token *AccessToken) error
+}
+
+// MeetingFilter narrows ListMeetings. Zero values are ignored, but a non-nil
+// empty OfferingIDs matches nothing.
+type MeetingFilter struct {
+	OfferingIDs []int
+	TermID      int
+	Room        string
+}
+
+// EnrollmentFilter narrows ListEnrollments. Zero values are ignored.
+type EnrollmentFilter struct {
+	PersonID   int
+	CourseID   int
+	OfferingID int
+	Role       string
+}
+
+// GradeChange grades one enrollment. Reason explains the change and is only
+// kept by the audit log.
+type GradeChange struct {
+	PersonID   int
+	OfferingID int
+	Grade      string
+	Reason     string
+}
+
+// EnrollmentStore changes enrollments. Every change increments the version of
+// the persons whose courses it changes.
+//
+// Enrollments of one person return the person's waitlist entry when the
+// offering is full, and nil when they enrolled, filling in the enrollment.
+// Drops remove the person from the offering or, failing that, from its
+// waitlist. Replacements keep the enrollments they leave in place, with their
+// role and time, waitlist the students that do not fit, and keep the
+// waitlisted ones waiting.
+type EnrollmentStore interface {
+	// ListCoursePersons returns the persons enrolled in any offering of a
+	// course, optionally restricted to one person type.
+	ListCoursePersons(courseID int, personType string) ([]Person, error)
+	// ListEnrollments returns the enrollments matching filter, ordered by
+	// offering and person. Those of soft-deleted persons and courses are
+	// hidden like them.
+	ListEnrollments(filter EnrollmentFilter) ([]PersonCourse, error)
+	// Enroll enrolls e.PersonID in the default offering of e.CourseID.
+	Enroll(e *PersonCourse) (*WaitlistEntry, error)
+	// Drop returns gorm.ErrRecordNotFound when the person is neither enrolled
+	// in nor waitlisted for the default offering.
+	Drop(courseID int, personID int) error
+	SetCoursePersons(courseID int, personIDs []int) error
+	SetPersonCourses(personID int, courseIDs []int) error
+
+	ListOfferingPersons(offeringID int) ([]Person, error)
+	// ListPersonOfferings returns the offerings a person is enrolled in.
+	ListPersonOfferings(personID int) ([]CourseOffering, error)
+	// EnrollOffering enrolls e.PersonID in the offering e.OfferingID.
+	EnrollOffering(e *PersonCourse) (*WaitlistEntry, error)
+	// DropOffering returns gorm.ErrRecordNotFound when the person is neither
+	// enrolled in nor waitlisted for the offering.
+	DropOffering(offeringID int, personID int) error
+
+	// ListWaitlist returns the waitlist of an offering, first in line first.
+	ListWaitlist(offeringID int) ([]WaitlistEntry, error)
+	// ListPersonWaitlist returns the waitlist entries of a person, ordered by
+	// offering.
+	ListPersonWaitlist(personID int) ([]WaitlistEntry, error)
+
+	// SetGrade grades the enrollment of change.PersonID in the offering
+	// change.OfferingID and returns it. It returns gorm.ErrRecordNotFound when
+	// the person is not enrolled and gorm.ErrCheckConstraintViolated when the
+	// enrollment is not in the student role.
+	SetGrade(change GradeChange) (PersonCourse, error)
+}
+
+// AuditFilter narrows ListAudit. Zero values are ignored and every set field
+// must match.
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Actor    string
+	// Since keeps the entries that occurred at or after it.
+	Since time.Time
+}
+
+type AuditStore interface {
+	// AppendAudit inserts the entry, setting its id and time.
+	AppendAudit(entry *AuditEntry) error
+	// ListAudit returns one page of the entries matching filter, ordered by
+	// id, and the total number of matching entries.
+	ListAudit(filter AuditFilter, page Page) ([]AuditEntry, int64, error)
+}
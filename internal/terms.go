@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var TermSortColumns = []string{"id", "name", "start_date"}
+
+func (s *Server) GetTerms(w http.ResponseWriter, r *http.Request) {
+	page, ok := ParsePage(w, r, TermSortColumns)
+	if !ok {
+		return
+	}
+
+	terms, total, err := s.store.ListTerms(page.fetch())
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	terms = writePage(w, r, page, terms, total)
+	if terms == nil {
+		terms = []Term{}
+	}
+	render.JSON(w, r, terms)
+}
+
+func (s *Server) GetTerm(w http.ResponseWriter, r *http.Request) {
+	term, ok := s.findTerm(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, term)
+}
+
+func (s *Server) CreateTerm(w http.ResponseWriter, r *http.Request) {
+	var newTerm Term
+	if err := CheckJSON(w, r, &newTerm); err != nil {
+		return
+	}
+	if !writeValidationProblem(w, validateTerm(newTerm)) {
+		return
+	}
+
+	if err := s.audited(r).CreateTerm(&newTerm); err != nil {
+		handleTermWriteError(w, newTerm, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]int{"id": newTerm.ID})
+}
+
+func (s *Server) UpdateTerm(w http.ResponseWriter, r *http.Request) {
+	var newTerm Term
+	if err := CheckJSON(w, r, &newTerm); err != nil {
+		return
+	}
+	if !writeValidationProblem(w, validateTerm(newTerm)) {
+		return
+	}
+	term, ok := s.findTerm(w, r)
+	if !ok {
+		return
+	}
+
+	newTerm.ID = term.ID
+	if err := s.audited(r).UpdateTerm(&newTerm); err != nil {
+		handleTermWriteError(w, newTerm, err)
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, newTerm)
+}
+
+func (s *Server) DeleteTerm(w http.ResponseWriter, r *http.Request) {
+	term, ok := s.findTerm(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.audited(r).DeleteTerm(term.ID)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		WriteProblem(w, http.StatusConflict, CodeConflict, "Term with id '%v' still has course offerings.", term.ID)
+		return
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	render.JSON(w, r, map[string]string{"message": "Deletion Successful."})
+}
+
+func (s *Server) GetTermHolidays(w http.ResponseWriter, r *http.Request) {
+	term, ok := s.findTerm(w, r)
+	if !ok {
+		return
+	}
+
+	holidays, err := s.store.ListHolidays(term.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if holidays == nil {
+		holidays = []Holiday{}
+	}
+	render.JSON(w, r, holidays)
+}
+
+// ReplaceTermHolidays replaces the days of a term on which no meetings take
+// place.
+func (s *Server) ReplaceTermHolidays(w http.ResponseWriter, r *http.Request) {
+	var req HolidaysRequest
+	if err := CheckJSON(w, r, &req); err != nil {
+		return
+	}
+	term, ok := s.findTerm(w, r)
+	if !ok {
+		return
+	}
+	if !writeValidationProblem(w, validateHolidays(term, req.Holidays)) {
+		return
+	}
+
+	holidays := slices.Clone(req.Holidays)
+	if holidays == nil {
+		holidays = []Holiday{}
+	}
+	if err := s.audited(r).SetTermHolidays(term.ID, holidays); err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	slices.SortFunc(holidays, func(a, b Holiday) int { return a.Date.Compare(b.Date.Time) })
+	render.JSON(w, r, holidays)
+}
+
+// findTerm loads the term identified by the {id} URL parameter, writing a
+// 404 when it does not exist.
+func (s *Server) findTerm(w http.ResponseWriter, r *http.Request) (Term, bool) {
+	id, err := ParseIntParam(w, r, "id")
+	if err != nil {
+		return Term{}, false
+	}
+
+	term, err := s.store.GetTerm(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, http.StatusNotFound, CodeNotFound, "Term with id '%v' not found.", id)
+		return Term{}, false
+	} else if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return Term{}, false
+	}
+	return term, true
+}
+
+// validateTerm checks the validate rules of term and that it does not end
+// before it starts.
+func validateTerm(term Term) []FieldError {
+	errs := Validate(term)
+	if !term.StartDate.IsZero() && term.EndDate.Before(term.StartDate.Time) {
+		errs = append(errs, FieldError{Field: "end_date", Code: "min", Message: "Must not be before start_date."})
+	}
+	return errs
+}
+
+// validateHolidays checks the validate rules of each holiday and that it
+// falls in term once, naming fields after their index in the request.
+func validateHolidays(term Term, holidays []Holiday) []FieldError {
+	var errs []FieldError
+	for i, holiday := range holidays {
+		prefix := fmt.Sprintf("holidays[%d].", i)
+		for _, err := range Validate(holiday) {
+			err.Field = prefix + err.Field
+			errs = append(errs, err)
+		}
+		if holiday.Date.IsZero() {
+			continue
+		}
+		if holiday.Date.Before(term.StartDate.Time) || holiday.Date.After(term.EndDate.Time) {
+			errs = append(errs, FieldError{Field: prefix + "date", Code: "range", Message: fmt.Sprintf("Must be between %v and %v.", term.StartDate, term.EndDate)})
+		} else if slices.ContainsFunc(holidays[:i], func(other Holiday) bool { return other.Date.Equal(holiday.Date.Time) }) {
+			errs = append(errs, FieldError{Field: prefix + "date", Code: "unique", Message: "Is listed more than once."})
+		}
+	}
+	return errs
+}
+
+func handleTermWriteError(w http.ResponseWriter, term Term, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		WriteProblem(w, http.StatusConflict, CodeConflict, "A term named '%v' already exists.", term.Name)
+	default:
+		HandleDBErrorGeneric(w, err)
+	}
+}
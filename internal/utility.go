@@ -10,7 +10,7 @@ func Write(w http.ResponseWriter, v any) error {
 	err := json.NewEncoder(w).Encode(v)
 	if err != nil {
 		Out("ERROR", err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		WriteProblem(w, http.StatusInternalServerError, CodeInternal, "Internal error")
 	}
 	return err
 }
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Declarative request validation.
+
+Models declare their rules in a validate struct tag, as a comma-separated list
+checked in order:
+
+	required   the field is not its zero value (strings: not blank)
+	min=N      strings and slices: at least N long; integers: at least N
+	max=N      strings and slices: at most N long; integers: at most N
+	oneof=a b  the value is one of the space-separated words
+
+Pointer fields are checked through the pointer. A nil pointer only breaks
+required, so the other rules apply to optional fields when they are set, and
+a set pointer meets required even when it points to a zero value.
+
+Validate stops at the first rule a field breaks, but reports every field, so a
+client can fix a request in one round trip.
+*/
+
+// Validate checks the validate rules of the struct v and returns every
+// violation. Fields are named after their JSON key.
+func Validate(v any) []FieldError {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	typ := val.Type()
+
+	var errs []FieldError
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		rules, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name := jsonName(field)
+		value := val.Field(i)
+		set := value.Kind() == reflect.Pointer && !value.IsNil()
+		if set {
+			value = value.Elem()
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if value.Kind() == reflect.Pointer && rule != "required" || set && rule == "required" {
+				// A nil pointer, which only required checks, or a set one,
+				// which meets it.
+				continue
+			}
+			if msg := checkRule(value, rule); msg != "" {
+				code, _, _ := strings.Cut(rule, "=")
+				errs = append(errs, FieldError{Field: name, Code: code, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// checkRule returns why value breaks rule, or "" when it does not.
+func checkRule(value reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" || value.IsZero() {
+			return "Is required."
+		}
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %v rule %q", name, rule))
+		}
+		size, unit := ruleSize(value)
+		if name == "min" && size < limit {
+			return fmt.Sprintf("Must be at least %d%v.", limit, unit)
+		}
+		if name == "max" && size > limit {
+			return fmt.Sprintf("Must be at most %d%v.", limit, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		if !slices.Contains(options, fmt.Sprint(value.Interface())) {
+			return fmt.Sprintf("Must be one of '%v'.", strings.Join(options, "', '"))
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// ruleSize is the quantity min and max compare: the length of strings (in
+// characters) and slices, or the value of integers.
+func ruleSize(value reflect.Value) (int, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice:
+		return value.Len(), " items"
+	default:
+		return int(value.Int()), ""
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// writeValidationProblem writes a 400 listing errs and returns false, or
+// returns true when errs is empty.
+func writeValidationProblem(w http.ResponseWriter, errs []FieldError) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	problem := NewProblem(http.StatusBadRequest, CodeValidationFailed, "Request body failed validation.")
+	problem.Errors = errs
+	problem.Write(w)
+	return false
+}
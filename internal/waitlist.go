@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+/*
+Waitlists: /api/course/{id}/waitlist, /api/offering/{id}/waitlist and
+/api/person/{id}/waitlist.
+
+Students who enroll in a full offering are queued on its waitlist and
+promoted, first in line first, as seats free up. A student whose schedule
+the offering would overlap is passed over and keeps their place, with the
+reason as the hold_reason of their entry. Each entry carries its current
+position.
+*/
+
+// GetCourseWaitlist lists the waitlists of every offering of a course, by
+// offering and then position.
+func (s *Server) GetCourseWaitlist(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.findCourse(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	offerings, _, err := s.store.ListOfferings(OfferingFilter{CourseID: course.ID}, Page{})
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	entries := []WaitlistEntry{}
+	for _, offering := range offerings {
+		waitlist, err := s.store.ListWaitlist(offering.ID)
+		if err != nil {
+			HandleDBErrorGeneric(w, err)
+			return
+		}
+		entries = append(entries, waitlist...)
+	}
+	render.JSON(w, r, entries)
+}
+
+func (s *Server) GetOfferingWaitlist(w http.ResponseWriter, r *http.Request) {
+	offering, ok := s.findOffering(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := s.store.ListWaitlist(offering.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []WaitlistEntry{}
+	}
+	render.JSON(w, r, entries)
+}
+
+// GetPersonWaitlist lists the waitlist entries of a person, with their
+// position in each.
+func (s *Server) GetPersonWaitlist(w http.ResponseWriter, r *http.Request) {
+	person, ok := s.findPersonByID(w, r, s.store)
+	if !ok {
+		return
+	}
+
+	entries, err := s.store.ListPersonWaitlist(person.ID)
+	if err != nil {
+		HandleDBErrorGeneric(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []WaitlistEntry{}
+	}
+	render.JSON(w, r, entries)
+}
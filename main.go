@@ -1,24 +1,164 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/aaron-epstein/Go-API-Tech-Challenge/internal"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
+const usage = `usage:
+  go run .                      start the API server
+  go run . migrate up           apply pending migrations
+  go run . migrate down [n]     revert the last n migrations (default 1)
+  go run . migrate status       list migrations and whether they are applied
+  go run . seed                 insert the seed data (idempotent)
+  go run . import [flags]       import CSV files of courses, persons and
+                                enrollments in one transaction; see -help`
+
 func main() {
 	err := godotenv.Load(".env.local")
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	_, err = internal.InitDB()
+	db, err := internal.InitDB()
 	if err != nil {
 		// panic(err)
 		log.Fatal("Error connecting to DB")
 	}
 
-	internal.RunServer()
+	args := os.Args[1:]
+	if len(args) == 0 {
+		autoMigrate := os.Getenv("DATABASE_AUTO_MIGRATE") != "false"
+		if err = internal.MigrateOnStart(db, autoMigrate); err != nil {
+			log.Fatal("Refusing to start: ", err)
+		}
+		internal.RunServer(internal.Deps{
+			Store:      internal.NewGormStore(db),
+			AdminToken: os.Getenv("ADMIN_TOKEN"),
+		})
+		return
+	}
+
+	switch args[0] {
+	case "migrate":
+		err = migrate(db, args[1:])
+	case "seed":
+		err = internal.Seed(internal.NewGormStore(db))
+	case "import":
+		err = importCSV(db, args[1:])
+	default:
+		err = fmt.Errorf("unknown command '%v'\n%v", args[0], usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func migrate(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%v", usage)
+	}
+	migrator, err := internal.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	var done []internal.Migration
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count '%v'", args[1])
+			}
+		}
+		done, err = migrator.Down(steps)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			fmt.Println(status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command '%v'\n%v", args[0], usage)
+	}
+
+	for _, migration := range done {
+		internal.Outf("%v %04d_%v", args[0], migration.Version, migration.Name)
+	}
+	return err
+}
+
+// importActor is the audit log actor of imports run from the command line.
+const importActor = "import"
+
+func importCSV(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	var options internal.ImportOptions
+	flags.BoolVar(&options.DryRun, "dry-run", false, "report the rows that would fail without writing anything")
+	flags.BoolVar(&options.OverridePrerequisites, "override-prerequisites", false, "import enrollments of students who lack prerequisites")
+	paths := map[string]*string{}
+	for _, name := range internal.ImportFileNames {
+		paths[name] = flags.String(name, "", "CSV file of "+name)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	files := internal.ImportFiles{}
+	for name, path := range paths {
+		if *path == "" {
+			continue
+		}
+		file, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		files[name] = file
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no file to import: set at least one of -%v", strings.Join(internal.ImportFileNames, ", -"))
+	}
 
+	report, err := internal.Import(internal.Audited(internal.NewGormStore(db), importActor), files, options)
+	if err != nil {
+		return err
+	}
+	printImportReport(os.Stdout, report)
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d rows failed, so nothing was imported", len(report.Errors))
+	}
+	return nil
+}
+
+// printImportReport lists the failed rows of report, with the file and line
+// of each, then what was imported.
+func printImportReport(w io.Writer, report internal.ImportReport) {
+	for _, row := range report.Errors {
+		fmt.Fprintf(w, "%v:%d: %v\n", row.File, row.Line, row.Detail)
+		for _, field := range row.Errors {
+			fmt.Fprintf(w, "\t%v: %v\n", field.Field, field.Message)
+		}
+	}
+	verb := "imported"
+	if report.DryRun || len(report.Errors) > 0 {
+		verb = "would import"
+	}
+	imported := report.Imported
+	fmt.Fprintf(w, "%v %d courses, %d persons and %d enrollments (%d waitlisted)\n", verb, imported.Courses, imported.Persons, imported.Enrollments, report.Waitlisted)
 }
@@ -2,16 +2,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aaron-epstein/Go-API-Tech-Challenge/internal"
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func handleCourse() func(TestContext, *httptest.ResponseRecorder) error {
@@ -112,6 +118,34 @@ func handlePersonsFn(fn func(TestContext, []internal.PersonResponse) error) func
 	}
 }
 
+func handleProblem(code internal.ProblemCode) func(TestContext, *httptest.ResponseRecorder) error {
+	return handleProblemFn(code, nil)
+}
+
+func handleProblemFn(code internal.ProblemCode, fn func(TestContext, internal.Problem) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		require.Equal(tctx.T, internal.ProblemContentType, res.Header().Get("Content-Type"))
+		var problem internal.Problem
+		err := json.NewDecoder(bytes.NewReader(res.Body.Bytes())).Decode(&problem)
+		if err != nil {
+			require.Nil(tctx.T, err)
+			return err
+		}
+		require.Equal(tctx.T, code, problem.Code)
+		require.Equal(tctx.T, tctx.Test.Status, problem.Status)
+		require.NotEmpty(tctx.T, problem.Title)
+		if fn != nil {
+			err = fn(tctx, problem)
+			if err != nil {
+				require.Nil(tctx.T, err)
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
 func testCourses(tctx TestContext) {
 
 	tests := []UnitTest{
@@ -149,7 +183,10 @@ func testPersons(tctx TestContext) {
       "type": "student",
       "age": 24,
       "courses": [1, 2]
-		}`, ResponseFn: handlePerson()},
+		}`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["person_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
 		{Method: "PUT", Url: "/api/person/{name}", Status: http.StatusAccepted, Body: `
     {
       "first_name": "Test",
@@ -164,22 +201,2012 @@ func testPersons(tctx TestContext) {
 	executeTests(tctx, tests)
 }
 
-func TestMain(t *testing.T) {
-	err := godotenv.Load(".env.local")
-	if err != nil {
-		log.Fatal("Error loading .env file")
+func testPersonsByID(tctx TestContext) {
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/person/1", Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, "Steve", person.FirstName)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/99999", Status: http.StatusNotFound},
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Mary Ann",
+      "last_name": "Smith",
+      "type": "student",
+      "age": 20
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["first_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/Mary Ann Smith", Status: http.StatusOK, ResponseFn: handlePerson()},
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Mary",
+      "last_name": "Ann Smith",
+      "type": "professor",
+      "age": 40
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["second_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/Mary Ann Smith", Status: http.StatusConflict, ResponseFn: handleProblemFn(internal.CodeAmbiguousName, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Candidates, 2)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/person/Mary Ann Smith", Status: http.StatusConflict},
+		{Method: "GET", Url: "/api/person/resolve?name=mary%20ann%20smith", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 2)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/person/{second_id}", Status: http.StatusAccepted, Body: `
+    {
+      "first_name": "Mary",
+      "last_name": "Ann Smith",
+      "type": "professor",
+      "age": 41,
+      "courses": [3]
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, 41, person.Age)
+			require.Len(tctx.T, person.Courses, 1)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/person/{first_id}", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/person/{second_id}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/person/{second_id}", Status: http.StatusNotFound},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testEnrollments(tctx TestContext) {
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/course/1/persons", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 5)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/1/persons?type=professor", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 2)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/1/persons?type=dean", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/course/99999/persons", Status: http.StatusNotFound},
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Enrollment",
+      "last_name": "Student",
+      "type": "student",
+      "age": 19
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["person_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course/1/persons", Status: http.StatusCreated, Body: `{"person_id": {person_id}}`},
+		{Method: "POST", Url: "/api/course/1/persons", Status: http.StatusConflict, Body: `{"person_id": {person_id}}`, ResponseFn: handleProblem(internal.CodeAlreadyEnrolled)},
+		{Method: "POST", Url: "/api/course/1/persons", Status: http.StatusNotFound, Body: `{"person_id": 99999}`},
+		{Method: "POST", Url: "/api/person/{person_id}/courses", Status: http.StatusCreated, Body: `{"course_id": 2}`},
+		{Method: "POST", Url: "/api/person/{person_id}/courses", Status: http.StatusNotFound, Body: `{"course_id": 99999}`},
+		{Method: "GET", Url: "/api/person/{person_id}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 2)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/course/1/persons/{person_id}", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/course/1/persons/{person_id}", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotEnrolled)},
+		{Method: "PUT", Url: "/api/person/{person_id}/courses", Status: http.StatusAccepted, Body: `{"course_ids": [1, 3]}`, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 2)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/course/3/persons", Status: http.StatusNotFound, Body: `{"person_ids": [1, 99999]}`},
+		{Method: "PUT", Url: "/api/course/3/persons", Status: http.StatusAccepted, Body: `{"person_ids": [1, 2, 3, 4, 5]}`, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 5)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{person_id}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/person/{person_id}/courses/1", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/person/{person_id}", Status: http.StatusOK},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testPagination(tctx TestContext) {
+
+	lastNames := func(persons []internal.PersonResponse) []string {
+		names := make([]string, len(persons))
+		for i, person := range persons {
+			names[i] = person.LastName
+		}
+		return names
 	}
 
-	_, err = internal.InitDB()
-	if err != nil {
-		// panic(err)
-		log.Fatal("Error connecting to DB")
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/person?sort=last_name", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Equal(tctx.T, []string{"Bezos", "Gates", "Jobs", "Musk", "Page"}, lastNames(persons))
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?limit=2&sort=-age", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, "5", res.Header().Get("X-Total-Count"))
+			tctx.Vars["next"] = linkURL(res, "next")
+			require.NotEmpty(tctx.T, tctx.Vars["next"])
+			return handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+				require.Equal(tctx.T, []string{"Gates", "Bezos"}, lastNames(persons))
+				return nil
+			})(tctx, res)
+		}},
+		// A row inserted ahead of the cursor does not shift the next page.
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Page",
+      "last_name": "Inserted",
+      "type": "student",
+      "age": 90
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["person_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "GET", Url: "{next}", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Equal(tctx.T, []string{"Jobs", "Musk"}, lastNames(persons))
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/person/{person_id}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course?limit=2&offset=2", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, "3", res.Header().Get("X-Total-Count"))
+			require.Equal(tctx.T, "/api/course?limit=2&offset=0", linkURL(res, "prev"))
+			require.Equal(tctx.T, "/api/course?limit=2&offset=2", linkURL(res, "last"))
+			require.Empty(tctx.T, linkURL(res, "next"))
+			return handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+				require.Len(tctx.T, courses, 1)
+				return nil
+			})(tctx, res)
+		}},
+		{Method: "GET", Url: "/api/course?sort=-name", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Equal(tctx.T, "UI Design", courses[0].Name)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?sort=height", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?limit=0", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?cursor=bogus", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/course?cursor=bogus&offset=1", Status: http.StatusBadRequest},
 	}
 
-	r := internal.InitServer()
+	executeTests(tctx, tests)
+}
+
+func testPersonFilters(tctx TestContext) {
 
-	tctx := NewTestContext(t, r)
-	testCourses(tctx)
-	testPersons(tctx)
+	count := func(n int) func(TestContext, *httptest.ResponseRecorder) error {
+		return handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, n)
+			return nil
+		})
+	}
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/person?age_gte=52&age_lte=60", Status: http.StatusOK, ResponseFn: count(3)},
+		{Method: "GET", Url: "/api/person?type=student&age_gte=60", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.Equal(tctx.T, "Gates", persons[0].LastName)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?name=Bill%20Gates&age=50", Status: http.StatusOK, ResponseFn: count(0)},
+		{Method: "GET", Url: "/api/person?name=Bill%20Gates&age=67", Status: http.StatusOK, ResponseFn: count(1)},
+		{Method: "GET", Url: "/api/person?first_name_prefix=EL", Status: http.StatusOK, ResponseFn: count(1)},
+		{Method: "GET", Url: "/api/person?last_name_contains=ob&type=professor", Status: http.StatusOK, ResponseFn: count(1)},
+		{Method: "GET", Url: "/api/person?first_name=larry&last_name=page", Status: http.StatusOK, ResponseFn: count(1)},
+		{Method: "GET", Url: "/api/person?q=ge", Status: http.StatusOK, ResponseFn: count(1)},
+		{Method: "GET", Url: "/api/person?q=l%20e", Status: http.StatusOK, ResponseFn: count(3)},
+		{Method: "GET", Url: "/api/person?enrolled_in=1,2&enrolled_match=all", Status: http.StatusOK, ResponseFn: count(5)},
+		{Method: "GET", Url: "/api/person?enrolled_in=99999", Status: http.StatusOK, ResponseFn: count(0)},
+		{Method: "GET", Url: "/api/person?age_gte=x", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?age_gte=60&age_lte=50", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?type=dean", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?enrolled_in=1,x", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?enrolled_in=1&enrolled_match=some", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?first_name_prefix=", Status: http.StatusBadRequest},
+		{Method: "GET", Url: "/api/person?height=2", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeUnknownParameter)},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testProblems(tctx TestContext) {
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/course/abc", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "GET", Url: "/api/course/99999", Status: http.StatusNotFound, ResponseFn: handleProblemFn(internal.CodeNotFound, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "Course with id '99999' not found.", problem.Detail)
+			require.Equal(tctx.T, "/problems/not_found", problem.Type)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/Cher", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "POST", Url: "/api/course", Status: http.StatusBadRequest, Body: `{"name": 5}`, ResponseFn: handleProblemFn(internal.CodeInvalidBody, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 1)
+			require.Equal(tctx.T, "name", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course", Status: http.StatusBadRequest, Body: `{"title": "Compilers"}`, ResponseFn: handleProblemFn(internal.CodeInvalidBody, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 1)
+			require.Equal(tctx.T, "title", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course", Status: http.StatusBadRequest, Body: `{"name": `, ResponseFn: handleProblem(internal.CodeInvalidBody)},
+		{Method: "POST", Url: "/api/course", Status: http.StatusUnsupportedMediaType, ResponseFn: handleProblem(internal.CodeUnsupportedMediaType)},
+		{Method: "GET", Url: "/api/nothing", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "PATCH", Url: "/api/course", Status: http.StatusMethodNotAllowed, ResponseFn: handleProblem(internal.CodeMethodNotAllowed)},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testValidation(tctx TestContext) {
+
+	fields := func(want ...string) func(TestContext, *httptest.ResponseRecorder) error {
+		return handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			got := make([]string, len(problem.Errors))
+			for i, fieldErr := range problem.Errors {
+				got[i] = fieldErr.Field + ":" + fieldErr.Code
+			}
+			require.Equal(tctx.T, want, got)
+			return nil
+		})
+	}
+	long := strings.Repeat("x", 101)
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/person", Status: http.StatusBadRequest, Body: `
+    {
+      "first_name": " ",
+      "last_name": "` + long + `",
+      "type": "dean",
+      "age": -5,
+      "courses": [1, 99999]
+    }`, ResponseFn: fields("first_name:required", "last_name:max", "type:oneof", "age:min", "courses:exists")},
+		{Method: "POST", Url: "/api/person", Status: http.StatusBadRequest, Body: `{"first_name": "Ada"}`, ResponseFn: fields("last_name:required", "type:required", "age:required")},
+		{Method: "PUT", Url: "/api/person/1", Status: http.StatusBadRequest, Body: `
+    {
+      "first_name": "Steve",
+      "last_name": "Jobs",
+      "type": "professor",
+      "age": 200
+    }`, ResponseFn: fields("age:max")},
+		{Method: "GET", Url: "/api/person/1", Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, 56, person.Age)
+			return nil
+		})},
+		// Age 0 is valid, unlike a missing age.
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `{"first_name": "Newly", "last_name": "Born", "type": "student", "age": 0}`, ResponseFn: saveID("newborn")},
+		{Method: "GET", Url: "/api/person/{newborn}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), `"age":0`)
+			require.Contains(tctx.T, res.Body.String(), `"courses":[]`)
+			require.Contains(tctx.T, res.Body.String(), `"major_id":null`)
+			return nil
+		}},
+		{Method: "PATCH", Url: "/api/person/{newborn}", Status: http.StatusBadRequest, ContentType: internal.MergePatchContentType, Body: `{"age": null}`, ResponseFn: fields("age:required")},
+		{Method: "PATCH", Url: "/api/person/{newborn}", Status: http.StatusAccepted, ContentType: internal.MergePatchContentType, Body: `{"age": 1}`},
+		{Method: "PUT", Url: "/api/person/{newborn}", Status: http.StatusAccepted, Body: `{"first_name": "Newly", "last_name": "Born", "type": "student", "age": 0}`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, 0, person.Age)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/person/{newborn}", Status: http.StatusOK},
+		{Method: "POST", Url: "/api/course", Status: http.StatusBadRequest, Body: `{}`, ResponseFn: fields("name:required")},
+		{Method: "POST", Url: "/api/course", Status: http.StatusBadRequest, Body: `{"name": "` + long + `"}`, ResponseFn: fields("name:max")},
+		{Method: "PUT", Url: "/api/course/1", Status: http.StatusBadRequest, Body: `{"name": ""}`, ResponseFn: fields("name:required")},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testPatch(tctx TestContext) {
+
+	merge, jsonPatch := internal.MergePatchContentType, internal.JSONPatchContentType
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Patch",
+      "last_name": "Target",
+      "type": "student",
+      "age": 20,
+      "courses": [1, 2]
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["patch_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, ContentType: merge, Body: `{"age": 21}`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, 21, person.Age)
+			require.Equal(tctx.T, "Patch", person.FirstName)
+			require.Len(tctx.T, person.Courses, 2)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/Patch Target", Status: http.StatusAccepted, ContentType: merge, Body: `{"type": "professor", "courses": [3]}`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, "professor", person.Type)
+			require.Len(tctx.T, person.Courses, 1)
+			require.Equal(tctx.T, 3, person.Courses[0].ID)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusBadRequest, ContentType: merge, Body: `{"first_name": null, "age": -1}`, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusBadRequest, ContentType: merge, Body: `{"nickname": "pt"}`, ResponseFn: handleProblem(internal.CodeInvalidBody)},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, ContentType: jsonPatch, Body: `[
+      {"op": "test", "path": "/age", "value": 21},
+      {"op": "replace", "path": "/last_name", "value": "Patched"},
+      {"op": "add", "path": "/courses/-", "value": 1}
+    ]`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, "Patched", person.LastName)
+			require.Len(tctx.T, person.Courses, 2)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusConflict, ContentType: jsonPatch, Body: `[
+      {"op": "test", "path": "/age", "value": 99},
+      {"op": "replace", "path": "/age", "value": 99}
+    ]`, ResponseFn: handleProblem(internal.CodePatchTestFailed)},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusBadRequest, ContentType: jsonPatch, Body: `[{"op": "remove", "path": "/nickname"}]`, ResponseFn: handleProblem(internal.CodeInvalidPatch)},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusUnsupportedMediaType, Body: `{"age": 30}`, ResponseFn: handleProblem(internal.CodeUnsupportedMediaType)},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, ContentType: jsonPatch, Body: `[{"op": "remove", "path": "/courses"}]`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Empty(tctx.T, person.Courses)
+			require.Equal(tctx.T, 21, person.Age)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, Body: `
+    {
+      "first_name": "Patch",
+      "last_name": "Target",
+      "type": "student",
+      "age": 22,
+      "courses": [2]
+    }`},
+		{Method: "PUT", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, Body: `
+    {
+      "first_name": "Patch",
+      "last_name": "Target",
+      "type": "student",
+      "age": 23
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, 23, person.Age)
+			require.Len(tctx.T, person.Courses, 1)
+			return nil
+		})},
+		// An empty path points at the whole document.
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, ContentType: jsonPatch, Body: `[
+      {"op": "replace", "path": "", "value": {"first_name": "Whole", "last_name": "Document", "type": "student", "age": 24, "courses": [1]}},
+      {"op": "move", "from": "", "path": ""}
+    ]`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, "Whole", person.FirstName)
+			require.Equal(tctx.T, 24, person.Age)
+			require.Len(tctx.T, person.Courses, 1)
+			require.Equal(tctx.T, 1, person.Courses[0].ID)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusAccepted, ContentType: jsonPatch, Body: `[
+      {"op": "add", "path": "", "value": {"first_name": "Patch", "last_name": "Target", "type": "student", "age": 23}}
+    ]`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Equal(tctx.T, "Target", person.LastName)
+			require.Empty(tctx.T, person.Courses)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{patch_id}", Status: http.StatusBadRequest, ContentType: jsonPatch, Body: `[{"op": "remove", "path": ""}]`},
+		{Method: "DELETE", Url: "/api/person/{patch_id}", Status: http.StatusOK},
+		{Method: "PATCH", Url: "/api/course/2", Status: http.StatusAccepted, ContentType: merge, Body: `{"name": "Relational Databases"}`, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, "Relational Databases", course.Name)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/course/2", Status: http.StatusAccepted, ContentType: jsonPatch, Body: `[{"op": "replace", "path": "/name", "value": "Databases"}]`},
+		{Method: "PATCH", Url: "/api/course/2", Status: http.StatusBadRequest, ContentType: merge, Body: `{"name": null}`, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "PATCH", Url: "/api/course/99999", Status: http.StatusNotFound, ContentType: merge, Body: `{"name": "Nothing"}`},
+		{Method: "GET", Url: "/api/course/2", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, "Databases", course.Name)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+// saveETag stores the ETag response header in tctx.Vars[key].
+func saveETag(key string) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		etag := res.Header().Get("ETag")
+		require.NotEmpty(tctx.T, etag)
+		require.NotEqual(tctx.T, tctx.Vars[key], etag)
+		tctx.Vars[key] = etag
+		return nil
+	}
+}
+
+func testConditionalRequests(tctx TestContext) {
+
+	merge := internal.MergePatchContentType
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/person/1", Status: http.StatusOK, ResponseFn: saveETag("person_etag")},
+		{Method: "GET", Url: "/api/person/1", Headers: map[string]string{"If-None-Match": "{person_etag}"}, Status: http.StatusNotModified},
+		{Method: "GET", Url: "/api/person/Steve Jobs", Headers: map[string]string{"If-None-Match": `"other", W/{person_etag}`}, Status: http.StatusNotModified},
+		{Method: "PATCH", Url: "/api/person/1", Headers: map[string]string{"If-Match": "{person_etag}"}, ContentType: merge, Body: `{"age": 57}`, Status: http.StatusAccepted, ResponseFn: saveETag("new_person_etag")},
+		{Method: "PATCH", Url: "/api/person/1", Headers: map[string]string{"If-Match": "{person_etag}"}, ContentType: merge, Body: `{"age": 58}`, Status: http.StatusPreconditionFailed, ResponseFn: handleProblem(internal.CodePreconditionFailed)},
+		{Method: "PUT", Url: "/api/person/Steve Jobs", Headers: map[string]string{"If-Match": "{person_etag}"}, Status: http.StatusPreconditionFailed, Body: `
+    {
+      "first_name": "Steve",
+      "last_name": "Jobs",
+      "type": "professor",
+      "age": 58
+    }`},
+		{Method: "GET", Url: "/api/person/1", Headers: map[string]string{"If-None-Match": "{new_person_etag}"}, Status: http.StatusNotModified},
+
+		// Enrollment changes and course renames change the person's ETag.
+		{Method: "DELETE", Url: "/api/person/1/courses/1", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/person/1", Headers: map[string]string{"If-None-Match": "{new_person_etag}"}, Status: http.StatusOK, ResponseFn: saveETag("new_person_etag")},
+		{Method: "POST", Url: "/api/person/1/courses", Status: http.StatusCreated, Body: `{"course_id": 1}`},
+		{Method: "GET", Url: "/api/person/1", Headers: map[string]string{"If-None-Match": "{new_person_etag}"}, Status: http.StatusOK, ResponseFn: saveETag("new_person_etag")},
+		{Method: "GET", Url: "/api/course/1", Status: http.StatusOK, ResponseFn: saveETag("course_etag")},
+		{Method: "GET", Url: "/api/course/1", Headers: map[string]string{"If-None-Match": "{course_etag}"}, Status: http.StatusNotModified},
+		{Method: "PATCH", Url: "/api/course/1", Headers: map[string]string{"If-Match": "{course_etag}"}, ContentType: merge, Body: `{"name": "Programming I"}`, Status: http.StatusAccepted, ResponseFn: saveETag("new_course_etag")},
+		{Method: "PUT", Url: "/api/course/1", Headers: map[string]string{"If-Match": "{course_etag}"}, Body: `{"name": "Programming"}`, Status: http.StatusPreconditionFailed},
+		{Method: "PUT", Url: "/api/course/1", Headers: map[string]string{"If-Match": "{new_course_etag}"}, Body: `{"name": "Programming"}`, Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/person/1", Headers: map[string]string{"If-None-Match": "{new_person_etag}"}, Status: http.StatusOK, ResponseFn: saveETag("new_person_etag")},
+		{Method: "PATCH", Url: "/api/person/1", Headers: map[string]string{"If-Match": "*"}, ContentType: merge, Body: `{"age": 56}`, Status: http.StatusAccepted},
+
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Conditional",
+      "last_name": "Delete",
+      "type": "student",
+      "age": 30
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["conditional_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{conditional_id}", Status: http.StatusOK, ResponseFn: saveETag("conditional_etag")},
+		{Method: "DELETE", Url: "/api/person/{conditional_id}", Headers: map[string]string{"If-Match": `"stale"`}, Status: http.StatusPreconditionFailed},
+		{Method: "DELETE", Url: "/api/person/Conditional Delete", Headers: map[string]string{"If-Match": "{conditional_etag}"}, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/person/{conditional_id}", Status: http.StatusNotFound},
+		{Method: "DELETE", Url: "/api/course/1", Headers: map[string]string{"If-Match": "{course_etag}"}, Status: http.StatusPreconditionFailed},
+	}
+
+	executeTests(tctx, tests)
+}
+
+const adminToken = "test-admin-token"
+
+func testSoftDelete(tctx TestContext) {
+
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Soft",
+      "last_name": "Delete",
+      "type": "student",
+      "age": 30,
+      "courses": [1, 2]
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["soft_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person/{soft_id}/restore", Headers: admin, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeNotDeleted)},
+		{Method: "DELETE", Url: "/api/person/{soft_id}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/person/{soft_id}", Status: http.StatusNotFound},
+		{Method: "GET", Url: "/api/person/Soft Delete", Status: http.StatusNotFound},
+		{Method: "DELETE", Url: "/api/person/{soft_id}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), "No person found")
+			return nil
+		}},
+		{Method: "GET", Url: "/api/person?last_name=Delete", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Empty(tctx.T, persons)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/1/persons", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 5)
+			return nil
+		})},
+
+		// The admin view includes deleted rows.
+		{Method: "GET", Url: "/api/person?include_deleted=true", Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "GET", Url: "/api/person?include_deleted=true", Headers: map[string]string{"Authorization": "Bearer wrong"}, Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "GET", Url: "/api/person?include_deleted=maybe", Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "GET", Url: "/api/person?include_deleted=false", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 5)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?include_deleted=true&first_name=Soft", Headers: admin, Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.NotNil(tctx.T, persons[0].DeletedAt)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{soft_id}?include_deleted=true", Headers: admin, Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.NotNil(tctx.T, person.DeletedAt)
+			require.Len(tctx.T, person.Courses, 2)
+			return nil
+		})},
+
+		// Restoring brings the person back with its enrollments.
+		{Method: "POST", Url: "/api/person/{soft_id}/restore", Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "POST", Url: "/api/person/{soft_id}/restore", Headers: map[string]string{"Authorization": "Bearer wrong"}, Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "POST", Url: "/api/person/999/restore", Headers: admin, Status: http.StatusNotFound},
+		{Method: "POST", Url: "/api/person/{soft_id}/restore", Headers: admin, Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Nil(tctx.T, person.DeletedAt)
+			require.Equal(tctx.T, []int{1, 2}, []int{person.Courses[0].ID, person.Courses[1].ID})
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person/{soft_id}/restore", Headers: admin, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeNotDeleted)},
+		{Method: "GET", Url: "/api/course/1/persons", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 6)
+			return nil
+		})},
+
+		// A deleted course drops out of its persons' courses until restored.
+		{Method: "DELETE", Url: "/api/course/2", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course/2", Status: http.StatusNotFound},
+		{Method: "GET", Url: "/api/course", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 2)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/2?include_deleted=true", Headers: admin, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), `"deleted_at"`)
+			return nil
+		}},
+		{Method: "GET", Url: "/api/person/{soft_id}", Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Len(tctx.T, person.Courses, 1)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course/2/restore", Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "POST", Url: "/api/course/2/restore", Headers: admin, Status: http.StatusOK},
+		{Method: "POST", Url: "/api/course/2/restore", Headers: admin, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeNotDeleted)},
+		{Method: "GET", Url: "/api/person/{soft_id}", Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Len(tctx.T, person.Courses, 2)
+			return nil
+		})},
+
+		{Method: "DELETE", Url: "/api/person/{soft_id}", Status: http.StatusOK},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func handleAuditFn(fn func(TestContext, []internal.AuditEntry) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var entries []internal.AuditEntry
+		err := json.NewDecoder(bytes.NewReader(res.Body.Bytes())).Decode(&entries)
+		require.Nil(tctx.T, err)
+		return fn(tctx, entries)
+	}
+}
+
+func testAudit(tctx TestContext) {
+
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+	registrar := map[string]string{"X-Actor": "registrar"}
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/audit", Status: http.StatusUnauthorized},
+		{Method: "POST", Url: "/api/person", Headers: registrar, Status: http.StatusCreated, Body: `
+    {
+      "first_name": "Audit",
+      "last_name": "Trail",
+      "type": "student",
+      "age": 20,
+      "courses": [1, 2]
+    }`, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			tctx.Vars["audit_id"] = fmt.Sprintf("%d", person.ID)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{audit_id}", ContentType: internal.MergePatchContentType, Body: `{"age": 21}`, Status: http.StatusAccepted},
+		{Method: "DELETE", Url: "/api/course/2/persons/{audit_id}", Headers: registrar, Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/course/2/persons/{audit_id}", Headers: registrar, Status: http.StatusNotFound},
+		{Method: "DELETE", Url: "/api/person/{audit_id}", Headers: registrar, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/audit?entity=person&id={audit_id}", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Len(tctx.T, entries, 4)
+			operations := []string{entries[0].Operation, entries[1].Operation, entries[2].Operation, entries[3].Operation}
+			require.Equal(tctx.T, []string{"create", "update", "enrollment", "delete"}, operations)
+			require.Equal(tctx.T, "registrar", entries[0].Actor)
+			require.Equal(tctx.T, "anonymous", entries[1].Actor)
+			require.Nil(tctx.T, entries[0].Diff.Before)
+			require.Equal(tctx.T, "Audit", entries[0].Diff.After["first_name"])
+			require.Equal(tctx.T, map[string]any{"age": 20.0}, entries[1].Diff.Before)
+			require.Equal(tctx.T, map[string]any{"age": 21.0}, entries[1].Diff.After)
+			require.Equal(tctx.T, []any{1.0, 2.0}, entries[2].Diff.Before["courses"])
+			require.Equal(tctx.T, []any{1.0}, entries[2].Diff.After["courses"])
+			require.Nil(tctx.T, entries[3].Diff.After)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/audit?entity=person&id={audit_id}&actor=registrar&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, "3", res.Header().Get("X-Total-Count"))
+			require.NotEmpty(tctx.T, linkURL(res, "next"))
+			return nil
+		}},
+		{Method: "GET", Url: "/api/audit?since=2100-01-01T00:00:00Z", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Empty(tctx.T, entries)
+			return nil
+		})},
+
+		{Method: "PATCH", Url: "/api/course/3", Headers: registrar, ContentType: internal.MergePatchContentType, Body: `{"name": "UX Design"}`, Status: http.StatusAccepted},
+		{Method: "PATCH", Url: "/api/course/3", Headers: registrar, ContentType: internal.MergePatchContentType, Body: `{"name": "UI Design"}`, Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/audit?entity=course&id=3&sort=-id&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Len(tctx.T, entries, 1)
+			require.Equal(tctx.T, map[string]any{"name": "UX Design"}, entries[0].Diff.Before)
+			require.Equal(tctx.T, map[string]any{"name": "UI Design"}, entries[0].Diff.After)
+			return nil
+		})},
+
+		{Method: "GET", Url: "/api/audit?entity=enrollment", Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "GET", Url: "/api/audit?id=1", Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "GET", Url: "/api/audit?since=yesterday", Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "GET", Url: "/api/audit?person=1", Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeUnknownParameter)},
+	}
 
+	executeTests(tctx, tests)
+}
+
+func saveID(key string) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var output map[string]int
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &output))
+		tctx.Vars[key] = fmt.Sprintf("%d", output["id"])
+		return nil
+	}
+}
+
+func testOfferings(tctx TestContext) {
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/term", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), `"name":"Fall 2024","start_date":"2024-08-26","end_date":"2024-12-13"`)
+			return nil
+		}},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Backwards", "start_date": "2027-05-01", "end_date": "2027-01-01"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "end_date", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2027", "start_date": "2027-13-01", "end_date": "2027-05-01"}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidBody)},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2027", "start_date": "2027-01-11", "end_date": "2027-05-07"}`, Status: http.StatusCreated, ResponseFn: saveID("term_id")},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2027", "start_date": "2027-01-11", "end_date": "2027-05-07"}`, Status: http.StatusConflict},
+		{Method: "PUT", Url: "/api/term/{term_id}", Body: `{"name": "Spring 2027", "start_date": "2027-01-12", "end_date": "2027-05-07"}`, Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/term/999", Status: http.StatusNotFound},
+
+		// Larry Page takes Programming a second time.
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": 999, "term_id": 999}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 3)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": 1, "term_id": {term_id}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("offering_id")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": 1, "term_id": {term_id}, "section": "001"}`, Status: http.StatusConflict},
+		{Method: "GET", Url: "/api/offering?term_id={term_id}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.JSONEq(tctx.T, `[{"id": `+tctx.Vars["offering_id"]+`, "course_id": 1, "term_id": `+tctx.Vars["term_id"]+`, "section": "001"}]`, res.Body.String())
+			return nil
+		}},
+		{Method: "POST", Url: "/api/offering/{offering_id}/persons", Body: `{"person_id": 3}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{offering_id}/persons", Body: `{"person_id": 3}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeAlreadyEnrolled)},
+		{Method: "POST", Url: "/api/offering/{offering_id}/persons", Body: `{"person_id": 999}`, Status: http.StatusNotFound},
+		{Method: "GET", Url: "/api/offering/{offering_id}/persons", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.Equal(tctx.T, "Larry", persons[0].FirstName)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/3/offerings", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var offerings []internal.CourseOffering
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &offerings))
+			require.Len(tctx.T, offerings, 4)
+			return nil
+		}},
+		{Method: "GET", Url: "/api/person/3", Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Len(tctx.T, person.Courses, 3)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/audit?entity=person&id=3&sort=-id&limit=1", Headers: map[string]string{"Authorization": "Bearer " + adminToken}, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditEnrollment, entries[0].Operation)
+			require.NotContains(tctx.T, entries[0].Diff.After, "courses")
+			require.Contains(tctx.T, entries[0].Diff.After, "offerings")
+			return nil
+		})},
+
+		// Terms and offerings cannot be deleted while they are in use.
+		{Method: "DELETE", Url: "/api/term/{term_id}", Status: http.StatusConflict},
+		{Method: "DELETE", Url: "/api/offering/{offering_id}", Status: http.StatusConflict},
+		{Method: "PUT", Url: "/api/offering/{offering_id}", Body: `{"course_id": 2, "term_id": {term_id}, "section": "001"}`, Status: http.StatusConflict},
+		{Method: "PUT", Url: "/api/offering/{offering_id}", Body: `{"course_id": 1, "term_id": {term_id}, "section": "002"}`, Status: http.StatusAccepted},
+		{Method: "DELETE", Url: "/api/offering/{offering_id}/persons/3", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/offering/{offering_id}/persons/3", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotEnrolled)},
+		{Method: "DELETE", Url: "/api/offering/{offering_id}", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/term/{term_id}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/offering/{offering_id}", Status: http.StatusNotFound},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func handleWaitlistFn(fn func(TestContext, []internal.WaitlistEntry) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var entries []internal.WaitlistEntry
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &entries))
+		return fn(tctx, entries)
+	}
+}
+
+func testWaitlist(tctx TestContext) {
+	student := func(name string) string {
+		return `{"first_name": "` + name + `", "last_name": "Waiting", "type": "student", "age": 20}`
+	}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Seminar", "capacity": 0}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "capacity", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Seminar", "capacity": 1}`, Status: http.StatusCreated, ResponseFn: saveID("seminar")},
+		{Method: "GET", Url: "/api/course/{seminar}", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, 1, *course.Capacity)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person", Body: student("Ann"), Status: http.StatusCreated, ResponseFn: saveID("ann")},
+		{Method: "POST", Url: "/api/person", Body: student("Ben"), Status: http.StatusCreated, ResponseFn: saveID("ben")},
+		{Method: "POST", Url: "/api/person", Body: student("Cal"), Status: http.StatusCreated, ResponseFn: saveID("cal")},
+
+		// Ann takes the only seat; professors are not counted; Ben and Cal
+		// queue up.
+		{Method: "POST", Url: "/api/course/{seminar}/persons", Body: `{"person_id": {ann}}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{seminar}/persons", Body: `{"person_id": 1}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{seminar}/persons", Body: `{"person_id": {ben}}`, Status: http.StatusAccepted, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var entry internal.WaitlistEntry
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &entry))
+			require.Equal(tctx.T, 1, entry.Position)
+			return nil
+		}},
+		{Method: "POST", Url: "/api/course/{seminar}/persons", Body: `{"person_id": {cal}}`, Status: http.StatusAccepted},
+		{Method: "POST", Url: "/api/person/{ben}/courses", Body: `{"course_id": {seminar}}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeAlreadyWaitlisted)},
+		{Method: "GET", Url: "/api/course/{seminar}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 2)
+			require.Equal(tctx.T, tctx.Vars["ben"], fmt.Sprint(entries[0].PersonID))
+			require.Equal(tctx.T, []int{1, 2}, []int{entries[0].Position, entries[1].Position})
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{cal}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 1)
+			require.Equal(tctx.T, 2, entries[0].Position)
+			return nil
+		})},
+
+		// Ann drops, so Ben is promoted and Cal moves up.
+		{Method: "DELETE", Url: "/api/course/{seminar}/persons/{ann}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course/{seminar}/persons?type=student", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.Equal(tctx.T, "Ben", persons[0].FirstName)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/offering?course_id={seminar}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var offerings []internal.CourseOffering
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &offerings))
+			tctx.Vars["seminar_offering"] = fmt.Sprint(offerings[0].ID)
+			return nil
+		}},
+		{Method: "GET", Url: "/api/offering/{seminar_offering}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 1)
+			require.Equal(tctx.T, tctx.Vars["cal"], fmt.Sprint(entries[0].PersonID))
+			require.Equal(tctx.T, 1, entries[0].Position)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/audit?entity=person&id={ben}&sort=-id&limit=1", Headers: map[string]string{"Authorization": "Bearer " + adminToken}, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditEnrollment, entries[0].Operation)
+			require.NotEmpty(tctx.T, entries[0].Diff.Before["waitlist"])
+			require.Empty(tctx.T, entries[0].Diff.After["waitlist"])
+			return nil
+		})},
+
+		// Leaving the waitlist promotes nobody; raising the capacity does.
+		{Method: "DELETE", Url: "/api/offering/{seminar_offering}/persons/{cal}", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/offering/{seminar_offering}/persons/{cal}", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotEnrolled)},
+		{Method: "POST", Url: "/api/offering/{seminar_offering}/persons", Body: `{"person_id": {ann}}`, Status: http.StatusAccepted},
+		{Method: "PATCH", Url: "/api/course/{seminar}", Body: `{"capacity": 2}`, ContentType: "application/merge-patch+json", Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/course/{seminar}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Empty(tctx.T, entries)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{ann}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			return nil
+		})},
+
+		// Replacing a schedule waitlists the students that do not fit.
+		{Method: "PUT", Url: "/api/person/{cal}/courses", Body: `{"course_ids": [{seminar}]}`, Status: http.StatusAccepted, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Empty(tctx.T, courses)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{cal}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 1)
+			return nil
+		})},
+
+		// Deleting a student frees their seat for the waitlist, and restoring
+		// them waitlists them again.
+		{Method: "DELETE", Url: "/api/person/{ben}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course/{seminar}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Empty(tctx.T, entries)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{seminar}", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, 2, course.StudentCount)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{cal}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/audit?entity=person&id={cal}&sort=-id&limit=1", Headers: map[string]string{"Authorization": "Bearer " + adminToken}, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditEnrollment, entries[0].Operation)
+			require.Empty(tctx.T, entries[0].Diff.After["waitlist"])
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person/{ben}/restore", Headers: map[string]string{"Authorization": "Bearer " + adminToken}, Status: http.StatusOK, ResponseFn: handlePersonFn(func(tctx TestContext, person internal.PersonResponse) error {
+			require.Empty(tctx.T, person.Courses)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/offering/{seminar_offering}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 1)
+			require.Equal(tctx.T, tctx.Vars["ben"], fmt.Sprint(entries[0].PersonID))
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{seminar}", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, 2, course.StudentCount)
+			return nil
+		})},
+		{Method: "DELETE", Url: "/api/offering/{seminar_offering}", Status: http.StatusConflict},
+	}
+
+	executeTests(tctx, tests)
+
+	// Concurrent enrollments never overfill a course.
+	executeTests(tctx, []UnitTest{
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Lab", "capacity": 3}`, Status: http.StatusCreated, ResponseFn: saveID("lab")},
+	})
+	var ids []int
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("POST", "/api/person", strings.NewReader(student(fmt.Sprint("Lab", i))))
+		req.Header.Set("Content-Type", "application/json")
+		res := executeRequest(req, tctx.R)
+		require.Equal(tctx.T, http.StatusCreated, res.Code)
+		var output map[string]int
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &output))
+		ids = append(ids, output["id"])
+	}
+	var wg sync.WaitGroup
+	codes := make([]int, len(ids))
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/api/course/"+tctx.Vars["lab"]+"/persons", strings.NewReader(fmt.Sprintf(`{"person_id": %d}`, id)))
+			req.Header.Set("Content-Type", "application/json")
+			codes[i] = executeRequest(req, tctx.R).Code
+		}()
+	}
+	wg.Wait()
+	enrolled := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			enrolled++
+		}
+	}
+	require.Equal(tctx.T, 3, enrolled)
+	executeTests(tctx, []UnitTest{
+		{Method: "GET", Url: "/api/course/{lab}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 7)
+			for i, entry := range entries {
+				require.Equal(tctx.T, i+1, entry.Position)
+			}
+			return nil
+		})},
+	})
+}
+
+func testPrerequisites(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	tests := []UnitTest{
+		// Capstone requires Advanced, which requires Intro.
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Intro"}`, Status: http.StatusCreated, ResponseFn: saveID("intro")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Advanced"}`, Status: http.StatusCreated, ResponseFn: saveID("advanced")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Capstone"}`, Status: http.StatusCreated, ResponseFn: saveID("capstone")},
+		{Method: "POST", Url: "/api/course/{advanced}/prerequisites", Body: `{"course_id": {intro}}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{capstone}/prerequisites", Body: `{"course_id": {advanced}}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{capstone}/prerequisites", Body: `{"course_id": {advanced}}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeConflict)},
+		{Method: "POST", Url: "/api/course/{intro}/prerequisites", Body: `{"course_id": {capstone}}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodePrerequisiteCycle)},
+		{Method: "POST", Url: "/api/course/{intro}/prerequisites", Body: `{"course_id": {intro}}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodePrerequisiteCycle)},
+		{Method: "POST", Url: "/api/course/{intro}/prerequisites", Body: `{"course_id": 999}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "GET", Url: "/api/course/{capstone}/prerequisites", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Equal(tctx.T, []string{"Intro", "Advanced"}, []string{courses[0].Name, courses[1].Name})
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{capstone}/prerequisites?direct=true", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			require.Equal(tctx.T, "Advanced", courses[0].Name)
+			return nil
+		})},
+
+		// Students must have taken the whole closure; professors need not.
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Pre", "last_name": "Req", "type": "student", "age": 19, "courses": [{capstone}]}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblemFn(internal.CodeMissingPrerequisites, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Missing, 1)
+			require.Len(tctx.T, problem.Missing[0].PrerequisiteIDs, 2)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Pre", "last_name": "Req", "type": "student", "age": 19, "courses": [{intro}]}`, Status: http.StatusCreated, ResponseFn: saveID("prereq_student")},
+		{Method: "POST", Url: "/api/person/{prereq_student}/courses", Body: `{"course_id": {capstone}}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblemFn(internal.CodeMissingPrerequisites, func(tctx TestContext, problem internal.Problem) error {
+			// Taking Intro is not completing it.
+			require.Equal(tctx.T, []string{tctx.Vars["intro"], tctx.Vars["advanced"]}, []string{fmt.Sprint(problem.Missing[0].PrerequisiteIDs[0]), fmt.Sprint(problem.Missing[0].PrerequisiteIDs[1])})
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course/{capstone}/persons", Body: `{"person_id": 1}`, Status: http.StatusCreated},
+		{Method: "PATCH", Url: "/api/person/{prereq_student}", ContentType: "application/merge-patch+json", Body: `{"courses": [{intro}, {capstone}]}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeMissingPrerequisites)},
+
+		// Courses enrolled in by the same request do not count as taken.
+		{Method: "PUT", Url: "/api/person/{prereq_student}/courses", Body: `{"course_ids": [{intro}, {advanced}, {capstone}]}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblemFn(internal.CodeMissingPrerequisites, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Missing, 2)
+			return nil
+		})},
+
+		// Passing Intro completes it, and failing does not.
+		{Method: "GET", Url: "/api/person/{prereq_student}/enrollments", Status: http.StatusOK, ResponseFn: handleEnrollmentsFn(func(tctx TestContext, enrollments []internal.PersonCourse) error {
+			require.Len(tctx.T, enrollments, 1)
+			tctx.Vars["intro_offering"] = fmt.Sprint(enrollments[0].OfferingID)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/offering/{intro_offering}/persons/{prereq_student}/grade", Headers: admin, Body: `{"grade": "F"}`, Status: http.StatusCreated},
+		{Method: "PUT", Url: "/api/person/{prereq_student}/courses", Body: `{"course_ids": [{intro}, {advanced}]}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeMissingPrerequisites)},
+		{Method: "PUT", Url: "/api/offering/{intro_offering}/persons/{prereq_student}/grade", Headers: admin, Body: `{"grade": "C", "reason": "Regraded."}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/person/{prereq_student}/courses", Body: `{"course_ids": [{intro}, {advanced}]}`, Status: http.StatusAccepted, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 2)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person/{prereq_student}/courses", Body: `{"course_id": {capstone}}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeMissingPrerequisites)},
+
+		// Admins may skip the check.
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Skip", "last_name": "Req", "type": "student", "age": 19}`, Status: http.StatusCreated, ResponseFn: saveID("skip_student")},
+		{Method: "POST", Url: "/api/course/{capstone}/persons?override_prerequisites=true", Body: `{"person_id": {skip_student}}`, Status: http.StatusUnauthorized},
+		{Method: "POST", Url: "/api/course/{capstone}/persons?override_prerequisites=maybe", Body: `{"person_id": {skip_student}}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+		{Method: "POST", Url: "/api/course/{capstone}/persons?override_prerequisites=true", Headers: admin, Body: `{"person_id": {skip_student}}`, Status: http.StatusCreated},
+
+		{Method: "DELETE", Url: "/api/course/{advanced}/prerequisites/{intro}", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/course/{advanced}/prerequisites/{intro}", Status: http.StatusNotFound},
+		{Method: "GET", Url: "/api/audit?entity=course&id={advanced}&sort=-id&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditPrerequisites, entries[0].Operation)
+			require.Empty(tctx.T, entries[0].Diff.After["prerequisites"])
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func handleEnrollmentsFn(fn func(TestContext, []internal.PersonCourse) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var enrollments []internal.PersonCourse
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &enrollments))
+		return fn(tctx, enrollments)
+	}
+}
+
+func testRoles(tctx TestContext) {
+	merge := internal.MergePatchContentType
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Workshop", "capacity": 1}`, Status: http.StatusCreated, ResponseFn: saveID("workshop")},
+
+		// Professors instruct and students attend unless a role is given.
+		{Method: "POST", Url: "/api/course/{workshop}/persons", Body: `{"person_id": 2}`, Status: http.StatusCreated, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var enrollment internal.PersonCourse
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &enrollment))
+			require.Equal(tctx.T, internal.RoleInstructor, enrollment.Role)
+			require.False(tctx.T, enrollment.EnrolledAt.IsZero())
+			return nil
+		}},
+		{Method: "POST", Url: "/api/course/{workshop}/persons", Body: `{"person_id": 3, "role": "instructor"}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeNotProfessor)},
+		{Method: "POST", Url: "/api/course/{workshop}/persons", Body: `{"person_id": 3, "role": "dean"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "role", problem.Errors[0].Field)
+			return nil
+		})},
+
+		// TAs take no seat, and a professor can attend as a student.
+		{Method: "POST", Url: "/api/person/3/courses", Body: `{"course_id": {workshop}, "role": "ta"}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{workshop}/persons", Body: `{"person_id": 1, "role": "student"}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/course/{workshop}/persons", Body: `{"person_id": 4}`, Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/course/{workshop}", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Len(tctx.T, course.Instructors, 1)
+			require.Equal(tctx.T, "Bezos", course.Instructors[0].LastName)
+			require.Equal(tctx.T, 1, course.StudentCount)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{workshop}", Status: http.StatusOK, ResponseFn: saveETag("workshop_etag")},
+		{Method: "GET", Url: "/api/course/{workshop}/enrollments?role=ta", Status: http.StatusOK, ResponseFn: handleEnrollmentsFn(func(tctx TestContext, enrollments []internal.PersonCourse) error {
+			require.Len(tctx.T, enrollments, 1)
+			require.Equal(tctx.T, 3, enrollments[0].PersonID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{workshop}/enrollments?role=dean", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+
+		// Replacing the roster keeps the roles of those who stay.
+		{Method: "PUT", Url: "/api/course/{workshop}/persons", Body: `{"person_ids": [1, 2, 3]}`, Status: http.StatusAccepted},
+		{Method: "GET", Url: "/api/course/{workshop}/enrollments", Status: http.StatusOK, ResponseFn: handleEnrollmentsFn(func(tctx TestContext, enrollments []internal.PersonCourse) error {
+			roles := map[int]string{}
+			for _, enrollment := range enrollments {
+				roles[enrollment.PersonID] = enrollment.Role
+			}
+			require.Equal(tctx.T, map[int]string{1: internal.RoleStudent, 2: internal.RoleInstructor, 3: internal.RoleTA}, roles)
+			return nil
+		})},
+
+		// Bill Gates is promoted into the freed seat, so the course reads the
+		// same until the seat is empty.
+		{Method: "DELETE", Url: "/api/course/{workshop}/persons/1", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course/{workshop}/enrollments?role=student", Status: http.StatusOK, ResponseFn: handleEnrollmentsFn(func(tctx TestContext, enrollments []internal.PersonCourse) error {
+			require.Len(tctx.T, enrollments, 1)
+			require.Equal(tctx.T, 4, enrollments[0].PersonID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course/{workshop}", Headers: map[string]string{"If-None-Match": "{workshop_etag}"}, Status: http.StatusNotModified},
+		{Method: "DELETE", Url: "/api/course/{workshop}/persons/4", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/course/{workshop}", Headers: map[string]string{"If-None-Match": "{workshop_etag}"}, Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, 0, course.StudentCount)
+			return nil
+		})},
+
+		// A person who instructs must stay a professor.
+		{Method: "PATCH", Url: "/api/person/2", ContentType: merge, Body: `{"type": "student"}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeNotProfessor)},
+		{Method: "GET", Url: "/api/person/2/enrollments?role=instructor", Status: http.StatusOK, ResponseFn: handleEnrollmentsFn(func(tctx TestContext, enrollments []internal.PersonCourse) error {
+			require.NotEmpty(tctx.T, enrollments)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func handleTranscriptFn(fn func(TestContext, internal.Transcript) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var transcript internal.Transcript
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &transcript))
+		return fn(tctx, transcript)
+	}
+}
+
+func saveAccessToken(key string) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var output map[string]any
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &output))
+		require.NotEmpty(tctx.T, output["token"])
+		tctx.Vars[key] = output["token"].(string)
+		return nil
+	}
+}
+
+func testGrades(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+	instructor := map[string]string{"Authorization": "Bearer {instructor_token}"}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Compilers", "credit_hours": 4}`, Status: http.StatusCreated, ResponseFn: saveID("compilers")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Ethics", "credit_hours": 2}`, Status: http.StatusCreated, ResponseFn: saveID("ethics")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Astrophysics", "credit_hours": 21}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "credit_hours", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2024", "start_date": "2024-01-08", "end_date": "2024-05-03"}`, Status: http.StatusCreated, ResponseFn: saveID("past_term")},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2099", "start_date": "2099-01-12", "end_date": "2099-05-08"}`, Status: http.StatusCreated, ResponseFn: saveID("future_term")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {compilers}, "term_id": {past_term}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("past")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {ethics}, "term_id": {future_term}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("future")},
+		{Method: "POST", Url: "/api/offering/{past}/persons", Body: `{"person_id": 2}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{past}/persons", Body: `{"person_id": 5}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{future}/persons", Body: `{"person_id": 5}`, Status: http.StatusCreated},
+
+		// Persons authenticate with the access token an admin issues them.
+		{Method: "POST", Url: "/api/person/2/access-token", Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "POST", Url: "/api/person/2/access-token", Headers: admin, Status: http.StatusCreated, ResponseFn: saveAccessToken("instructor_token")},
+		{Method: "POST", Url: "/api/person/1/access-token", Headers: admin, Status: http.StatusCreated, ResponseFn: saveAccessToken("other_token")},
+		{Method: "POST", Url: "/api/person/1/access-token", Headers: admin, Status: http.StatusCreated, ResponseFn: saveAccessToken("new_other_token")},
+
+		// Only instructors of the offering and admins grade, and only students.
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Body: `{"grade": "A"}`, Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: map[string]string{"Authorization": "Bearer wrong"}, Body: `{"grade": "A"}`, Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: map[string]string{"Authorization": "Bearer {other_token}"}, Body: `{"grade": "A"}`, Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: map[string]string{"Authorization": "Bearer {new_other_token}"}, Body: `{"grade": "A"}`, Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: instructor, Body: `{"grade": "A", "instructor_id": 2}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidBody)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: instructor, Body: `{"grade": "E"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "grade", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/3/grade", Headers: instructor, Body: `{"grade": "A"}`, Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotEnrolled)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/2/grade", Headers: instructor, Body: `{"grade": "A"}`, Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotEnrolled)},
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: instructor, Body: `{"grade": "A"}`, Status: http.StatusCreated, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var enrollment internal.PersonCourse
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &enrollment))
+			require.Equal(tctx.T, "A", *enrollment.Grade)
+			require.Equal(tctx.T, 4.0, *enrollment.GradePoints)
+			return nil
+		}},
+
+		// The term has ended, so amending the grade takes a reason.
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: instructor, Body: `{"grade": "B"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "reason", problem.Errors[0].Field)
+			return nil
+		})},
+		// The audit log names the instructor, not whoever X-Actor claims.
+		{Method: "PUT", Url: "/api/offering/{past}/persons/5/grade", Headers: map[string]string{"Authorization": "Bearer {instructor_token}", "X-Actor": "registrar"}, Body: `{"grade": "B", "reason": "Late penalty missed."}`, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/audit?entity=person&id=5&sort=-id&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditGrade, entries[0].Operation)
+			require.Equal(tctx.T, "person:2", entries[0].Actor)
+			require.Equal(tctx.T, "Late penalty missed.", entries[0].Reason)
+			require.Equal(tctx.T, tctx.Vars["past"], fmt.Sprint(entries[0].Diff.Before["offering_id"]))
+			require.Equal(tctx.T, "A", entries[0].Diff.Before["grade"])
+			require.Equal(tctx.T, "B", entries[0].Diff.After["grade"])
+			return nil
+		})},
+
+		// Admins grade any offering, and open terms need no reason.
+		{Method: "PUT", Url: "/api/offering/{future}/persons/5/grade", Headers: admin, Body: `{"grade": "P"}`, Status: http.StatusCreated},
+		{Method: "PUT", Url: "/api/offering/{future}/persons/5/grade", Headers: admin, Body: `{"grade": "A"}`, Status: http.StatusOK},
+
+		// Transcripts group the courses by term, weighing grades by credit hours.
+		{Method: "GET", Url: "/api/person/5/transcript", Status: http.StatusOK, ResponseFn: handleTranscriptFn(func(tctx TestContext, transcript internal.Transcript) error {
+			require.Len(tctx.T, transcript.Terms, 3)
+			first, last := transcript.Terms[0], transcript.Terms[2]
+			require.Equal(tctx.T, "Spring 2024", first.Name)
+			require.Equal(tctx.T, 4, first.CreditHours)
+			require.Equal(tctx.T, 3.0, *first.GPA)
+			require.Nil(tctx.T, transcript.Terms[1].GPA)
+			require.Equal(tctx.T, 3.0, *transcript.Terms[1].CumulativeGPA)
+			require.Equal(tctx.T, "Spring 2099", last.Name)
+			require.Equal(tctx.T, 4.0, *last.GPA)
+			require.Equal(tctx.T, 3.33, *last.CumulativeGPA)
+			require.Equal(tctx.T, 3.33, *transcript.GPA)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/2/transcript", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testMeetings(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Fall 2030", "start_date": "2030-08-26", "end_date": "2030-12-13"}`, Status: http.StatusCreated, ResponseFn: saveID("fall_2030")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Algorithms"}`, Status: http.StatusCreated, ResponseFn: saveID("algorithms")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Networks"}`, Status: http.StatusCreated, ResponseFn: saveID("networks")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Statistics"}`, Status: http.StatusCreated, ResponseFn: saveID("statistics")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {algorithms}, "term_id": {fall_2030}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("alg")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {networks}, "term_id": {fall_2030}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("net")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {statistics}, "term_id": {fall_2030}, "section": "001"}`, Status: http.StatusCreated, ResponseFn: saveID("stats")},
+
+		{Method: "PUT", Url: "/api/offering/{alg}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "09:00", "end_time": "10:15", "room": "B-101"}, {"day": "mon", "start_time": "09:00", "end_time": "10:15", "room": "B-101"}]}`, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var meetings []internal.Meeting
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &meetings))
+			require.Len(tctx.T, meetings, 2)
+			require.Equal(tctx.T, "mon", meetings[0].Day)
+			require.Contains(tctx.T, res.Body.String(), `"start_time":"09:00"`)
+			return nil
+		}},
+		{Method: "PUT", Url: "/api/offering/{net}/meetings", Body: `{"meetings": [{"day": "funday", "start_time": "11:00", "end_time": "10:00"}]}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 2)
+			require.Equal(tctx.T, "meetings[0].day", problem.Errors[0].Field)
+			require.Equal(tctx.T, "meetings[0].end_time", problem.Errors[1].Field)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/offering/{net}/meetings", Body: `{"meetings": [{"day": "mon", "start_time": "25:00", "end_time": "26:00"}]}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidBody)},
+
+		// A room holds one meeting at a time; back-to-back meetings are fine.
+		{Method: "PUT", Url: "/api/offering/{net}/meetings", Body: `{"meetings": [{"day": "mon", "start_time": "10:00", "end_time": "11:00", "room": "B-101"}]}`, Status: http.StatusConflict, ResponseFn: handleProblemFn(internal.CodeRoomConflict, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "Algorithms", problem.Conflict.CourseName)
+			require.Contains(tctx.T, problem.Detail, "Algorithms")
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/offering/{net}/meetings", Body: `{"meetings": [{"day": "tue", "start_time": "10:00", "end_time": "11:00", "room": "C-201"}, {"day": "tue", "start_time": "10:30", "end_time": "11:30", "room": "C-201"}]}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeRoomConflict)},
+		{Method: "PUT", Url: "/api/offering/{net}/meetings", Body: `{"meetings": [{"day": "mon", "start_time": "10:15", "end_time": "11:30", "room": "B-101"}]}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/offering/{stats}/meetings", Body: `{"meetings": [{"day": "mon", "start_time": "09:30", "end_time": "10:30", "room": "C-201"}]}`, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/audit?entity=offering&id={stats}&sort=-id&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Equal(tctx.T, internal.AuditUpdate, entries[0].Operation)
+			require.Contains(tctx.T, entries[0].Diff.After, "meetings")
+			return nil
+		})},
+
+		// Students and instructors cannot be in two places at once.
+		{Method: "POST", Url: "/api/offering/{alg}/persons", Body: `{"person_id": 4}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{stats}/persons", Body: `{"person_id": 4}`, Status: http.StatusConflict, ResponseFn: handleProblemFn(internal.CodeScheduleConflict, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "Algorithms", problem.Conflict.CourseName)
+			require.Equal(tctx.T, "mon", problem.Conflict.Meeting.Day)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/offering/{net}/persons", Body: `{"person_id": 4}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{stats}/persons", Body: `{"person_id": 1}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{alg}/persons", Body: `{"person_id": 1}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeScheduleConflict)},
+		{Method: "GET", Url: "/api/person/4/schedule?term_id={fall_2030}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var schedule []internal.ScheduleEntry
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &schedule))
+			require.Len(tctx.T, schedule, 3)
+			require.Equal(tctx.T, []string{"Algorithms", "Networks", "Algorithms"}, []string{schedule[0].CourseName, schedule[1].CourseName, schedule[2].CourseName})
+			require.Equal(tctx.T, "wed", schedule[2].Day)
+			require.Equal(tctx.T, internal.RoleStudent, schedule[0].Role)
+			return nil
+		}},
+		{Method: "GET", Url: "/api/person/4/schedule?term_id=x", Status: http.StatusBadRequest},
+
+		// Once Statistics moves, Bill Gates can take it.
+		{Method: "PUT", Url: "/api/offering/{stats}/meetings", Body: `{"meetings": [{"day": "tue", "start_time": "09:30", "end_time": "10:30", "room": "C-201"}]}`, Status: http.StatusOK},
+		{Method: "POST", Url: "/api/offering/{stats}/persons", Body: `{"person_id": 4}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/offering/{stats}/meetings", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), `"day":"tue"`)
+			return nil
+		}},
+
+		// Every way of enrolling checks schedules, including against courses
+		// added by the same request.
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Robotics"}`, Status: http.StatusCreated, ResponseFn: saveID("robotics")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Vision"}`, Status: http.StatusCreated, ResponseFn: saveID("vision")},
+		{Method: "GET", Url: "/api/offering?course_id={robotics}", Status: http.StatusOK, ResponseFn: saveFirstID("robo")},
+		{Method: "GET", Url: "/api/offering?course_id={vision}", Status: http.StatusOK, ResponseFn: saveFirstID("vis")},
+		{Method: "PUT", Url: "/api/offering/{robo}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "10:00", "end_time": "11:00"}]}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/offering/{vis}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "10:30", "end_time": "11:30"}]}`, Status: http.StatusOK},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Double", "last_name": "Booked", "type": "student", "age": 20, "courses": [{robotics}, {vision}]}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeScheduleConflict)},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Double", "last_name": "Booked", "type": "student", "age": 20, "courses": [{robotics}]}`, Status: http.StatusCreated, ResponseFn: saveID("double")},
+		{Method: "PUT", Url: "/api/person/{double}", Body: `{"first_name": "Double", "last_name": "Booked", "type": "student", "age": 20, "courses": [{robotics}, {vision}]}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeScheduleConflict)},
+		{Method: "PUT", Url: "/api/person/{double}/courses", Body: `{"course_ids": [{robotics}, {vision}]}`, Status: http.StatusConflict, ResponseFn: handleProblemFn(internal.CodeScheduleConflict, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "Robotics", problem.Conflict.CourseName)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/course/{vision}/persons", Body: `{"person_ids": [{double}]}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeScheduleConflict)},
+		{Method: "GET", Url: "/api/person/{double}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			return nil
+		})},
+
+		// So does moving the meetings or the term of an offering with
+		// enrollments.
+		{Method: "PUT", Url: "/api/offering/{vis}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "11:00", "end_time": "12:00"}]}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/person/{double}/courses", Body: `{"course_ids": [{robotics}, {vision}]}`, Status: http.StatusAccepted},
+		{Method: "PUT", Url: "/api/offering/{vis}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "10:30", "end_time": "11:30"}]}`, Status: http.StatusConflict, ResponseFn: handleProblemFn(internal.CodeScheduleConflict, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "Robotics", problem.Conflict.CourseName)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/term", Body: `{"name": "Spring 2031", "start_date": "2031-01-13", "end_date": "2031-05-09"}`, Status: http.StatusCreated, ResponseFn: saveID("spring_2031")},
+		{Method: "POST", Url: "/api/offering", Body: `{"course_id": {networks}, "term_id": {spring_2031}, "section": "002"}`, Status: http.StatusCreated, ResponseFn: saveID("net_spring")},
+		{Method: "PUT", Url: "/api/offering/{net_spring}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "09:00", "end_time": "10:00", "room": "B-101"}]}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/offering/{net_spring}", Body: `{"course_id": {networks}, "term_id": {fall_2030}, "section": "002"}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeRoomConflict)},
+		{Method: "PUT", Url: "/api/offering/{net_spring}/meetings", Body: `{"meetings": [{"day": "wed", "start_time": "09:00", "end_time": "10:00"}]}`, Status: http.StatusOK},
+		{Method: "POST", Url: "/api/offering/{net_spring}/persons", Body: `{"person_id": 4}`, Status: http.StatusCreated},
+		{Method: "PUT", Url: "/api/offering/{net_spring}", Body: `{"course_id": {networks}, "term_id": {fall_2030}, "section": "002"}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeScheduleConflict)},
+		{Method: "GET", Url: "/api/offering/{net_spring}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Contains(tctx.T, res.Body.String(), `"term_id":`+tctx.Vars["spring_2031"])
+			return nil
+		}},
+		{Method: "DELETE", Url: "/api/offering/{net_spring}/persons/4", Status: http.StatusOK},
+
+		// A seat that frees up passes over waitlisted students it would
+		// double-book, who keep their place with the reason.
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Ethics", "capacity": 1}`, Status: http.StatusCreated, ResponseFn: saveID("ethics")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Logic"}`, Status: http.StatusCreated, ResponseFn: saveID("logic")},
+		{Method: "GET", Url: "/api/offering?course_id={ethics}", Status: http.StatusOK, ResponseFn: saveFirstID("eth")},
+		{Method: "GET", Url: "/api/offering?course_id={logic}", Status: http.StatusOK, ResponseFn: saveFirstID("log")},
+		{Method: "PUT", Url: "/api/offering/{eth}/meetings", Body: `{"meetings": [{"day": "thu", "start_time": "14:00", "end_time": "15:00"}]}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/offering/{log}/meetings", Body: `{"meetings": [{"day": "thu", "start_time": "14:30", "end_time": "15:30"}]}`, Status: http.StatusOK},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Fay", "last_name": "Held", "type": "student", "age": 20}`, Status: http.StatusCreated, ResponseFn: saveID("fay")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Gus", "last_name": "Held", "type": "student", "age": 20}`, Status: http.StatusCreated, ResponseFn: saveID("gus")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Hal", "last_name": "Held", "type": "student", "age": 20}`, Status: http.StatusCreated, ResponseFn: saveID("hal")},
+		{Method: "POST", Url: "/api/offering/{eth}/persons", Body: `{"person_id": {fay}}`, Status: http.StatusCreated},
+		{Method: "POST", Url: "/api/offering/{eth}/persons", Body: `{"person_id": {gus}}`, Status: http.StatusAccepted},
+		{Method: "POST", Url: "/api/offering/{eth}/persons", Body: `{"person_id": {hal}}`, Status: http.StatusAccepted},
+		{Method: "POST", Url: "/api/offering/{log}/persons", Body: `{"person_id": {gus}}`, Status: http.StatusCreated},
+		{Method: "DELETE", Url: "/api/offering/{eth}/persons/{fay}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/offering/{eth}/waitlist", Status: http.StatusOK, ResponseFn: handleWaitlistFn(func(tctx TestContext, entries []internal.WaitlistEntry) error {
+			require.Len(tctx.T, entries, 1)
+			require.Equal(tctx.T, tctx.Vars["gus"], fmt.Sprint(entries[0].PersonID))
+			require.Equal(tctx.T, 1, entries[0].Position)
+			require.NotNil(tctx.T, entries[0].HoldReason)
+			require.Contains(tctx.T, *entries[0].HoldReason, "thu 14:00-15:00")
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{hal}/courses", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			require.Equal(tctx.T, "Ethics", courses[0].Name)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func saveToken(key string) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var output map[string]any
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &output))
+		require.NotEmpty(tctx.T, output["token"])
+		require.Contains(tctx.T, output["url"], "/schedule.ics?token=")
+		tctx.Vars[key] = output["token"].(string)
+		return nil
+	}
+}
+
+func testCalendar(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	tests := []UnitTest{
+		{Method: "PUT", Url: "/api/term/{fall_2030}/holidays", Body: `{"holidays": [{"date": "2030-07-04"}, {"date": "2030-11-27"}, {"date": "2030-11-27"}]}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 2)
+			require.Equal(tctx.T, "holidays[0].date", problem.Errors[0].Field)
+			require.Equal(tctx.T, "holidays[2].date", problem.Errors[1].Field)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/term/{fall_2030}/holidays", Body: `{"holidays": [{"date": "2030-11-28", "name": "Thanksgiving"}, {"date": "2030-11-27", "name": "Thanksgiving eve"}]}`, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/term/{fall_2030}/holidays", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.JSONEq(tctx.T, `[{"date": "2030-11-27", "name": "Thanksgiving eve"}, {"date": "2030-11-28", "name": "Thanksgiving"}]`, res.Body.String())
+			return nil
+		}},
+
+		// Feeds are read with the token of the person or as an admin.
+		{Method: "GET", Url: "/api/person/4/schedule.ics", Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "GET", Url: "/api/person/4/schedule.ics?token=guess", Status: http.StatusForbidden, ResponseFn: handleProblem(internal.CodeForbidden)},
+		{Method: "POST", Url: "/api/person/4/calendar-token", Status: http.StatusUnauthorized},
+		{Method: "POST", Url: "/api/person/4/calendar-token", Headers: admin, Status: http.StatusCreated, ResponseFn: saveToken("old_token")},
+		{Method: "POST", Url: "/api/person/4/calendar-token", Headers: admin, Status: http.StatusCreated, ResponseFn: saveToken("calendar_token")},
+		{Method: "GET", Url: "/api/person/4/schedule.ics?token={old_token}", Status: http.StatusForbidden},
+		{Method: "GET", Url: "/api/person/3/schedule.ics?token={calendar_token}", Status: http.StatusForbidden},
+		{Method: "GET", Url: "/api/person/4/schedule.ics?token={calendar_token}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, internal.CalendarContentType, res.Header().Get("Content-Type"))
+			body := res.Body.String()
+			require.True(tctx.T, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+			require.True(tctx.T, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+			require.Equal(tctx.T, 4, strings.Count(body, "BEGIN:VEVENT"))
+			require.Contains(tctx.T, body, "DTSTART:20300826T090000\r\nDTEND:20300826T101500\r\nRRULE:FREQ=WEEKLY;UNTIL=20301213T235959\r\n")
+			require.Contains(tctx.T, body, "DTSTART:20300828T090000")
+			require.Contains(tctx.T, body, "EXDATE:20301127T090000\r\n")
+			require.Equal(tctx.T, 1, strings.Count(body, "EXDATE"))
+			require.Contains(tctx.T, body, "SUMMARY:Algorithms (001)\r\nLOCATION:B-101\r\n")
+			return nil
+		}},
+		{Method: "GET", Url: "/api/person/4/schedule.ics?token={calendar_token}", Status: http.StatusOK, ResponseFn: saveETag("calendar_etag")},
+		{Method: "GET", Url: "/api/person/4/schedule.ics?token={calendar_token}", Headers: map[string]string{"If-None-Match": "{calendar_etag}"}, Status: http.StatusNotModified},
+		{Method: "GET", Url: "/api/person/4/schedule.ics", Headers: admin, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/audit?entity=person&id=4&sort=-id&limit=1", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Contains(tctx.T, entries[0].Diff.After, "calendar_token_created_at")
+			require.NotContains(tctx.T, fmt.Sprint(entries[0].Diff), tctx.Vars["calendar_token"])
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testDepartments(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+	merge := internal.MergePatchContentType
+
+	tests := []UnitTest{
+		{Method: "GET", Url: "/api/department", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.JSONEq(tctx.T, `[{"id": 1, "code": "CS", "name": "Computer Science", "chair_id": 1}]`, res.Body.String())
+			return nil
+		}},
+		{Method: "POST", Url: "/api/department", Body: `{"code": "math", "name": "Mathematics", "chair_id": 3}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 2)
+			require.Equal(tctx.T, "code", problem.Errors[0].Field)
+			require.Equal(tctx.T, "chair_id", problem.Errors[1].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/department", Body: `{"code": "MATH", "name": "Mathematics", "chair_id": 2}`, Status: http.StatusCreated, ResponseFn: saveID("math_id")},
+		{Method: "POST", Url: "/api/department", Body: `{"code": "MATH", "name": "Applied Mathematics"}`, Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeConflict)},
+		{Method: "GET", Url: "/api/department/999", Status: http.StatusNotFound},
+
+		{Method: "POST", Url: "/api/program", Body: `{"code": "MATH-BS", "name": "Mathematics", "degree": "BS", "department_id": 999}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "POST", Url: "/api/program", Body: `{"code": "MATH-BS", "name": "Mathematics", "degree": "BS", "department_id": {math_id}}`, Status: http.StatusCreated, ResponseFn: saveID("math_bs_id")},
+		{Method: "GET", Url: "/api/program?department_id={math_id}", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.JSONEq(tctx.T, `[{"id": `+tctx.Vars["math_bs_id"]+`, "code": "MATH-BS", "name": "Mathematics", "degree": "BS", "department_id": `+tctx.Vars["math_id"]+`}]`, res.Body.String())
+			return nil
+		}},
+		{Method: "GET", Url: "/api/program?department=MATH", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeUnknownParameter)},
+
+		// Courses are numbered within their department.
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Calculus", "department_id": {math_id}, "number": "101"}`, Status: http.StatusCreated, ResponseFn: saveID("calculus_id")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Calculus Again", "department_id": {math_id}, "number": "101"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "number", problem.Errors[0].Field)
+			require.Equal(tctx.T, "unique", problem.Errors[0].Code)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Unnumbered", "number": "102"}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Nowhere", "department_id": 999}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "GET", Url: "/api/course/{calculus_id}", Status: http.StatusOK, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, "MATH 101", course.Code)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/course/{calculus_id}", ContentType: merge, Body: `{"number": "110"}`, Status: http.StatusAccepted, ResponseFn: handleCourseFn(func(tctx TestContext, course internal.Course) error {
+			require.Equal(tctx.T, "MATH 110", course.Code)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course?department=math", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.Len(tctx.T, courses, 1)
+			require.Equal(tctx.T, "Calculus", courses[0].Name)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course?department=CS", Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.NotEmpty(tctx.T, courses)
+			for _, course := range courses {
+				require.True(tctx.T, strings.HasPrefix(course.Code, "CS "), course.Code)
+			}
+			return nil
+		})},
+
+		// Professors have a home department and students a major.
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Ada", "last_name": "Lovelace", "type": "student", "age": 36, "courses": [], "department_id": {math_id}}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "department_id", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Ada", "last_name": "Lovelace", "type": "student", "age": 36, "courses": [], "major_id": {math_bs_id}}`, Status: http.StatusCreated, ResponseFn: saveID("ada_id")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Emmy", "last_name": "Noether", "type": "professor", "age": 53, "courses": [], "department_id": {math_id}}`, Status: http.StatusCreated, ResponseFn: saveID("emmy_id")},
+		{Method: "GET", Url: "/api/person?department=MATH", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 2)
+			require.Equal(tctx.T, "Ada", persons[0].FirstName)
+			require.Equal(tctx.T, "Emmy", persons[1].FirstName)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?department=MATH&type=professor", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.Equal(tctx.T, "Noether", persons[0].LastName)
+			return nil
+		})},
+
+		// A chair must stay a professor.
+		{Method: "PUT", Url: "/api/department/{math_id}", Body: `{"code": "MATH", "name": "Mathematics", "chair_id": {emmy_id}}`, Status: http.StatusAccepted},
+		{Method: "PATCH", Url: "/api/person/{emmy_id}", ContentType: merge, Body: `{"type": "student"}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblemFn(internal.CodeNotProfessor, func(tctx TestContext, problem internal.Problem) error {
+			require.Contains(tctx.T, problem.Detail, "chairs department 'MATH'")
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{ada_id}", ContentType: merge, Body: `{"type": "professor"}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, "major_id", problem.Errors[0].Field)
+			return nil
+		})},
+
+		// Departments and programs cannot be deleted while in use.
+		{Method: "DELETE", Url: "/api/program/{math_bs_id}", Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeConflict)},
+		{Method: "DELETE", Url: "/api/department/{math_id}", Status: http.StatusConflict, ResponseFn: handleProblem(internal.CodeConflict)},
+		{Method: "PATCH", Url: "/api/person/{ada_id}", ContentType: merge, Body: `{"major_id": null}`, Status: http.StatusAccepted},
+		{Method: "DELETE", Url: "/api/program/{math_bs_id}", Status: http.StatusOK},
+		{Method: "GET", Url: "/api/audit?entity=department&id={math_id}", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.Len(tctx.T, entries, 2)
+			require.Equal(tctx.T, internal.AuditCreate, entries[0].Operation)
+			require.Equal(tctx.T, map[string]any{"chair_id": float64(2)}, entries[1].Diff.Before)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func saveFirstID(key string) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var output []map[string]any
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &output))
+		require.NotEmpty(tctx.T, output)
+		tctx.Vars[key] = fmt.Sprint(output[0]["id"])
+		return nil
+	}
+}
+
+func handleDegreeAuditFn(fn func(TestContext, internal.DegreeAudit) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var audit internal.DegreeAudit
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &audit))
+		return fn(tctx, audit)
+	}
+}
+
+// requirementStatuses maps the names of the requirements of an audit to their
+// status.
+func requirementStatuses(audit internal.DegreeAudit) map[string]string {
+	statuses := map[string]string{}
+	for _, result := range append(audit.Satisfied, audit.Unsatisfied...) {
+		statuses[result.Name] = result.Status
+	}
+	return statuses
+}
+
+func testDegreeAudit(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/program", Body: `{"code": "MATH-BA", "name": "Mathematics", "degree": "BA", "department_id": {math_id}}`, Status: http.StatusCreated, ResponseFn: saveID("math_ba_id")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Real Analysis", "department_id": {math_id}, "number": "301", "credit_hours": 3}`, Status: http.StatusCreated, ResponseFn: saveID("analysis_id")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Linear Algebra", "department_id": {math_id}, "number": "221", "credit_hours": 3}`, Status: http.StatusCreated, ResponseFn: saveID("algebra_id")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Topology", "department_id": {math_id}, "number": "411", "credit_hours": 3}`, Status: http.StatusCreated, ResponseFn: saveID("topology_id")},
+		{Method: "GET", Url: "/api/offering?course_id={analysis_id}", Status: http.StatusOK, ResponseFn: saveFirstID("analysis_offering")},
+		{Method: "GET", Url: "/api/offering?course_id={algebra_id}", Status: http.StatusOK, ResponseFn: saveFirstID("algebra_offering")},
+		{Method: "GET", Url: "/api/offering?course_id={topology_id}", Status: http.StatusOK, ResponseFn: saveFirstID("topology_offering")},
+
+		{Method: "PUT", Url: "/api/program/{math_ba_id}/requirements", Body: `{"requirements": [
+			{"kind": "electives", "course_ids": [{topology_id}], "choose": 2},
+			{"kind": "credits"},
+			{"kind": "gpa", "min_gpa": 5},
+			{"kind": "courses", "course_ids": [999, 999]},
+			{"kind": "minor"}
+		]}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			fields := []string{}
+			for _, err := range problem.Errors {
+				fields = append(fields, err.Field)
+			}
+			require.Equal(tctx.T, []string{
+				"requirements[0].choose", "requirements[1].min_credits", "requirements[2].min_gpa",
+				"requirements[3].course_ids", "requirements[3].course_ids", "requirements[4].kind",
+			}, fields)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/program/{math_ba_id}/requirements", Body: `{"requirements": [
+			{"kind": "courses", "name": "Core", "course_ids": [{algebra_id}, {analysis_id}]},
+			{"kind": "electives", "name": "Elective", "course_ids": [{topology_id}, {calculus_id}], "choose": 1},
+			{"kind": "credits", "name": "Credits", "min_credits": 3},
+			{"kind": "gpa", "name": "GPA", "min_gpa": 3}
+		]}`, Status: http.StatusOK},
+		{Method: "GET", Url: "/api/program/{math_ba_id}/requirements", Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			var requirements []internal.Requirement
+			require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &requirements))
+			require.Len(tctx.T, requirements, 4)
+			require.Equal(tctx.T, "Core", requirements[0].Name)
+			require.Len(tctx.T, requirements[1].CourseIDs, 2)
+			return nil
+		}},
+
+		// Only students with a major are audited.
+		{Method: "GET", Url: "/api/person/1/degree-audit", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Sofia", "last_name": "Kovalevskaya", "type": "student", "age": 24, "courses": [{analysis_id}, {algebra_id}, {topology_id}]}`, Status: http.StatusCreated, ResponseFn: saveID("sofia_id")},
+		{Method: "GET", Url: "/api/person/{sofia_id}/degree-audit", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "PATCH", Url: "/api/person/{sofia_id}", ContentType: internal.MergePatchContentType, Body: `{"major_id": {math_ba_id}}`, Status: http.StatusAccepted},
+
+		// Real Analysis is completed, Linear Algebra failed and Topology in
+		// progress.
+		{Method: "PUT", Url: "/api/offering/{analysis_offering}/persons/{sofia_id}/grade", Headers: admin, Body: `{"grade": "A"}`, Status: http.StatusCreated},
+		{Method: "PUT", Url: "/api/offering/{algebra_offering}/persons/{sofia_id}/grade", Headers: admin, Body: `{"grade": "F"}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person/{sofia_id}/degree-audit", Status: http.StatusOK, ResponseFn: handleDegreeAuditFn(func(tctx TestContext, audit internal.DegreeAudit) error {
+			require.False(tctx.T, audit.Complete)
+			require.Equal(tctx.T, 3, audit.CompletedCredits)
+			require.Equal(tctx.T, 3, audit.InProgressCredits)
+			require.Equal(tctx.T, 2.0, *audit.GPA)
+			require.Equal(tctx.T, map[string]string{
+				"Core":     internal.ProgressUnsatisfied,
+				"Elective": internal.ProgressPending,
+				"Credits":  internal.ProgressSatisfied,
+				"GPA":      internal.ProgressUnsatisfied,
+			}, requirementStatuses(audit))
+			core := audit.Unsatisfied[0]
+			require.Equal(tctx.T, "Core", core.Name)
+			require.Len(tctx.T, core.Courses, 1)
+			require.Equal(tctx.T, "MATH 301", core.Courses[0].Code)
+			require.Equal(tctx.T, []int{core.CourseIDs[1]}, core.Remaining)
+			require.Equal(tctx.T, tctx.Vars["algebra_id"], fmt.Sprint(core.Remaining[0]))
+			return nil
+		})},
+
+		{Method: "PUT", Url: "/api/offering/{algebra_offering}/persons/{sofia_id}/grade", Headers: admin, Body: `{"grade": "A-"}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/offering/{topology_offering}/persons/{sofia_id}/grade", Headers: admin, Body: `{"grade": "B"}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person/{sofia_id}/degree-audit", Status: http.StatusOK, ResponseFn: handleDegreeAuditFn(func(tctx TestContext, audit internal.DegreeAudit) error {
+			require.True(tctx.T, audit.Complete)
+			require.Empty(tctx.T, audit.Unsatisfied)
+			require.Len(tctx.T, audit.Satisfied, 4)
+			require.Equal(tctx.T, 9, audit.CompletedCredits)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func handleAdvisorsFn(fn func(TestContext, []internal.AdvisorAssignment) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var assignments []internal.AdvisorAssignment
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &assignments))
+		return fn(tctx, assignments)
+	}
+}
+
+// personIDs returns the ids of persons as strings, to compare with saved
+// variables.
+func personIDs(persons []internal.PersonResponse) []string {
+	ids := make([]string, len(persons))
+	for i, person := range persons {
+		ids[i] = fmt.Sprint(person.ID)
+	}
+	return ids
+}
+
+func testAdvisors(tctx TestContext) {
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Emmy", "last_name": "Noether", "type": "professor", "age": 53}`, Status: http.StatusCreated, ResponseFn: saveID("noether_id")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "David", "last_name": "Hilbert", "type": "professor", "age": 61}`, Status: http.StatusCreated, ResponseFn: saveID("hilbert_id")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Olga", "last_name": "Taussky", "type": "student", "age": 22}`, Status: http.StatusCreated, ResponseFn: saveID("taussky_id")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Grete", "last_name": "Hermann", "type": "student", "age": 23}`, Status: http.StatusCreated, ResponseFn: saveID("hermann_id")},
+
+		// Only professors advise, and only students are advised.
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{"advisor_id": {hermann_id}}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Equal(tctx.T, []internal.FieldError{{Field: "advisor_id", Code: "type", Message: fmt.Sprintf("Person with id '%v' is not a professor, so they cannot advise.", tctx.Vars["hermann_id"])}}, problem.Errors)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/person/{hilbert_id}/advisor", Body: `{"advisor_id": {noether_id}}`, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			require.Len(tctx.T, problem.Errors, 1)
+			require.Equal(tctx.T, "id", problem.Errors[0].Field)
+			return nil
+		})},
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{"advisor_id": 999}`, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeValidationFailed)},
+		{Method: "PUT", Url: "/api/person/999/advisor", Body: `{"advisor_id": {noether_id}}`, Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{"advisor_id": {noether_id}}`, Status: http.StatusCreated},
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{"advisor_id": {noether_id}}`, Status: http.StatusOK},
+		{Method: "PUT", Url: "/api/person/{hermann_id}/advisor", Body: `{"advisor_id": {noether_id}}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person?advisor={noether_id}", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Equal(tctx.T, []string{tctx.Vars["taussky_id"], tctx.Vars["hermann_id"]}, personIDs(persons))
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?advisor=x", Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+
+		// Reassigning ends the previous assignment but keeps it in the
+		// history.
+		{Method: "PUT", Url: "/api/person/{taussky_id}/advisor", Body: `{"advisor_id": {hilbert_id}}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person/{taussky_id}/advisors", Status: http.StatusOK, ResponseFn: handleAdvisorsFn(func(tctx TestContext, assignments []internal.AdvisorAssignment) error {
+			require.Len(tctx.T, assignments, 2)
+			require.Equal(tctx.T, tctx.Vars["noether_id"], fmt.Sprint(assignments[0].AdvisorID))
+			require.NotNil(tctx.T, assignments[0].EndedAt)
+			require.Equal(tctx.T, tctx.Vars["hilbert_id"], fmt.Sprint(assignments[1].AdvisorID))
+			require.Nil(tctx.T, assignments[1].EndedAt)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{noether_id}/advisees", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Equal(tctx.T, []string{tctx.Vars["hermann_id"]}, personIDs(persons))
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person/{taussky_id}/advisees", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "GET", Url: "/api/person/{noether_id}/advisors", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "GET", Url: "/api/audit?entity=person&id={taussky_id}", Headers: map[string]string{"Authorization": "Bearer " + adminToken}, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			// Keeping the same advisor records nothing.
+			require.Len(tctx.T, entries, 3)
+			last := entries[len(entries)-1]
+			require.Equal(tctx.T, internal.AuditUpdate, last.Operation)
+			require.Equal(tctx.T, tctx.Vars["noether_id"], fmt.Sprint(last.Diff.Before["advisor_id"]))
+			require.Equal(tctx.T, tctx.Vars["hilbert_id"], fmt.Sprint(last.Diff.After["advisor_id"]))
+			return nil
+		})},
+
+		// Persons in a current assignment keep their type.
+		{Method: "PATCH", Url: "/api/person/{noether_id}", ContentType: internal.MergePatchContentType, Body: `{"type": "student"}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeNotProfessor)},
+		{Method: "PATCH", Url: "/api/person/{hermann_id}", ContentType: internal.MergePatchContentType, Body: `{"type": "professor"}`, Status: http.StatusUnprocessableEntity, ResponseFn: handleProblem(internal.CodeNotStudent)},
+
+		{Method: "DELETE", Url: "/api/person/{hermann_id}/advisor", Status: http.StatusOK},
+		{Method: "DELETE", Url: "/api/person/{hermann_id}/advisor", Status: http.StatusNotFound, ResponseFn: handleProblem(internal.CodeNotFound)},
+		{Method: "GET", Url: "/api/person/{noether_id}/advisees", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Empty(tctx.T, persons)
+			return nil
+		})},
+		{Method: "PATCH", Url: "/api/person/{noether_id}", ContentType: internal.MergePatchContentType, Body: `{"type": "student"}`, Status: http.StatusAccepted},
+	}
+
+	executeTests(tctx, tests)
+}
+
+// multipartBody encodes files as the parts of a multipart/form-data body and
+// returns it with its content type.
+func multipartBody(files map[string]string) (string, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, _ := writer.CreateFormFile(name, name+".csv")
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	return body.String(), writer.FormDataContentType()
+}
+
+func handleImportFn(fn func(TestContext, internal.ImportReport) error) func(TestContext, *httptest.ResponseRecorder) error {
+	return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+		var report internal.ImportReport
+		require.Nil(tctx.T, json.Unmarshal(res.Body.Bytes(), &report))
+		return fn(tctx, report)
+	}
+}
+
+func testImport(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+	persons := func(n int) func(TestContext, *httptest.ResponseRecorder) error {
+		return handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, n)
+			return nil
+		})
+	}
+
+	valid, validType := multipartBody(map[string]string{
+		"courses": "name,department,number,credit_hours,capacity\n" +
+			"Number Theory,MATH,501,3,\n" +
+			"Combinatorics,math,502,4,1\n",
+		"persons": "\ufefffirst_name,last_name,type,age,department,major\n" +
+			"Paul,Erdos,professor,83,MATH,\n" +
+			"Srinivasa,Ramanujan,student,32,,math-ba\n" +
+			"Terence,Tao,student,24,,\n",
+		"enrollments": "person,course,role\n" +
+			"Paul Erdos,MATH 501,\n" +
+			"Srinivasa Ramanujan,Number Theory,\n" +
+			"Srinivasa Ramanujan,math 502,\n" +
+			"Terence Tao,Combinatorics,\n",
+	})
+	invalid, invalidType := multipartBody(map[string]string{
+		"courses": "name,colour\n" +
+			"Number Theory,blue\n",
+		"persons": "first_name,last_name,type,age,department,major\n" +
+			"Paul,Erdos,professor,83,MATH,\n" +
+			"Emil,Artin,student,old,,\n" +
+			"Ada,Lovelace,student,36,MATH,NOPE\n",
+		"enrollments": "person,course\n" +
+			"Paul Erdos,MATH 501\n" +
+			"Paul Erdos,Calculus,ta\n",
+	})
+	expected := func(tctx TestContext, report internal.ImportReport) {
+		require.Equal(tctx.T, internal.ImportCounts{Courses: 2, Persons: 3, Enrollments: 4}, report.Imported)
+		require.Equal(tctx.T, 1, report.Waitlisted)
+		require.Empty(tctx.T, report.Errors)
+	}
+
+	tests := []UnitTest{
+		{Method: "POST", Url: "/api/import", Body: valid, ContentType: validType, Status: http.StatusUnauthorized, ResponseFn: handleProblem(internal.CodeUnauthorized)},
+		{Method: "POST", Url: "/api/import", Body: `{}`, Headers: admin, Status: http.StatusUnsupportedMediaType, ResponseFn: handleProblem(internal.CodeUnsupportedMediaType)},
+		{Method: "POST", Url: "/api/import?dry_run=maybe", Body: valid, ContentType: validType, Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeInvalidParameter)},
+
+		// A dry run reports what would be imported and writes nothing.
+		{Method: "POST", Url: "/api/import?dry_run=true", Body: valid, ContentType: validType, Headers: admin, Status: http.StatusOK, ResponseFn: handleImportFn(func(tctx TestContext, report internal.ImportReport) error {
+			require.True(tctx.T, report.DryRun)
+			expected(tctx, report)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?q=erdos", Status: http.StatusOK, ResponseFn: persons(0)},
+
+		// Failed rows are reported with their line, and nothing is imported.
+		{Method: "POST", Url: "/api/import", Body: invalid, ContentType: invalidType, Headers: admin, Status: http.StatusBadRequest, ResponseFn: handleProblemFn(internal.CodeValidationFailed, func(tctx TestContext, problem internal.Problem) error {
+			type row struct {
+				File   string
+				Line   int
+				Fields []string
+			}
+			rows := []row{}
+			for _, r := range problem.Rows {
+				fields := []string{}
+				for _, err := range r.Errors {
+					fields = append(fields, err.Field)
+				}
+				rows = append(rows, row{r.File, r.Line, fields})
+			}
+			require.Equal(tctx.T, []row{
+				{"courses", 1, []string{"colour"}},
+				{"persons", 3, []string{"age"}},
+				{"persons", 4, []string{"major"}},
+				{"enrollments", 2, []string{"course"}},
+				{"enrollments", 3, []string{}},
+			}, rows)
+			// A record with more fields than the header is a CSV error.
+			require.Equal(tctx.T, internal.CodeInvalidBody, problem.Rows[4].Code)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?q=erdos", Status: http.StatusOK, ResponseFn: persons(0)},
+
+		{Method: "POST", Url: "/api/import", Body: valid, ContentType: validType, Headers: admin, Status: http.StatusCreated, ResponseFn: handleImportFn(func(tctx TestContext, report internal.ImportReport) error {
+			require.False(tctx.T, report.DryRun)
+			expected(tctx, report)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person?q=ramanujan&department=MATH", Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			require.Len(tctx.T, persons[0].Courses, 2)
+			tctx.Vars["ramanujan_id"] = fmt.Sprint(persons[0].ID)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/audit?entity=person&id={ramanujan_id}", Headers: admin, Status: http.StatusOK, ResponseFn: handleAuditFn(func(tctx TestContext, entries []internal.AuditEntry) error {
+			require.NotEmpty(tctx.T, entries)
+			require.Equal(tctx.T, internal.AuditCreate, entries[0].Operation)
+			return nil
+		})},
+
+		// Importing the same files again breaks the rules of the API.
+		{Method: "POST", Url: "/api/import?dry_run=true", Body: valid, ContentType: validType, Headers: admin, Status: http.StatusOK, ResponseFn: handleImportFn(func(tctx TestContext, report internal.ImportReport) error {
+			require.Len(tctx.T, report.Errors, 6)
+			require.Equal(tctx.T, "number", report.Errors[0].Errors[0].Field)
+			require.Equal(tctx.T, "ambiguous", report.Errors[len(report.Errors)-1].Errors[0].Code)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func testExport(tctx TestContext) {
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+	csvAccept := map[string]string{"Accept": "text/csv"}
+	handleCSVFn := func(fn func(tctx TestContext, records [][]string) error) func(TestContext, *httptest.ResponseRecorder) error {
+		return func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, internal.CSVContentType, res.Header().Get("Content-Type"))
+			require.Contains(tctx.T, res.Header().Values("Vary"), "Accept")
+			records, err := csv.NewReader(res.Body).ReadAll()
+			require.Nil(tctx.T, err)
+			return fn(tctx, records)
+		}
+	}
+
+	rows := "first_name,last_name,type,age,department,major\n"
+	for i := 1; i <= 250; i++ {
+		rows += fmt.Sprintf("Row%03d,Batch,student,20,,\n", i)
+	}
+	batch, batchType := multipartBody(map[string]string{"persons": rows})
+	roundTrip, roundTripType := multipartBody(map[string]string{"courses": "{courses_csv}", "persons": "{persons_csv}"})
+
+	tests := []UnitTest{
+		// Persons are flattened, with their courses joined by semicolons.
+		{Method: "GET", Url: "/api/person?q=ramanujan&department=MATH", Headers: csvAccept, Status: http.StatusOK, ResponseFn: handleCSVFn(func(tctx TestContext, records [][]string) error {
+			require.Equal(tctx.T, [][]string{
+				{"id", "first_name", "last_name", "type", "age", "department", "major", "courses"},
+				{tctx.Vars["ramanujan_id"], "Srinivasa", "Ramanujan", "student", "32", "", "MATH-BA", "Number Theory; Combinatorics"},
+			}, records)
+			return nil
+		})},
+		// Pagination is the same as for JSON.
+		{Method: "GET", Url: "/api/person?limit=2&sort=id", Headers: map[string]string{"Accept": "text/csv;q=0.9, application/json;q=0.5"}, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.NotEmpty(tctx.T, res.Header().Get("X-Total-Count"))
+			require.Contains(tctx.T, res.Header().Get("Link"), `rel="next"`)
+			return handleCSVFn(func(tctx TestContext, records [][]string) error {
+				require.Len(tctx.T, records, 3)
+				return nil
+			})(tctx, res)
+		}},
+		{Method: "GET", Url: "/api/course?department=MATH&sort=-id&limit=2", Headers: map[string]string{"Accept": "text/*"}, Status: http.StatusOK, ResponseFn: handleCSVFn(func(tctx TestContext, records [][]string) error {
+			require.Len(tctx.T, records, 3)
+			require.Equal(tctx.T, []string{"id", "code", "name", "department", "number", "credit_hours", "capacity", "instructors", "student_count"}, records[0])
+			require.Equal(tctx.T, []string{"MATH 501", "Number Theory", "MATH", "501", "3", "", "Paul Erdos", "1"}, records[2][1:])
+			return nil
+		})},
+
+		// JSON stays the default.
+		{Method: "GET", Url: "/api/person?q=ramanujan", Headers: map[string]string{"Accept": "*/*"}, Status: http.StatusOK, ResponseFn: handlePersonsFn(func(tctx TestContext, persons []internal.PersonResponse) error {
+			require.Len(tctx.T, persons, 1)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/course", Headers: map[string]string{"Accept": "text/csv;q=0.5, application/json"}, Status: http.StatusOK, ResponseFn: handleCoursesFn(func(tctx TestContext, courses []internal.Course) error {
+			require.NotEmpty(tctx.T, courses)
+			return nil
+		})},
+		{Method: "GET", Url: "/api/person", Headers: map[string]string{"Accept": "application/xml"}, Status: http.StatusNotAcceptable, ResponseFn: handleProblem(internal.CodeNotAcceptable)},
+		{Method: "GET", Url: "/api/course", Headers: map[string]string{"Accept": "text/csv;q=0, application/json;q=0"}, Status: http.StatusNotAcceptable, ResponseFn: handleProblem(internal.CodeNotAcceptable)},
+		{Method: "GET", Url: "/api/person?colour=blue", Headers: csvAccept, Status: http.StatusBadRequest, ResponseFn: handleProblem(internal.CodeUnknownParameter)},
+
+		// Cells that a spreadsheet would evaluate are escaped.
+		{Method: "POST", Url: "/api/person", Status: http.StatusCreated, Body: `
+		{
+			"first_name": "=HYPERLINK(1)",
+			"last_name": "Formula",
+			"type": "student",
+			"age": 20,
+			"courses": []
+		}`},
+		{Method: "GET", Url: "/api/person?last_name=Formula", Headers: csvAccept, Status: http.StatusOK, ResponseFn: handleCSVFn(func(tctx TestContext, records [][]string) error {
+			require.Len(tctx.T, records, 2)
+			require.Equal(tctx.T, "'=HYPERLINK(1)", records[1][1])
+			return nil
+		})},
+
+		// Without a limit, every row is exported, across batches.
+		{Method: "POST", Url: "/api/import", Body: batch, ContentType: batchType, Headers: admin, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person?last_name=Batch&sort=-first_name", Headers: csvAccept, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			require.Equal(tctx.T, "250", res.Header().Get("X-Total-Count"))
+			require.Empty(tctx.T, res.Header().Get("Link"))
+			return handleCSVFn(func(tctx TestContext, records [][]string) error {
+				require.Len(tctx.T, records, 251)
+				for i, record := range records[1:] {
+					require.Equal(tctx.T, fmt.Sprintf("Row%03d", 250-i), record[1])
+				}
+				return nil
+			})(tctx, res)
+		}},
+		{Method: "GET", Url: "/api/person?last_name=Batch&sort=first_name&offset=240", Headers: csvAccept, Status: http.StatusOK, ResponseFn: handleCSVFn(func(tctx TestContext, records [][]string) error {
+			require.Len(tctx.T, records, 11)
+			require.Equal(tctx.T, "Row241", records[1][1])
+			return nil
+		})},
+
+		// Exported files import again, with their lists escaped.
+		{Method: "POST", Url: "/api/department", Body: `{"code": "TRIP", "name": "Round Trips"}`, Status: http.StatusCreated, ResponseFn: saveID("trip")},
+		{Method: "POST", Url: "/api/course", Body: `{"name": "Sets; Logic\\Proofs", "department_id": {trip}, "credit_hours": 3, "capacity": 10}`, Status: http.StatusCreated, ResponseFn: saveID("sets")},
+		{Method: "POST", Url: "/api/person", Body: `{"first_name": "Round", "last_name": "Trip", "type": "student", "age": 21, "courses": [{sets}]}`, Status: http.StatusCreated},
+		{Method: "GET", Url: "/api/person?last_name=Trip", Headers: csvAccept, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			tctx.Vars["persons_csv"] = res.Body.String()
+			return handleCSVFn(func(tctx TestContext, records [][]string) error {
+				require.Equal(tctx.T, `Sets\; Logic\\Proofs`, records[1][7])
+				return nil
+			})(tctx, res)
+		}},
+		{Method: "GET", Url: "/api/course?department=TRIP", Headers: csvAccept, Status: http.StatusOK, ResponseFn: func(tctx TestContext, res *httptest.ResponseRecorder) error {
+			tctx.Vars["courses_csv"] = res.Body.String()
+			return nil
+		}},
+		{Method: "POST", Url: "/api/import?dry_run=true", Body: roundTrip, ContentType: roundTripType, Headers: admin, Status: http.StatusOK, ResponseFn: handleImportFn(func(tctx TestContext, report internal.ImportReport) error {
+			require.Empty(tctx.T, report.Errors)
+			require.Equal(tctx.T, internal.ImportCounts{Courses: 1, Persons: 1}, report.Imported)
+			return nil
+		})},
+	}
+
+	executeTests(tctx, tests)
+}
+
+func TestMain(t *testing.T) {
+	store, err := internal.NewSeededMemoryStore()
+	require.Nil(t, err)
+
+	testSuites(t, store)
+}
+
+// TestPostgres runs the suites against a Postgres database, which it resets
+// by reverting and reapplying every migration. DATABASE_URL names a database
+// the test may wipe; without it the test is skipped.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	require.Nil(t, err)
+
+	migrations, err := internal.LoadMigrations()
+	require.Nil(t, err)
+	migrator, err := internal.NewMigrator(db)
+	require.Nil(t, err)
+	_, err = migrator.Down(len(migrations))
+	require.Nil(t, err)
+	applied, err := migrator.Up()
+	require.Nil(t, err)
+	require.Len(t, applied, len(migrations))
+
+	store := internal.NewGormStore(db)
+	require.Nil(t, internal.Seed(store))
+	testSuites(t, store)
+}
+
+// testSuites runs every suite, in order, against a seeded store.
+func testSuites(t *testing.T, store internal.Store) {
+	r := internal.InitServer(internal.Deps{Store: store, AdminToken: adminToken})
+
+	tctx := NewTestContext(t, r)
+	testCourses(tctx)
+	testPersons(tctx)
+	testPersonsByID(tctx)
+	testEnrollments(tctx)
+	testPagination(tctx)
+	testPersonFilters(tctx)
+	testProblems(tctx)
+	testValidation(tctx)
+	testPatch(tctx)
+	testConditionalRequests(tctx)
+	testSoftDelete(tctx)
+	testAudit(tctx)
+	testOfferings(tctx)
+	testWaitlist(tctx)
+	testPrerequisites(tctx)
+	testRoles(tctx)
+	testGrades(tctx)
+	testMeetings(tctx)
+	testCalendar(tctx)
+	testDepartments(tctx)
+	testDegreeAudit(tctx)
+	testAdvisors(tctx)
+	testImport(tctx)
+	testExport(tctx)
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := internal.LoadMigrations()
+	require.Nil(t, err)
+	require.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		require.Equal(t, i+1, migration.Version, "migration versions must be consecutive")
+		require.NotEmpty(t, migration.Up)
+		require.NotEmpty(t, migration.Down)
+	}
 }
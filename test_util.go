@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -18,6 +19,16 @@ func executeRequest(req *http.Request, r *chi.Mux) *httptest.ResponseRecorder {
 	return rr
 }
 
+// linkURL returns the target of the rel link in the response Link header.
+func linkURL(res *httptest.ResponseRecorder, rel string) string {
+	re := regexp.MustCompile(`<([^>]*)>; rel="` + rel + `"`)
+	match := re.FindStringSubmatch(res.Header().Get("Link"))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
 func applyVars(src *string, tctx TestContext) {
 	for k, v := range tctx.Vars {
 		*src = strings.ReplaceAll(*src, "{"+k+"}", v)
@@ -47,10 +58,18 @@ func executeTest(tctx TestContext) error {
 	if test.Body != "" {
 		body := bytes.NewReader([]byte(test.Body))
 		req, _ = http.NewRequest(test.Method, test.Url, body)
-		req.Header.Add("Content-Type", "application/json")
+		contentType := test.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Add("Content-Type", contentType)
 	} else {
 		req, _ = http.NewRequest(test.Method, test.Url, nil)
 	}
+	for key, val := range test.Headers {
+		applyVars(&val, tctx)
+		req.Header.Set(key, val)
+	}
 	res := executeRequest(req, tctx.R)
 
 	require.Equal(t, test.Status, res.Code)
@@ -66,9 +85,13 @@ func executeTest(tctx TestContext) error {
 }
 
 type UnitTest struct {
-	Method     string
-	Url        string
-	Body       string
+	Method string
+	Url    string
+	Body   string
+	// ContentType of Body, application/json when empty.
+	ContentType string
+	// Headers are added to the request after variable substitution.
+	Headers    map[string]string
 	Status     int
 	ResponseFn func(TestContext, *httptest.ResponseRecorder) error
 }